@@ -0,0 +1,109 @@
+package alert
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AckSigner : sign acknowledge links embedded in messages, so the link can be used without login
+type AckSigner struct {
+	Secret  string        `yaml:"secret"`
+	BaseUrl string        `yaml:"baseUrl"` // external address of alertengine, for example http://10.0.0.1:5050
+	Expire  time.Duration `yaml:"expire"`
+}
+
+// Enabled : links are generated only if secret and base url are configured
+func (a AckSigner) Enabled() bool {
+	return a.Secret != "" && a.BaseUrl != ""
+}
+
+// actions of signed links, the action is signed so that a link could not be used for other actions
+const (
+	AckAction     = "ack"
+	SilenceAction = "silence"
+)
+
+func (a AckSigner) sign(action, topic, id string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(a.Secret))
+	mac.Write([]byte(fmt.Sprintf("%s\n%s\n%s\n%d", action, topic, id, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Link : signed link of action on path, empty if not enabled
+func (a AckSigner) Link(path, action, topic, id string) string {
+	if !a.Enabled() {
+		return ""
+	}
+	expires := time.Now().Add(a.Expire).Unix()
+	q := url.Values{}
+	q.Set("topic", topic)
+	q.Set("id", id)
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sign", a.sign(action, topic, id, expires))
+	return a.BaseUrl + path + "?" + q.Encode()
+}
+
+// Verify : verify signed link query of action, action is decided by the handler instead of the query
+func (a AckSigner) Verify(action string, q url.Values) error {
+	if !a.Enabled() {
+		return fmt.Errorf("signed link is not enabled")
+	}
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expires")
+	}
+	if time.Now().Unix() > expires {
+		return fmt.Errorf("link expired")
+	}
+	expected := a.sign(action, q.Get("topic"), q.Get("id"), expires)
+	if !hmac.Equal([]byte(expected), []byte(q.Get("sign"))) {
+		return fmt.Errorf("invalid sign")
+	}
+	return nil
+}
+
+// SilenceDuration : how long an alert is silenced by the silence link
+const SilenceDuration = time.Hour
+
+func formatSilence(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%d小时", d/time.Hour)
+	}
+	return fmt.Sprintf("%d分钟", d/time.Minute)
+}
+
+// ackMessage : plain message with acknowledge link appended
+type ackMessage struct {
+	Message
+	link string
+}
+
+func (a ackMessage) Content() string {
+	return fmt.Sprintf("%s\n\n[确认告警](%s)", a.Message.Content(), a.link)
+}
+
+// WithAckLink : embed acknowledge link into message
+func WithAckLink(message Message, link string) Message {
+	if link == "" {
+		return message
+	}
+	if p, ok := message.(Payload); ok {
+		p.AckLink = link
+		return p
+	}
+	return ackMessage{Message: message, link: link}
+}
+
+// WithSilenceLink : set silence link of structured message, plain message is returned as is
+func WithSilenceLink(message Message, link string) Message {
+	if p, ok := message.(Payload); ok && link != "" {
+		p.SilenceLink = link
+		return p
+	}
+	return message
+}
@@ -1,38 +1,213 @@
 package alert
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/sirupsen/logrus"
+	"strings"
 	"sync"
 	"time"
 )
 
 // Subscribe : subscribe associate to task (taskName), store in redis, set expire time 1h and keep heartbeat
 type Subscribe struct {
-	Topic         string     `json:"topic"`
-	Receiver      []Receiver `json:"receiver"`
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
-	Triggered     int        `json:"triggered"`
-	LastTriggered time.Time  `json:"last_triggered"`
+	Topic         string                  `json:"topic"`
+	Receiver      []Receiver              `json:"receiver"`
+	Templates     map[string]Template     `json:"templates"` // template of each receiver type and digest template of type with DigestSuffix, use the default ones if absent
+	Throttle      *Throttle               `json:"throttle"`  // rate limit, dedup and quiet hours of the topic
+	Digest        string                  `json:"digest"`    // digest period of Info and Warn messages, empty if disabled
+	Verified      map[string]Verification `json:"verified"`  // the last verification result of each receiver id
+	CreatedAt     time.Time               `json:"created_at"`
+	UpdatedAt     time.Time               `json:"updated_at"`
+	Triggered     int                     `json:"triggered"`
+	LastTriggered time.Time               `json:"last_triggered"`
+	digest        *digester
 	rw            sync.RWMutex
 }
 
+// Send : send message to receivers, Info and Warn messages are added to digest if enabled.
+// Receivers are delivered without holding the lock, so slow receivers do not block the subscribe
 func (s *Subscribe) Send(message Message) error {
 	s.rw.Lock()
-	defer s.rw.Unlock()
+	if s.digestible(message) {
+		s.addDigest(message)
+		s.rw.Unlock()
+		return nil
+	}
+	c := s.sendContext(s.Receiver)
+	s.rw.Unlock()
+	return c.send(message)
+}
+
+// SendTo : send message to the given receivers with templates of the subscribe, used by escalation tiers
+func (s *Subscribe) SendTo(receivers []Receiver, message Message) error {
+	s.rw.RLock()
+	c := s.sendContext(receivers)
+	s.rw.RUnlock()
+	return c.send(message)
+}
+
+// sendContext : copy of topic, receivers, templates and throttle used by sending, must hold the lock
+func (s *Subscribe) sendContext(receivers []Receiver) subscribeContext {
+	c := subscribeContext{
+		topic:     s.Topic,
+		receivers: make([]Receiver, len(receivers)),
+		templates: make(map[string]Template, len(s.Templates)),
+		throttle:  s.Throttle,
+	}
+	copy(c.receivers, receivers)
+	for k, v := range s.Templates {
+		c.templates[k] = v
+	}
+	return c
+}
+
+// subscribeContext : snapshot of subscribe taken under the lock, throttles are replaced rather than modified
+type subscribeContext struct {
+	topic     string
+	receivers []Receiver
+	templates map[string]Template
+	throttle  *Throttle
+}
+
+func (c subscribeContext) send(message Message) error {
+	return sendAll(c.topic, c.receivers, c.templates, c.throttle, message)
+}
+
+// sendAll : render message with templates, fall back to DefaultTemplates, and deliver it to receivers.
+// Messages suppressed by throttles are not treated as failure
+func sendAll(topic string, receivers []Receiver, templates map[string]Template, throttle *Throttle, message Message) error {
+	if err := defaultThrottler.allowTopic(topic, throttle, message); err != nil {
+		logrus.Infof("message of %s suppressed: %s", topic, err.Error())
+		return nil
+	}
+	receivers = expandOnCall(receivers)
 	var failed []string
-	for _, r := range s.Receiver {
-		err := r.Message(message)
-		if err != nil {
+	// emails are rendered by the same template, so they are sent in batches
+	var mails []Receiver
+	var mailMessage Message
+	for _, r := range receivers {
+		m := render(topic, templates, r.Api().Type, message)
+		if defaultThrottler.hold(topic, r, throttle, message, m) {
+			continue
+		}
+		if err := defaultThrottler.allowReceiver(r, message); err != nil {
+			logSuppressed(topic, r, err)
+			continue
+		}
+		if _, ok := r.(Mail); ok {
+			mails, mailMessage = append(mails, r), m
+			continue
+		}
+		if err := deliver(topic, r, m); err != nil {
 			failed = append(failed, err.Error())
 		}
 	}
+	if len(mails) > 0 {
+		failed = append(failed, deliverMails(topic, mails, mailMessage)...)
+	}
 	if len(failed) > 0 {
-		return fmt.Errorf("subscribe %s message push failed %d", s.Topic, len(failed))
+		return fmt.Errorf("subscribe %s message push failed %d: %s", topic, len(failed), strings.Join(failed, "; "))
 	}
 	return nil
 }
 
+// deliver : deliver message and submit it to the retry queue if failed
+func deliver(topic string, r Receiver, m Message) error {
+	err := Deliver(topic, r, m, 1)
+	if err != nil {
+		retry(topic, r, m, err)
+	}
+	return err
+}
+
+// retry : submit failed first attempt to the retry queue
+func retry(topic string, r Receiver, m Message, err error) {
+	if deliveryQueue != nil {
+		deliveryQueue.Submit(Delivery{
+			Topic:     topic,
+			Receiver:  r,
+			Message:   m,
+			Attempts:  1,
+			LastError: err.Error(),
+			Created:   time.Now(),
+		})
+	}
+}
+
+// deliverMails : send message to email receivers in batches, each receiver is observed and retried separately
+func deliverMails(topic string, rs []Receiver, m Message) []string {
+	var failed []string
+	size := mailBatchSize()
+	for i := 0; i < len(rs); i += size {
+		batch := rs[i:]
+		if len(batch) > size {
+			batch = batch[:size]
+		}
+		if len(batch) == 1 {
+			if err := deliver(topic, batch[0], m); err != nil {
+				failed = append(failed, err.Error())
+			}
+			continue
+		}
+		to := make([]string, 0, len(batch))
+		for _, r := range batch {
+			to = append(to, r.Api().Address)
+		}
+		start := time.Now()
+		err := SendMail(to, m)
+		for _, r := range batch {
+			observe(topic, r, m, 1, start, err)
+			if err != nil {
+				retry(topic, r, m, err)
+				failed = append(failed, err.Error())
+			}
+		}
+	}
+	return failed
+}
+
+// Trigger : increase trigger counter, return the counter and the trigger time
+func (s *Subscribe) Trigger() (int, time.Time) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	s.Triggered++
+	s.LastTriggered = time.Now()
+	return s.Triggered, s.LastTriggered
+}
+
+// SubscribeState : fields of subscribe saved besides receivers, templates and verifications
+type SubscribeState struct {
+	Throttle      *Throttle
+	Digest        string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Triggered     int
+	LastTriggered time.Time
+}
+
+// State : return a copy of the saved fields
+func (s *Subscribe) State() SubscribeState {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return SubscribeState{
+		Throttle:      s.Throttle,
+		Digest:        s.Digest,
+		CreatedAt:     s.CreatedAt,
+		UpdatedAt:     s.UpdatedAt,
+		Triggered:     s.Triggered,
+		LastTriggered: s.LastTriggered,
+	}
+}
+
+// SetThrottle : throttle must be validated, nil to remove
+func (s *Subscribe) SetThrottle(t *Throttle) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	s.Throttle = t
+	s.UpdatedAt = time.Now()
+}
+
 // AddReceiver : add receiver
 func (s *Subscribe) AddReceiver(receiver Receiver) error {
 	s.rw.RLock()
@@ -66,5 +241,114 @@ func (s *Subscribe) DeleteReceiver(id string) error {
 }
 
 func (s *Subscribe) UpdateReceiver(receiver []Receiver) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
 	s.Receiver = receiver
+	s.UpdatedAt = time.Now()
+	// verification results of removed receivers are dropped
+	ids := make(map[string]bool, len(receiver))
+	for _, r := range receiver {
+		ids[r.Id()] = true
+	}
+	for id := range s.Verified {
+		if !ids[id] {
+			delete(s.Verified, id)
+		}
+	}
+}
+
+// Verifications : return a copy of verification results
+func (s *Subscribe) Verifications() []Verification {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	res := make([]Verification, 0, len(s.Verified))
+	for _, v := range s.Verified {
+		res = append(res, v)
+	}
+	return res
+}
+
+// Receivers : return a copy of receivers
+func (s *Subscribe) Receivers() []Receiver {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	rs := make([]Receiver, len(s.Receiver))
+	copy(rs, s.Receiver)
+	return rs
+}
+
+// MarshalJSON : secrets of receivers are redacted, subscribes are only serialized by API
+func (s *Subscribe) MarshalJSON() ([]byte, error) {
+	type subscribe Subscribe
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return json.Marshal(struct {
+		*subscribe
+		Receiver []BaseApi `json:"receiver"`
+	}{(*subscribe)(s), RedactApis(ApisOf(s.Receiver))})
+}
+
+// render : render structured message with template of receiver type, plain message is returned as is
+func render(topic string, templates map[string]Template, receiverType string, message Message) Message {
+	if d, ok := message.(*Digest); ok {
+		return d.render(templates, receiverType)
+	}
+	structured, ok := message.(Structured)
+	if !ok {
+		return message
+	}
+	t, ok := templates[receiverType]
+	if !ok {
+		if t, ok = DefaultTemplates[receiverType]; !ok {
+			return message
+		}
+	}
+	rendered, err := t.Render(structured.Data())
+	if err != nil {
+		logrus.Errorf("render message of %s for %s failed: %s", topic, receiverType, err.Error())
+		return message
+	}
+	return rendered
+}
+
+// SetTemplate : set template of receiver type
+func (s *Subscribe) SetTemplate(receiverType string, t Template) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	if s.Templates == nil {
+		s.Templates = make(map[string]Template)
+	}
+	s.Templates[receiverType] = t
+}
+
+// DeleteTemplate : delete template of receiver type, return false if not exist
+func (s *Subscribe) DeleteTemplate(receiverType string) bool {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	if _, ok := s.Templates[receiverType]; !ok {
+		return false
+	}
+	delete(s.Templates, receiverType)
+	return true
+}
+
+// CustomTemplates : return a copy of custom templates
+func (s *Subscribe) CustomTemplates() map[string]Template {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	ts := make(map[string]Template, len(s.Templates))
+	for k, v := range s.Templates {
+		ts[k] = v
+	}
+	return ts
+}
+
+// Template : template of receiver type or digest template of type with DigestSuffix, fall back to the default one
+func (s *Subscribe) Template(receiverType string) (Template, bool) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	if t, ok := s.Templates[receiverType]; ok {
+		return t, true
+	}
+	return DefaultTemplate(receiverType)
 }
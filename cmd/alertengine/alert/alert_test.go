@@ -0,0 +1,43 @@
+package alert
+
+import (
+	"github.com/go-playground/assert/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendWithoutLock(t *testing.T) {
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+
+	sub := &Subscribe{Topic: "lock", Receiver: []Receiver{Webhook{BaseApi{Type: WebhookType, Address: srv.URL}}}}
+	sent := make(chan error)
+	go func() {
+		sent <- sub.Send(testMessage("a"))
+	}()
+	<-arrived
+	// the subscribe could be changed while the receiver is slow
+	changed := make(chan struct{})
+	go func() {
+		sub.SetThrottle(nil)
+		sub.SetTemplate(WebhookType, Template{Body: "{}"})
+		triggered, _ := sub.Trigger()
+		assert.Equal(t, triggered, 1)
+		close(changed)
+	}()
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscribe is locked while sending")
+	}
+	close(release)
+	assert.Equal(t, <-sent, nil)
+	assert.Equal(t, sub.State().Triggered, 1)
+}
@@ -1,5 +1,7 @@
 package alert
 
+import "fmt"
+
 type Sender interface {
 	// Push : push messages to a group of users or specific users
 	Push(address string, message Message) error
@@ -9,6 +11,8 @@ type Sender interface {
 
 type Receiver interface {
 	Id() string
+	Api() BaseApi
+	Validate() error
 	Message(message Message) error
 }
 
@@ -17,8 +21,73 @@ type Message interface {
 	Content() string
 }
 
+// receiver types
+const (
+	EmailType    = "email"
+	DingTalkType = "dingTalk"
+	WebhookType  = "webhook"
+	WeComType    = "weCom"
+	FeishuType   = "feishu"
+)
+
 type BaseApi struct {
 	Type    string `json:"type"`
 	Address string `json:"address"`
 	Token   string `json:"token"`
+	Options
+}
+
+// Options : optional settings of receiver, only used by some types
+type Options struct {
+	Method   string            `json:"method,omitempty"`   // webhook: http method, default POST
+	Headers  map[string]string `json:"headers,omitempty"`  // webhook: extra http headers
+	Body     string            `json:"body,omitempty"`     // webhook: body template, see webhook.go
+	Throttle *Throttle         `json:"throttle,omitempty"` // rate limit, dedup and quiet hours of the receiver
+	// dingTalk: keyword of robot, ActionCard with buttons and members mentioned by level, see dingtalk.go
+	Keyword    string   `json:"keyword,omitempty"`
+	ActionCard bool     `json:"actionCard,omitempty"`
+	Mention    *Mention `json:"mention,omitempty"`
+}
+
+func (b BaseApi) Api() BaseApi {
+	return b
+}
+
+// Level : alert level, same as the level used by controller
+type Level int
+
+const (
+	InfoLevel Level = iota
+	WarnLevel
+	AlertLevel
+)
+
+func (l Level) String() string {
+	switch l {
+	case InfoLevel:
+		return "Info"
+	case WarnLevel:
+		return "Warn"
+	case AlertLevel:
+		return "Alert"
+	default:
+		return "Unknown"
+	}
+}
+
+func (l Level) Validate() error {
+	if l < InfoLevel || l > AlertLevel {
+		return fmt.Errorf("invalid level %d", l)
+	}
+	return nil
+}
+
+// ParseLevel : parse level from its name, for example Alert
+func ParseLevel(s string) (Level, error) {
+	for l := InfoLevel; l <= AlertLevel; l++ {
+		if l.String() == s {
+			return l, nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("invalid level %s", s)
 }
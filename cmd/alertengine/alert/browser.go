@@ -0,0 +1,249 @@
+package alert
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BrowserType : receiver pushing messages to browsers connected to the stream, address is the channel name.
+// Browsers subscribe channels, topics or projects of the stream
+const BrowserType = "browser"
+
+// Browser : browser receiver, messages are published to the channel of address
+type Browser struct {
+	BaseApi
+}
+
+func (b Browser) Id() string {
+	return b.Address
+}
+
+func (b Browser) Validate() error {
+	if b.Address == "" {
+		return errors.New("channel could not be empty")
+	}
+	return nil
+}
+
+func (b Browser) Message(message Message) error {
+	if browserHub == nil {
+		return errors.New("browser stream not init")
+	}
+	browserHub.Publish("", b.Address, message)
+	return nil
+}
+
+// Event : message pushed to browsers. Channel is empty for messages of topics, which are sent to clients
+// subscribing the topic or project, otherwise only clients subscribing the channel receive it
+type Event struct {
+	Id      uint64    `json:"id"`
+	Topic   string    `json:"topic,omitempty"`
+	Project string    `json:"project,omitempty"`
+	Channel string    `json:"channel,omitempty"`
+	Level   string    `json:"level,omitempty"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	Payload *Payload  `json:"payload,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// StreamFilter : events subscribed by client, empty topics and projects match all messages of topics,
+// unless only channels are subscribed
+type StreamFilter struct {
+	Topics   []string `json:"topics"`
+	Projects []string `json:"projects"`
+	Channels []string `json:"channels"`
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (f StreamFilter) Match(e Event) bool {
+	if e.Channel != "" {
+		return contains(f.Channels, e.Channel)
+	}
+	if len(f.Topics) == 0 && len(f.Projects) == 0 && len(f.Channels) > 0 {
+		return false
+	}
+	return (len(f.Topics) == 0 || contains(f.Topics, e.Topic)) &&
+		(len(f.Projects) == 0 || contains(f.Projects, e.Project))
+}
+
+// StreamClient : connection of browser
+type StreamClient struct {
+	Id        uint64       `json:"id"`
+	Name      string       `json:"name"` // name of token
+	Remote    string       `json:"remote"`
+	Filter    StreamFilter `json:"filter"`
+	Connected time.Time    `json:"connected"`
+	Sent      int          `json:"sent"`
+	events    chan Event
+	closed    bool
+}
+
+// Events : events of client, closed when the client is removed or too slow
+func (c *StreamClient) Events() <-chan Event {
+	return c.events
+}
+
+const clientBuffer = 64
+
+// Hub : publish events to connected clients and keep the latest events for replay.
+// Event ids increase across restarts since they start from the boot time
+type Hub struct {
+	lastId  uint64
+	events  []Event // ring buffer of the latest events
+	next    int
+	size    int
+	clients map[uint64]*StreamClient
+	seq     uint64
+	closed  bool // clients connected after closed are disconnected immediately
+	mu      sync.Mutex
+}
+
+const DefaultHubBuffer = 1000
+
+func NewHub(size int) *Hub {
+	if size <= 0 {
+		size = DefaultHubBuffer
+	}
+	return &Hub{
+		lastId:  uint64(time.Now().UnixNano() / int64(time.Millisecond) * 1000),
+		events:  make([]Event, 0, size),
+		size:    size,
+		clients: make(map[uint64]*StreamClient),
+	}
+}
+
+var browserHub *Hub
+var hubOnce sync.Once
+
+// InitBrowserHub : init hub used by browser receivers, browser receivers fail if not init
+func InitBrowserHub(size int) *Hub {
+	hubOnce.Do(func() {
+		browserHub = NewHub(size)
+	})
+	return browserHub
+}
+
+// Publish : publish message of topic or channel to clients
+func (h *Hub) Publish(topic, channel string, message Message) {
+	labels := LabelsOf(message)
+	e := Event{
+		Topic:   topic,
+		Project: labels[ProjectLabel],
+		Channel: channel,
+		Level:   labels[LevelLabel],
+		Title:   message.Title(),
+		Content: message.Content(),
+		Time:    time.Now(),
+	}
+	if s, ok := message.(Structured); ok {
+		p := s.Data()
+		e.Payload = &p
+		e.Project, e.Level = p.ProjectId, p.Level.String()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastId++
+	e.Id = h.lastId
+	if len(h.events) < h.size {
+		h.events = append(h.events, e)
+	} else {
+		h.events[h.next] = e
+		h.next = (h.next + 1) % h.size
+	}
+	for _, c := range h.clients {
+		if c.Filter.Match(e) {
+			h.send(c, e)
+		}
+	}
+}
+
+// send : slow client is removed, it could reconnect and replay missed events. Must hold the lock
+func (h *Hub) send(c *StreamClient, e Event) {
+	select {
+	case c.events <- e:
+		c.Sent++
+	default:
+		h.remove(c)
+	}
+}
+
+func (h *Hub) remove(c *StreamClient) {
+	if !c.closed {
+		c.closed = true
+		close(c.events)
+		delete(h.clients, c.Id)
+	}
+}
+
+// Connect : add client, events after lastId are replayed if they are still kept
+func (h *Hub) Connect(name, remote string, filter StreamFilter, lastId uint64) *StreamClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	c := &StreamClient{
+		Id:        h.seq,
+		Name:      name,
+		Remote:    remote,
+		Filter:    filter,
+		Connected: time.Now(),
+		events:    make(chan Event, clientBuffer+h.size),
+	}
+	if h.closed {
+		c.closed = true
+		close(c.events)
+		return c
+	}
+	h.clients[c.Id] = c
+	if lastId > 0 {
+		for i := 0; i < len(h.events); i++ {
+			e := h.events[(h.next+i)%len(h.events)]
+			if e.Id > lastId && filter.Match(e) {
+				h.send(c, e)
+			}
+		}
+	}
+	return c
+}
+
+// Disconnect : remove client
+func (h *Hub) Disconnect(c *StreamClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(c)
+}
+
+// Clients : connected clients sorted by id
+func (h *Hub) Clients() []StreamClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	res := make([]StreamClient, 0, len(h.clients))
+	for _, c := range h.clients {
+		res = append(res, StreamClient{Id: c.Id, Name: c.Name, Remote: c.Remote, Filter: c.Filter,
+			Connected: c.Connected, Sent: c.Sent})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Id < res[j].Id
+	})
+	return res
+}
+
+// Close : disconnect all clients and reject new ones
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, c := range h.clients {
+		h.remove(c)
+	}
+}
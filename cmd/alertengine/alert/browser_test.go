@@ -0,0 +1,43 @@
+package alert
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+)
+
+func TestHub(t *testing.T) {
+	h := NewHub(3)
+	wall := h.Connect("wall", "", StreamFilter{Projects: []string{"3"}}, 0)
+	ops := h.Connect("ops", "", StreamFilter{Channels: []string{"ops"}}, 0)
+
+	h.Publish("task", "", SamplePayload())
+	h.Publish("other", "", WithLabels(testMessage("plain"), map[string]string{ProjectLabel: "4"}))
+	b := Browser{BaseApi{Type: BrowserType, Address: "ops"}}
+	browserHub = h
+	assert.Equal(t, b.Message(testMessage("ops")), nil)
+
+	e := <-wall.Events()
+	assert.Equal(t, e.Topic, "task")
+	assert.Equal(t, e.Project, "3")
+	assert.Equal(t, e.Payload.SensorMac, "C125")
+	assert.Equal(t, len(wall.Events()), 0)
+	// only subscribed channel is received
+	o := <-ops.Events()
+	assert.Equal(t, o.Channel, "ops")
+	assert.Equal(t, o.Title, "ops")
+	assert.Equal(t, len(ops.Events()), 0)
+	assert.Equal(t, len(h.Clients()), 2)
+
+	// reconnect and replay events after the last received one
+	h.Disconnect(wall)
+	h.Publish("task", "", SamplePayload())
+	all := h.Connect("wall", "", StreamFilter{}, e.Id)
+	assert.Equal(t, len(all.Events()), 2)
+	assert.Equal(t, (<-all.Events()).Id, e.Id+1)
+
+	// channel events are not matched, and events beyond the buffer are dropped
+	all = h.Connect("wall", "", StreamFilter{}, e.Id-1)
+	assert.Equal(t, len(all.Events()), 2)
+	h.Close()
+	assert.Equal(t, len(h.Clients()), 0)
+}
@@ -0,0 +1,152 @@
+package alert
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RetryPolicy : retry failed deliveries with exponential backoff,
+// the n-th retry waits Backoff * 2^(n-1) and at most MaxBackoff
+type RetryPolicy struct {
+	MaxAttempts int           `yaml:"maxAttempts" json:"max_attempts"` // including the first attempt
+	Backoff     time.Duration `yaml:"backoff" json:"backoff"`
+	MaxBackoff  time.Duration `yaml:"maxBackoff" json:"max_backoff"`
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     30 * time.Second,
+	MaxBackoff:  30 * time.Minute,
+}
+
+// Validate : at least one attempt and a positive backoff, otherwise failures go to dead letters at once or retry without delay
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts <= 0 {
+		return errors.New("maxAttempts of retry must be positive")
+	}
+	if p.Backoff <= 0 {
+		return errors.New("backoff of retry must be positive")
+	}
+	if p.MaxBackoff < 0 {
+		return errors.New("maxBackoff of retry could not be negative")
+	}
+	return nil
+}
+
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// Delivery : message to be delivered to a receiver
+type Delivery struct {
+	Topic     string
+	Receiver  Receiver
+	Message   Message
+	Attempts  int
+	LastError string
+	Created   time.Time
+}
+
+// DeadLetterFunc : called when delivery exceeds max attempts or the queue is stopped
+type DeadLetterFunc func(d Delivery)
+
+// Queue : retry queue of failed deliveries
+type Queue struct {
+	policy     RetryPolicy
+	deadLetter DeadLetterFunc
+	pending    map[*Delivery]*time.Timer
+	running    sync.WaitGroup // attempts in progress, waited by Stop
+	stopped    bool
+	size       int64
+	mu         sync.Mutex
+}
+
+// NewQueue : policy must be validated
+func NewQueue(policy RetryPolicy, deadLetter DeadLetterFunc) *Queue {
+	return &Queue{
+		policy:     policy,
+		deadLetter: deadLetter,
+		pending:    make(map[*Delivery]*time.Timer),
+	}
+}
+
+var deliveryQueue *Queue
+var queueOnce sync.Once
+
+// InitQueue : init the retry queue used by Subscribe.Send, failed deliveries are dropped if not init
+func InitQueue(policy RetryPolicy, deadLetter DeadLetterFunc) *Queue {
+	queueOnce.Do(func() {
+		deliveryQueue = NewQueue(policy, deadLetter)
+	})
+	return deliveryQueue
+}
+
+// Submit : schedule retry of a failed delivery
+func (q *Queue) Submit(d Delivery) {
+	q.mu.Lock()
+	if q.stopped || d.Attempts >= q.policy.MaxAttempts {
+		q.mu.Unlock()
+		// dead letters are saved to database, not under lock
+		q.deadLetter(d)
+		return
+	}
+	defer q.mu.Unlock()
+	item := &d
+	q.pending[item] = time.AfterFunc(q.policy.backoff(d.Attempts), func() {
+		q.attempt(item)
+	})
+	atomic.AddInt64(&q.size, 1)
+}
+
+func (q *Queue) attempt(d *Delivery) {
+	q.mu.Lock()
+	if _, ok := q.pending[d]; !ok {
+		q.mu.Unlock()
+		return
+	}
+	delete(q.pending, d)
+	atomic.AddInt64(&q.size, -1)
+	q.running.Add(1)
+	q.mu.Unlock()
+	defer q.running.Done()
+
+	d.Attempts++
+	if err := Deliver(d.Topic, d.Receiver, d.Message, d.Attempts); err != nil {
+		d.LastError = err.Error()
+		q.Submit(*d)
+	}
+}
+
+// Len : number of deliveries waiting for retry
+func (q *Queue) Len() int {
+	return int(atomic.LoadInt64(&q.size))
+}
+
+// Stop : stop retrying, pending deliveries are moved to dead letter.
+// Attempts in progress are waited, their failures are moved to dead letter too
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	q.stopped = true
+	pending := make([]Delivery, 0, len(q.pending))
+	for d, timer := range q.pending {
+		// attempt of fired timer returns when it finds the delivery is no longer pending
+		timer.Stop()
+		pending = append(pending, *d)
+		delete(q.pending, d)
+	}
+	atomic.StoreInt64(&q.size, 0)
+	q.mu.Unlock()
+	for _, d := range pending {
+		q.deadLetter(d)
+	}
+	q.running.Wait()
+}
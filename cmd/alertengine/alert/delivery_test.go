@@ -0,0 +1,127 @@
+package alert
+
+import (
+	"errors"
+	"github.com/go-playground/assert/v2"
+	"sync"
+	"testing"
+	"time"
+)
+
+type failReceiver struct {
+	BaseApi
+	mu    sync.Mutex
+	calls int
+	fails int
+}
+
+func (f *failReceiver) Id() string { return f.Address }
+
+func (f *failReceiver) Validate() error { return nil }
+
+func (f *failReceiver) Message(message Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.fails {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, p.backoff(1), time.Second)
+	assert.Equal(t, p.backoff(2), 2*time.Second)
+	assert.Equal(t, p.backoff(3), 4*time.Second)
+	assert.Equal(t, p.backoff(4), 5*time.Second)
+}
+
+func TestQueue(t *testing.T) {
+	dead := make(chan Delivery, 1)
+	q := NewQueue(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}, func(d Delivery) {
+		dead <- d
+	})
+
+	// succeed at the second retry
+	r := &failReceiver{fails: 1}
+	q.Submit(Delivery{Receiver: r, Message: testMessage("a"), Attempts: 1})
+	time.Sleep(50 * time.Millisecond)
+	r.mu.Lock()
+	assert.Equal(t, r.calls, 2)
+	r.mu.Unlock()
+	assert.Equal(t, q.Len(), 0)
+	assert.Equal(t, len(dead), 0)
+
+	// exceed max attempts
+	r = &failReceiver{fails: 10}
+	q.Submit(Delivery{Receiver: r, Message: testMessage("b"), Attempts: 1})
+	select {
+	case d := <-dead:
+		assert.Equal(t, d.Attempts, 3)
+		assert.Equal(t, d.LastError, "failed")
+	case <-time.After(time.Second):
+		t.Fatal("delivery not moved to dead letter")
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	assert.Equal(t, DefaultRetryPolicy.Validate(), nil)
+	assert.Equal(t, RetryPolicy{MaxAttempts: 1, Backoff: time.Second}.Validate(), nil)
+	assert.NotEqual(t, RetryPolicy{Backoff: time.Second}.Validate(), nil)
+	assert.NotEqual(t, RetryPolicy{MaxAttempts: 3}.Validate(), nil)
+	assert.NotEqual(t, RetryPolicy{MaxAttempts: 3, Backoff: time.Second, MaxBackoff: -time.Second}.Validate(), nil)
+}
+
+// blockReceiver : fails after release is closed
+type blockReceiver struct {
+	BaseApi
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b blockReceiver) Id() string { return b.Address }
+
+func (b blockReceiver) Validate() error { return nil }
+
+func (b blockReceiver) Message(message Message) error {
+	b.started <- struct{}{}
+	<-b.release
+	return errors.New("failed")
+}
+
+func TestQueueStop(t *testing.T) {
+	var mu sync.Mutex
+	var dead []Delivery
+	q := NewQueue(RetryPolicy{MaxAttempts: 5, Backoff: time.Millisecond}, func(d Delivery) {
+		mu.Lock()
+		dead = append(dead, d)
+		mu.Unlock()
+	})
+	r := blockReceiver{BaseApi: BaseApi{Address: "block"}, started: make(chan struct{}), release: make(chan struct{})}
+	q.Submit(Delivery{Receiver: r, Message: testMessage("a"), Attempts: 1})
+	<-r.started
+	// pending until stopped
+	q.policy.Backoff = time.Hour
+	q.Submit(Delivery{Receiver: &failReceiver{}, Message: testMessage("b"), Attempts: 1})
+
+	stopped := make(chan struct{})
+	go func() {
+		q.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("stop does not wait for the running attempt")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(r.release)
+	<-stopped
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, len(dead), 2)
+	assert.Equal(t, q.Len(), 0)
+	// the running attempt failed after stop is moved to dead letter
+	assert.Equal(t, dead[1].Attempts, 2)
+	assert.Equal(t, dead[1].LastError, "failed")
+}
@@ -0,0 +1,291 @@
+package alert
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ParseDigest : parse digest period of subscribe, empty means digest is disabled
+func ParseDigest(period string) (time.Duration, error) {
+	if period == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d < time.Minute {
+		return 0, fmt.Errorf("digest period must be a duration not less than 1m")
+	}
+	return d, nil
+}
+
+// DigestEntry : messages of the same task and sensor in a digest, plain messages are grouped by title
+type DigestEntry struct {
+	TaskId         string    `json:"task_id"`
+	SensorMac      string    `json:"sensor_mac"`
+	SensorType     string    `json:"sensor_type"`
+	Title          string    `json:"title"`
+	Level          Level     `json:"level"` // the highest level
+	Count          int       `json:"count"`
+	First          time.Time `json:"first"`
+	Last           time.Time `json:"last"`
+	Worst          *float64  `json:"worst"` // value furthest beyond thresholds, nil for plain messages
+	ThresholdLower float64   `json:"threshold_lower"`
+	ThresholdUpper float64   `json:"threshold_upper"`
+}
+
+func deviation(v, lower, upper float64) float64 {
+	return math.Max(math.Max(lower-v, v-upper), 0)
+}
+
+// Digest : summary of Info and Warn messages of a subscribe in a period
+type Digest struct {
+	Topic   string         `json:"topic"`
+	Start   time.Time      `json:"start"`
+	Stop    time.Time      `json:"stop"`
+	Total   int            `json:"total"`
+	Entries []*DigestEntry `json:"entries"`
+	index   map[string]*DigestEntry
+}
+
+func newDigest(topic string) *Digest {
+	return &Digest{Topic: topic, Start: time.Now(), index: make(map[string]*DigestEntry)}
+}
+
+// Add : add message to digest
+func (d *Digest) Add(message Message) {
+	now := time.Now()
+	var key string
+	var level Level
+	var p *Payload
+	if structured, ok := message.(Structured); ok {
+		data := structured.Data()
+		p = &data
+		level = data.Level
+		key = fmt.Sprintf("%s#%s#%s", data.TaskId, data.SensorMac, data.SensorType)
+	} else {
+		if LabelsOf(message)[LevelLabel] == WarnLevel.String() {
+			level = WarnLevel
+		}
+		key = "#" + message.Title()
+	}
+	e, ok := d.index[key]
+	if !ok {
+		e = &DigestEntry{Title: message.Title(), Level: level, First: now}
+		if p != nil {
+			e.TaskId, e.SensorMac, e.SensorType = p.TaskId, p.SensorMac, p.SensorType
+		}
+		d.index[key] = e
+		d.Entries = append(d.Entries, e)
+	}
+	e.Count++
+	e.Last = now
+	if level > e.Level {
+		e.Level = level
+	}
+	if p != nil && (e.Worst == nil || deviation(p.Value, p.ThresholdLower, p.ThresholdUpper) >
+		deviation(*e.Worst, e.ThresholdLower, e.ThresholdUpper)) {
+		v := p.Value
+		e.Worst = &v
+		e.ThresholdLower, e.ThresholdUpper = p.ThresholdLower, p.ThresholdUpper
+	}
+	d.Total++
+}
+
+// sorted : entries sorted by level and count
+func (d *Digest) sorted() {
+	sort.SliceStable(d.Entries, func(i, j int) bool {
+		if d.Entries[i].Level != d.Entries[j].Level {
+			return d.Entries[i].Level > d.Entries[j].Level
+		}
+		return d.Entries[i].Count > d.Entries[j].Count
+	})
+}
+
+func (d *Digest) Title() string {
+	return fmt.Sprintf("[摘要] %s %s ~ %s 共 %d 条告警", d.Topic, formatTime(d.Start), formatTime(d.Stop), d.Total)
+}
+
+func (d *Digest) Content() string {
+	lines := make([]string, 0, len(d.Entries))
+	for _, e := range d.Entries {
+		line := fmt.Sprintf("[%s] %s x%d %s ~ %s", e.Level, e.Title, e.Count, formatTime(e.First), formatTime(e.Last))
+		if e.Worst != nil {
+			line += fmt.Sprintf(" 最差值: %v 阈值: [%v, %v]", *e.Worst, e.ThresholdLower, e.ThresholdUpper)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// render : render digest with digest template of receiver type in templates of the topic,
+// fall back to DefaultDigestTemplates
+func (d *Digest) render(templates map[string]Template, receiverType string) Message {
+	t, ok := templates[receiverType+DigestSuffix]
+	if !ok {
+		if t, ok = DefaultDigestTemplates[receiverType]; !ok {
+			return d
+		}
+	}
+	subject, body, err := t.render(d)
+	if err != nil {
+		logrus.Errorf("render digest of %s for %s failed: %s", d.Topic, receiverType, err.Error())
+		return d
+	}
+	return RenderedMessage{Subject: subject, Body: body}
+}
+
+// digester : accumulate Info and Warn messages of a subscribe and send digest every period
+type digester struct {
+	period  time.Duration
+	current *Digest
+	timer   *time.Timer
+}
+
+// SetDigest : period must be parsed by ParseDigest, pending digest is sent if digest is disabled
+func (s *Subscribe) SetDigest(period string, d time.Duration) {
+	s.rw.Lock()
+	s.Digest = period
+	s.UpdatedAt = time.Now()
+	if d > 0 {
+		if s.digest == nil {
+			s.digest = &digester{}
+		}
+		s.digest.period = d
+		s.rw.Unlock()
+		return
+	}
+	s.rw.Unlock()
+	s.FlushDigest()
+	s.rw.Lock()
+	s.digest = nil
+	s.rw.Unlock()
+}
+
+// digestible : Info and Warn messages are added to digest if enabled, must hold the lock
+func (s *Subscribe) digestible(message Message) bool {
+	if s.digest == nil {
+		return false
+	}
+	level := LabelsOf(message)[LevelLabel]
+	return level == InfoLevel.String() || level == WarnLevel.String()
+}
+
+// addDigest : must hold the lock
+func (s *Subscribe) addDigest(message Message) {
+	if s.digest.current == nil {
+		s.digest.current = newDigest(s.Topic)
+		s.digest.timer = time.AfterFunc(s.digest.period, s.FlushDigest)
+	}
+	s.digest.current.Add(message)
+}
+
+// FlushDigest : send pending digest immediately
+func (s *Subscribe) FlushDigest() {
+	s.rw.Lock()
+	if s.digest == nil || s.digest.current == nil {
+		s.rw.Unlock()
+		return
+	}
+	d := s.digest.current
+	s.digest.current = nil
+	s.digest.timer.Stop()
+	c := s.sendContext(s.Receiver)
+	s.rw.Unlock()
+	d.Stop = time.Now()
+	d.sorted()
+	if err := c.send(d); err != nil {
+		logrus.Errorf("send digest of %s failed: %s", c.topic, err.Error())
+	}
+}
+
+const digestSubject = `[摘要] {{.Topic}} 共 {{.Total}} 条告警`
+
+const digestMarkdown = `### [摘要] {{.Topic}} 共 {{.Total}} 条告警
+{{time .Start}} ~ {{time .Stop}}
+{{range .Entries}}
+- [{{.Level}}] {{if .TaskId}}任务 {{.TaskId}} {{.SensorMac}} {{.SensorType}}{{else}}{{.Title}}{{end}} **x{{.Count}}** {{time .First}} ~ {{time .Last}}
+{{- if .Worst}} 最差值 {{.Worst}} 阈值 [{{.ThresholdLower}}, {{.ThresholdUpper}}]{{end}}
+{{- end}}`
+
+const digestHtml = `<h3>[摘要] {{.Topic}} 共 {{.Total}} 条告警</h3>
+<p>{{time .Start}} ~ {{time .Stop}}</p>
+<table border="1" cellspacing="0" cellpadding="4">
+<tr><th>等级</th><th>告警</th><th>次数</th><th>首次</th><th>最近</th><th>最差值</th><th>阈值</th></tr>
+{{- range .Entries}}
+<tr><td>{{.Level}}</td><td>{{if .TaskId}}任务 {{.TaskId}} {{.SensorMac}} {{.SensorType}}{{else}}{{.Title}}{{end}}</td><td>{{.Count}}</td>
+<td>{{time .First}}</td><td>{{time .Last}}</td><td>{{if .Worst}}{{.Worst}}{{end}}</td><td>{{if .Worst}}[{{.ThresholdLower}}, {{.ThresholdUpper}}]{{end}}</td></tr>
+{{- end}}
+</table>`
+
+// SampleDigest : used to validate and preview digest templates
+func SampleDigest() *Digest {
+	d := newDigest("sample")
+	p := SamplePayload()
+	p.Level = WarnLevel
+	d.Add(p)
+	p.Value = 36.1
+	d.Add(p)
+	d.Add(WithLabels(RenderedMessage{Subject: "sample message", Body: "sample"}, map[string]string{LevelLabel: InfoLevel.String()}))
+	d.Stop = time.Now()
+	d.sorted()
+	return d
+}
+
+// DigestSuffix : templates of receiver type with the suffix, for example dingTalk.digest, render digests
+const DigestSuffix = ".digest"
+
+// DefaultTemplate : default template of receiver type, or the default digest template if type ends with DigestSuffix
+func DefaultTemplate(templateType string) (Template, bool) {
+	if strings.HasSuffix(templateType, DigestSuffix) {
+		t, ok := DefaultDigestTemplates[strings.TrimSuffix(templateType, DigestSuffix)]
+		return t, ok
+	}
+	t, ok := DefaultTemplates[templateType]
+	return t, ok
+}
+
+// TemplateTypes : sorted types of templates, including digest templates
+func TemplateTypes() []string {
+	types := make([]string, 0, len(DefaultTemplates)+len(DefaultDigestTemplates))
+	for t := range DefaultTemplates {
+		types = append(types, t)
+	}
+	for t := range DefaultDigestTemplates {
+		types = append(types, t+DigestSuffix)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Preview : render template of type, digest templates render SampleDigest and the others render payload
+func (t Template) Preview(templateType string, p Payload) (Message, error) {
+	if !strings.HasSuffix(templateType, DigestSuffix) {
+		return t.Render(p)
+	}
+	subject, body, err := t.render(SampleDigest())
+	if err != nil {
+		return nil, err
+	}
+	return RenderedMessage{Subject: subject, Body: body}, nil
+}
+
+// ValidateTemplate : validate template of type by previewing the sample
+func ValidateTemplate(templateType string, t Template) error {
+	if t.Subject == "" || t.Body == "" {
+		return fmt.Errorf("subject and body of template could not be empty")
+	}
+	_, err := t.Preview(templateType, SamplePayload())
+	return err
+}
+
+// DefaultDigestTemplates : digest template of each receiver type, fields are the same as Digest
+var DefaultDigestTemplates = map[string]Template{
+	EmailType:    {Subject: digestSubject, Body: digestHtml, Html: true},
+	DingTalkType: {Subject: digestSubject, Body: digestMarkdown},
+	WeComType:    {Subject: digestSubject, Body: digestMarkdown},
+	FeishuType:   {Subject: digestSubject, Body: digestMarkdown},
+	WebhookType:  {Subject: digestSubject, Body: jsonBody},
+}
@@ -0,0 +1,82 @@
+package alert
+
+import (
+	"github.com/go-playground/assert/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDigest(t *testing.T) {
+	r := &failReceiver{BaseApi: BaseApi{Type: DingTalkType, Address: "digest"}}
+	sub := &Subscribe{Topic: "topic", Receiver: []Receiver{r}}
+	d, err := ParseDigest("1h")
+	assert.Equal(t, err, nil)
+	sub.SetDigest("1h", d)
+
+	p := Payload{TaskId: "1", SensorMac: "a", Level: WarnLevel, Value: 31, ThresholdUpper: 30}
+	assert.Equal(t, sub.Send(p), nil)
+	p.Value = 35
+	assert.Equal(t, sub.Send(p), nil)
+	p.Value = 32
+	assert.Equal(t, sub.Send(p), nil)
+	assert.Equal(t, sub.Send(WithLabels(testMessage("plain"), map[string]string{LevelLabel: "Info"})), nil)
+	// alert level and messages without level are sent immediately
+	p.Level = AlertLevel
+	assert.Equal(t, sub.Send(p), nil)
+	assert.Equal(t, sub.Send(testMessage("no level")), nil)
+	assert.Equal(t, r.calls, 2)
+
+	digest := sub.digest.current
+	assert.Equal(t, digest.Total, 4)
+	assert.Equal(t, len(digest.Entries), 2)
+	assert.Equal(t, digest.Entries[0].Count, 3)
+	assert.Equal(t, *digest.Entries[0].Worst, 35.0)
+
+	digest.Stop = time.Now()
+	m := digest.render(nil, DingTalkType)
+	assert.Equal(t, strings.Contains(m.Content(), "x3"), true)
+	assert.Equal(t, strings.Contains(m.Content(), "最差值 35"), true)
+	assert.Equal(t, digest.render(nil, EmailType).Title(), "[摘要] topic 共 4 条告警")
+
+	// digest template of the topic, templates of messages are not used by digests
+	templates := map[string]Template{
+		DingTalkType:                {Subject: "alert", Body: "alert"},
+		DingTalkType + DigestSuffix: {Subject: "{{.Topic}} 摘要", Body: "{{range .Entries}}{{.Count}};{{end}}"},
+	}
+	m = render("topic", templates, DingTalkType, digest)
+	assert.Equal(t, m.Title(), "topic 摘要")
+	assert.Equal(t, m.Content(), "3;1;")
+	assert.Equal(t, render("topic", templates, EmailType, digest).Title(), "[摘要] topic 共 4 条告警")
+	// invalid digest template falls back to the digest itself
+	templates[DingTalkType+DigestSuffix] = Template{Subject: "{{.Missing}}", Body: "body"}
+	assert.Equal(t, render("topic", templates, DingTalkType, digest), Message(digest))
+
+	sub.FlushDigest()
+	assert.Equal(t, r.calls, 3)
+	assert.Equal(t, sub.digest.current == nil, true)
+}
+
+func TestDigestTemplate(t *testing.T) {
+	tpl, ok := DefaultTemplate(WeComType + DigestSuffix)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, tpl, DefaultDigestTemplates[WeComType])
+	_, ok = DefaultTemplate(OnCallType + DigestSuffix)
+	assert.Equal(t, ok, false)
+	types := TemplateTypes()
+	assert.Equal(t, len(types), len(DefaultTemplates)+len(DefaultDigestTemplates))
+	assert.Equal(t, types[0], DingTalkType)
+	assert.Equal(t, types[1], DingTalkType+DigestSuffix)
+
+	// digest templates are validated with the sample digest, not the payload
+	digestTpl := Template{Subject: "{{.Topic}}", Body: "{{.Total}}"}
+	assert.Equal(t, ValidateTemplate(EmailType+DigestSuffix, digestTpl), nil)
+	assert.NotEqual(t, ValidateTemplate(EmailType, digestTpl), nil)
+	m, err := digestTpl.Preview(EmailType+DigestSuffix, SamplePayload())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, m.Title(), "sample")
+	assert.Equal(t, m.Content(), "3")
+	for typ, tpl := range DefaultDigestTemplates {
+		assert.Equal(t, ValidateTemplate(typ+DigestSuffix, tpl), nil)
+	}
+}
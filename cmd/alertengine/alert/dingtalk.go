@@ -1,18 +1,225 @@
 package alert
 
 import (
-	"github.com/blinkbean/dingtalk"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const dingTalkWebhook = "https://oapi.dingtalk.com/robot/send?access_token=%s"
+
+// DingTalk : 钉钉群机器人
+// Address     access token of robot or the whole webhook url
+// Token       secret of signature (加签), no signature if empty
+// Keyword     keyword of robot (自定义关键词), added to messages which do not contain it
+// ActionCard  send alerts as ActionCard with buttons to acknowledge, silence and open the task
+// Mention     @ members by level of alert
 type DingTalk struct {
 	BaseApi
 }
 
+// Mention : members mentioned by dingTalk robot. Resolved alerts do not mention anyone
+type Mention struct {
+	Mobiles  []string `json:"mobiles"`
+	Level    Level    `json:"level"`              // mobiles are mentioned if level of alert is not lower
+	AllLevel *Level   `json:"allLevel,omitempty"` // @all if level of alert is not lower, never if absent
+}
+
+func (m *Mention) Validate() error {
+	if err := m.Level.Validate(); err != nil {
+		return err
+	}
+	if m.AllLevel != nil {
+		return m.AllLevel.Validate()
+	}
+	return nil
+}
+
+// at : mobiles to mention and whether to @all
+func (m *Mention) at(level Level) ([]string, bool) {
+	if m == nil {
+		return nil, false
+	}
+	all := m.AllLevel != nil && level >= *m.AllLevel
+	if all || level < m.Level {
+		return nil, all
+	}
+	return m.Mobiles, false
+}
+
 func (d DingTalk) Id() string {
-	return d.Address
+	return ReceiverId(DingTalkType, d.Address)
+}
+
+func (d DingTalk) url() string {
+	if strings.HasPrefix(d.Address, "http://") || strings.HasPrefix(d.Address, "https://") {
+		return d.Address
+	}
+	return fmt.Sprintf(dingTalkWebhook, url.QueryEscape(d.Address))
+}
+
+// signedUrl : timestamp in milliseconds and sign are added to query if secret is set
+func (d DingTalk) signedUrl() (string, error) {
+	u, err := url.Parse(d.url())
+	if err != nil {
+		return "", err
+	}
+	if d.Token != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		q := u.Query()
+		q.Set("timestamp", timestamp)
+		q.Set("sign", dingTalkSign(d.Token, timestamp))
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), nil
+}
+
+func (d DingTalk) Validate() error {
+	if d.Address == "" {
+		return fmt.Errorf("access token could not be empty")
+	}
+	if d.Mention != nil {
+		if err := d.Mention.Validate(); err != nil {
+			return err
+		}
+	}
+	return validateUrl(d.url())
 }
 
 func (d DingTalk) Message(message Message) error {
-	robot := dingtalk.InitDingTalkWithSecret(d.Address, d.Token)
-	return robot.SendMarkDownMessage(message.Title(), message.Content())
+	title, text := d.withKeyword(message.Title(), message.Content())
+	var payload Payload
+	structured, isStructured := message.(Structured)
+	if isStructured {
+		payload = structured.Data()
+	}
+	level, ok := messageLevel(message)
+	var mobiles []string
+	var all bool
+	if ok && !payload.Resolved() {
+		mobiles, all = d.Mention.at(level)
+	}
+	if d.ActionCard && isStructured {
+		if buttons := dingTalkButtons(payload); len(buttons) > 0 {
+			err := d.send(map[string]interface{}{
+				"msgtype": "actionCard",
+				"actionCard": map[string]interface{}{
+					"title":          title,
+					"text":           text,
+					"btnOrientation": "1",
+					"btns":           buttons,
+				},
+			})
+			if err != nil || (len(mobiles) == 0 && !all) {
+				return err
+			}
+			// ActionCard could not mention members, so they are mentioned by a following text message.
+			// The card is delivered already, so failure of mention is only logged, otherwise the card is resent by retry
+			err = d.send(map[string]interface{}{
+				"msgtype": "text",
+				"text":    map[string]string{"content": d.mentionText(title, mobiles, all)},
+				"at":      map[string]interface{}{"atMobiles": mobiles, "isAtAll": all},
+			})
+			if err != nil {
+				logrus.Warnf("mention of dingTalk %s failed: %s", d.String(), err.Error())
+			}
+			return nil
+		}
+	}
+	// mobiles must be in the text of markdown to be mentioned
+	for _, m := range mobiles {
+		text += " @" + m
+	}
+	return d.send(map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": title, "text": text},
+		"at":       map[string]interface{}{"atMobiles": mobiles, "isAtAll": all},
+	})
+}
+
+func (d DingTalk) send(payload map[string]interface{}) error {
+	address, err := d.signedUrl()
+	if err != nil {
+		return err
+	}
+	body, err := postJson(address, payload)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("dingTalk robot error %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// withKeyword : messages without the keyword are rejected by robot, so it is added to the title and text
+func (d DingTalk) withKeyword(title, text string) (string, string) {
+	if d.Keyword == "" || strings.Contains(text, d.Keyword) {
+		return title, text
+	}
+	return fmt.Sprintf("[%s] %s", d.Keyword, title), fmt.Sprintf("%s\n\n%s", d.Keyword, text)
+}
+
+func (d DingTalk) mentionText(title string, mobiles []string, all bool) string {
+	text := title
+	if d.Keyword != "" && !strings.Contains(text, d.Keyword) {
+		text = fmt.Sprintf("[%s] %s", d.Keyword, text)
+	}
+	for _, m := range mobiles {
+		text += " @" + m
+	}
+	if all {
+		text += " @所有人"
+	}
+	return text
+}
+
+// dingTalkButtons : acknowledge and silence buttons are only shown for firing alerts
+func dingTalkButtons(p Payload) []map[string]string {
+	var buttons []map[string]string
+	add := func(title, link string) {
+		if link != "" {
+			buttons = append(buttons, map[string]string{"title": title, "actionURL": link})
+		}
+	}
+	if !p.Resolved() {
+		add("确认告警", p.AckLink)
+		add(fmt.Sprintf("静默%s", formatSilence(SilenceDuration)), p.SilenceLink)
+	}
+	add("查看任务", p.Link)
+	return buttons
+}
+
+// messageLevel : level of payload, or level label of plain message
+func messageLevel(message Message) (Level, bool) {
+	if s, ok := message.(Structured); ok {
+		return s.Data().Level, true
+	}
+	if v, ok := LabelsOf(message)[LevelLabel]; ok {
+		if level, err := ParseLevel(v); err == nil {
+			return level, true
+		}
+	}
+	return InfoLevel, false
+}
+
+// dingTalkSign : base64 of HMAC-SHA256 of "timestamp\nsecret" with the secret as key
+func dingTalkSign(secret, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
 }
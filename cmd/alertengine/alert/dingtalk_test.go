@@ -0,0 +1,89 @@
+package alert
+
+import (
+	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDingTalk(t *testing.T) {
+	var mu sync.Mutex
+	var queries []map[string]string
+	var bodies []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var m map[string]interface{}
+		_ = json.Unmarshal(body, &m)
+		q := r.URL.Query()
+		mu.Lock()
+		queries = append(queries, map[string]string{"access_token": q.Get("access_token"), "sign": q.Get("sign")})
+		bodies = append(bodies, m)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"errcode": 0, "errmsg": "ok"}`))
+	}))
+	defer srv.Close()
+
+	warn := WarnLevel
+	d := DingTalk{BaseApi{Type: DingTalkType, Address: srv.URL + "/robot/send?access_token=abc", Token: "secret", Options: Options{
+		Keyword:    "告警",
+		ActionCard: true,
+		Mention:    &Mention{Mobiles: []string{"13800000000"}, Level: InfoLevel, AllLevel: &warn},
+	}}}
+	assert.Equal(t, d.Validate(), nil)
+
+	p := SamplePayload()
+	p.Level, p.AckLink, p.SilenceLink = InfoLevel, "http://alert/ack", "http://alert/silence"
+	assert.Equal(t, d.Message(render("topic", nil, DingTalkType, p)), nil)
+	mu.Lock()
+	assert.Equal(t, len(bodies), 2)
+	assert.Equal(t, queries[0]["access_token"], "abc")
+	assert.NotEqual(t, queries[0]["sign"], "")
+	card := bodies[0]["actionCard"].(map[string]interface{})
+	assert.Equal(t, len(card["btns"].([]interface{})), 3)
+	// mobiles are mentioned by a text message after the card
+	assert.Equal(t, bodies[1]["msgtype"], "text")
+	assert.Equal(t, bodies[1]["at"].(map[string]interface{})["isAtAll"], false)
+	assert.Equal(t, strings.Contains(bodies[1]["text"].(map[string]interface{})["content"].(string), "@13800000000"), true)
+	bodies = nil
+	mu.Unlock()
+
+	// @all for high level, resolved alert has only the task button and mentions nobody
+	p.Level = AlertLevel
+	d.ActionCard = false
+	assert.Equal(t, d.Message(p), nil)
+	p.State = "resolved"
+	d.ActionCard = true
+	assert.Equal(t, d.Message(p), nil)
+	mu.Lock()
+	assert.Equal(t, len(bodies), 2)
+	assert.Equal(t, bodies[0]["msgtype"], "markdown")
+	assert.Equal(t, bodies[0]["at"].(map[string]interface{})["isAtAll"], true)
+	assert.Equal(t, len(bodies[1]["actionCard"].(map[string]interface{})["btns"].([]interface{})), 1)
+	mu.Unlock()
+
+	// card is delivered even if the following mention fails, so it is not retried
+	failMention := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(body), `"msgtype":"text"`) {
+			_, _ = w.Write([]byte(`{"errcode": 310000, "errmsg": "keywords not in content"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errcode": 0, "errmsg": "ok"}`))
+	}))
+	defer failMention.Close()
+	mentioned := d
+	mentioned.Address = failMention.URL
+	p.State, p.Level = "", InfoLevel
+	assert.Equal(t, mentioned.Message(p), nil)
+
+	// keyword is added to plain messages without it
+	title, text := d.withKeyword("hello", "world")
+	assert.Equal(t, title, "[告警] hello")
+	assert.Equal(t, text, "告警\n\nworld")
+	assert.Equal(t, dingTalkSign("secret", "1600000000000"), "XHSnLTbboLLBCrXfAQRHx6W9LkLB43RYwgcsOS2j3vs=")
+}
@@ -0,0 +1,232 @@
+package alert
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Tier : receivers of an escalation tier, the next tier is notified if the alert
+// has not been acknowledged within Timeout. Timeout of the last tier is ignored
+type Tier struct {
+	Timeout   string    `json:"timeout"` // duration, for example 15m
+	Receivers []BaseApi `json:"receivers"`
+	timeout   time.Duration
+	receivers []Receiver
+}
+
+// EscalationPolicy : ordered tiers attached to topic
+type EscalationPolicy struct {
+	Topic string `json:"topic"`
+	Tiers []Tier `json:"tiers"`
+}
+
+// Validate : validate tiers and create receivers
+func (p *EscalationPolicy) Validate() error {
+	if p.Topic == "" {
+		return fmt.Errorf("topic could not be empty")
+	}
+	if len(p.Tiers) == 0 {
+		return fmt.Errorf("must provide at least one tier")
+	}
+	for i := range p.Tiers {
+		t := &p.Tiers[i]
+		if len(t.Receivers) == 0 {
+			return fmt.Errorf("tier %d: must provide at least one receiver", i)
+		}
+		if i < len(p.Tiers)-1 {
+			d, err := time.ParseDuration(t.Timeout)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("tier %d: timeout must be positive duration", i)
+			}
+			t.timeout = d
+		}
+		t.receivers = t.receivers[:0]
+		for _, api := range t.Receivers {
+			r, err := NewReceiver(api)
+			if err != nil {
+				return fmt.Errorf("tier %d: %s", i, err.Error())
+			}
+			t.receivers = append(t.receivers, r)
+		}
+	}
+	return nil
+}
+
+// NotifyFunc : deliver message to receivers of topic
+type NotifyFunc func(topic string, receivers []Receiver, message Message)
+
+// Escalation : state of an escalating alert
+type Escalation struct {
+	Topic    string    `json:"topic"`
+	Id       string    `json:"id"`
+	Tier     int       `json:"tier"` // index of the last notified tier
+	Started  time.Time `json:"started"`
+	Notified time.Time `json:"notified"`
+	message  Message
+	timer    *time.Timer
+}
+
+// Escalator : notify tiers of escalation policy one by one until acknowledged or resolved
+type Escalator struct {
+	policies map[string]*EscalationPolicy
+	active   map[string]*Escalation
+	notify   NotifyFunc
+	rw       sync.RWMutex
+}
+
+func NewEscalator(notify NotifyFunc) *Escalator {
+	return &Escalator{
+		policies: make(map[string]*EscalationPolicy),
+		active:   make(map[string]*Escalation),
+		notify:   notify,
+	}
+}
+
+// SetPolicy : policy must be validated
+func (e *Escalator) SetPolicy(p *EscalationPolicy) {
+	e.rw.Lock()
+	defer e.rw.Unlock()
+	e.policies[p.Topic] = p
+}
+
+// DeletePolicy : delete policy and stop escalations of topic
+func (e *Escalator) DeletePolicy(topic string) bool {
+	e.rw.Lock()
+	defer e.rw.Unlock()
+	if _, ok := e.policies[topic]; !ok {
+		return false
+	}
+	delete(e.policies, topic)
+	for key, esc := range e.active {
+		if esc.Topic == topic {
+			if esc.timer != nil {
+				esc.timer.Stop()
+			}
+			delete(e.active, key)
+		}
+	}
+	return true
+}
+
+// Policies : list policies of topic, all topics if topic is empty
+func (e *Escalator) Policies(topic string) []EscalationPolicy {
+	e.rw.RLock()
+	defer e.rw.RUnlock()
+	res := make([]EscalationPolicy, 0)
+	for _, p := range e.policies {
+		if topic == "" || p.Topic == topic {
+			res = append(res, *p)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Topic < res[j].Topic
+	})
+	return res
+}
+
+// Start : notify the first tier if topic has policy, only update the message if already escalating
+func (e *Escalator) Start(topic, id string, message Message) {
+	e.rw.Lock()
+	defer e.rw.Unlock()
+	p, ok := e.policies[topic]
+	if !ok {
+		return
+	}
+	key := trackerKey(topic, id)
+	if esc, ok := e.active[key]; ok {
+		esc.message = message
+		return
+	}
+	esc := &Escalation{
+		Topic:   topic,
+		Id:      id,
+		Tier:    -1,
+		Started: time.Now(),
+		message: message,
+	}
+	e.active[key] = esc
+	e.escalate(key, esc, p)
+}
+
+// Update : refresh message of escalating alert, which is used by the following tiers
+func (e *Escalator) Update(topic, id string, message Message) {
+	e.rw.Lock()
+	defer e.rw.Unlock()
+	if esc, ok := e.active[trackerKey(topic, id)]; ok {
+		esc.message = message
+	}
+}
+
+// Stop : stop escalation when acknowledged or resolved, return false if not escalating
+func (e *Escalator) Stop(topic, id string) bool {
+	e.rw.Lock()
+	defer e.rw.Unlock()
+	key := trackerKey(topic, id)
+	esc, ok := e.active[key]
+	if !ok {
+		return false
+	}
+	if esc.timer != nil {
+		esc.timer.Stop()
+	}
+	delete(e.active, key)
+	return true
+}
+
+// Escalations : list escalating alerts of topic, all topics if topic is empty
+func (e *Escalator) Escalations(topic string) []Escalation {
+	e.rw.RLock()
+	defer e.rw.RUnlock()
+	res := make([]Escalation, 0)
+	for _, esc := range e.active {
+		if topic == "" || esc.Topic == topic {
+			res = append(res, *esc)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Started.Before(res[j].Started)
+	})
+	return res
+}
+
+// Close : stop all timers
+func (e *Escalator) Close() {
+	e.rw.Lock()
+	defer e.rw.Unlock()
+	for _, esc := range e.active {
+		if esc.timer != nil {
+			esc.timer.Stop()
+		}
+	}
+}
+
+// escalate : notify the next tier and schedule the one after it, must hold the lock
+func (e *Escalator) escalate(key string, esc *Escalation, p *EscalationPolicy) {
+	esc.Tier++
+	esc.Notified = time.Now()
+	tier := p.Tiers[esc.Tier]
+	go e.notify(esc.Topic, tier.receivers, esc.message)
+	if esc.Tier >= len(p.Tiers)-1 {
+		esc.timer = nil
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(tier.timeout, func() {
+		e.rw.Lock()
+		defer e.rw.Unlock()
+		cur, ok := e.active[key]
+		if !ok || cur.timer != timer {
+			return
+		}
+		// policy may be updated, stop if there is no more tier
+		policy, ok := e.policies[esc.Topic]
+		if !ok || esc.Tier >= len(policy.Tiers)-1 {
+			cur.timer = nil
+			return
+		}
+		e.escalate(key, cur, policy)
+	})
+	esc.timer = timer
+}
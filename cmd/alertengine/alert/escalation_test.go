@@ -0,0 +1,56 @@
+package alert
+
+import (
+	"github.com/go-playground/assert/v2"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEscalator(t *testing.T) {
+	var mu sync.Mutex
+	var notified []string
+	e := NewEscalator(func(topic string, receivers []Receiver, message Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, r := range receivers {
+			notified = append(notified, r.Id())
+		}
+	})
+	tier := func(address string, timeout time.Duration) Tier {
+		return Tier{timeout: timeout, receivers: []Receiver{&failReceiver{BaseApi: BaseApi{Address: address}}}}
+	}
+	e.SetPolicy(&EscalationPolicy{Topic: "topic", Tiers: []Tier{
+		tier("first", 30*time.Millisecond),
+		tier("second", 30*time.Millisecond),
+		tier("third", 0),
+	}})
+
+	e.Start("topic", "1", testMessage("a"))
+	e.Start("other", "1", testMessage("a")) // no policy
+	time.Sleep(45 * time.Millisecond)
+	assert.Equal(t, len(e.Escalations("")), 1)
+	assert.Equal(t, e.Escalations("topic")[0].Tier, 1)
+	// acknowledged before the third tier
+	assert.Equal(t, e.Stop("topic", "1"), true)
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, notified, []string{"first", "second"})
+	mu.Unlock()
+	assert.Equal(t, e.Stop("topic", "1"), false)
+}
+
+func TestAckSigner(t *testing.T) {
+	signer := AckSigner{Secret: "secret", BaseUrl: "http://localhost:5050", Expire: time.Hour}
+	link, err := url.Parse(signer.Link("/api/alert/ack", AckAction, "topic", "1"))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, signer.Verify(AckAction, link.Query()), nil)
+	// link of an action could not be used for others
+	assert.NotEqual(t, signer.Verify(SilenceAction, link.Query()), nil)
+
+	q := link.Query()
+	q.Set("id", "2")
+	assert.NotEqual(t, signer.Verify(AckAction, q), nil)
+	assert.Equal(t, AckSigner{}.Link("/api/alert/ack", AckAction, "topic", "1"), "")
+}
@@ -0,0 +1,83 @@
+package alert
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const feishuWebhook = "https://open.feishu.cn/open-apis/bot/v2/hook/%s"
+
+// Feishu : 飞书/Lark 群机器人
+// Address  token of robot or the whole webhook url
+// Token    secret of signature verification, no signature if empty
+type Feishu struct {
+	BaseApi
+}
+
+func (f Feishu) Id() string {
+	return ReceiverId(FeishuType, f.Address)
+}
+
+func (f Feishu) url() string {
+	if strings.HasPrefix(f.Address, "http://") || strings.HasPrefix(f.Address, "https://") {
+		return f.Address
+	}
+	return fmt.Sprintf(feishuWebhook, f.Address)
+}
+
+func (f Feishu) Validate() error {
+	if f.Address == "" {
+		return fmt.Errorf("address could not be empty")
+	}
+	return validateUrl(f.url())
+}
+
+func (f Feishu) Message(message Message) error {
+	var lines [][]map[string]string
+	for _, line := range strings.Split(message.Content(), "\n") {
+		lines = append(lines, []map[string]string{{"tag": "text", "text": line}})
+	}
+	payload := map[string]interface{}{
+		"msg_type": "post",
+		"content": map[string]interface{}{
+			"post": map[string]interface{}{
+				"zh_cn": map[string]interface{}{
+					"title":   message.Title(),
+					"content": lines,
+				},
+			},
+		},
+	}
+	if f.Token != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		payload["timestamp"] = timestamp
+		payload["sign"] = feishuSign(f.Token, timestamp)
+	}
+	body, err := postJson(f.url(), payload)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	if result.Code != 0 {
+		return fmt.Errorf("feishu robot error %d: %s", result.Code, result.Msg)
+	}
+	return nil
+}
+
+// feishuSign : the key of HMAC-SHA256 is "timestamp\nsecret" and the content is empty
+func feishuSign(secret, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
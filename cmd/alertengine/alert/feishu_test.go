@@ -0,0 +1,56 @@
+package alert
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFeishu(t *testing.T) {
+	var path string
+	var m map[string]interface{}
+	result := `{"code": 0, "msg": "success"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		m = nil
+		_ = json.NewDecoder(r.Body).Decode(&m)
+		_, _ = w.Write([]byte(result))
+	}))
+	defer srv.Close()
+
+	f := Feishu{BaseApi{Type: FeishuType, Address: srv.URL + "/open-apis/bot/v2/hook/abc", Token: "secret"}}
+	assert.Equal(t, f.Validate(), nil)
+	assert.Equal(t, f.Message(RenderedMessage{Subject: "告警", Body: "第一行\n第二行"}), nil)
+	assert.Equal(t, path, "/open-apis/bot/v2/hook/abc")
+	assert.Equal(t, m["msg_type"], "post")
+	post := m["content"].(map[string]interface{})["post"].(map[string]interface{})["zh_cn"].(map[string]interface{})
+	assert.Equal(t, post["title"], "告警")
+	lines := post["content"].([]interface{})
+	assert.Equal(t, len(lines), 2)
+	assert.Equal(t, lines[1].([]interface{})[0], map[string]interface{}{"tag": "text", "text": "第二行"})
+
+	// key of HMAC-SHA256 is "timestamp\nsecret", the content is empty
+	timestamp := m["timestamp"].(string)
+	mac := hmac.New(sha256.New, []byte(timestamp+"\nsecret"))
+	assert.Equal(t, m["sign"], base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	assert.Equal(t, feishuSign("secret", timestamp), m["sign"])
+
+	f.Token = ""
+	assert.Equal(t, f.Message(RenderedMessage{Subject: "告警", Body: "内容"}), nil)
+	_, signed := m["sign"]
+	assert.Equal(t, signed, false)
+
+	// token of address without url
+	assert.Equal(t, Feishu{BaseApi{Type: FeishuType, Address: "abc"}}.url(), "https://open.feishu.cn/open-apis/bot/v2/hook/abc")
+
+	result = `{"code": 19021, "msg": "sign match fail"}`
+	err := f.Message(RenderedMessage{Subject: "告警", Body: "内容"})
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, strings.Contains(err.Error(), "19021"), true)
+}
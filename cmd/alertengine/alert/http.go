@@ -0,0 +1,89 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// NewReceiver : create receiver by type and validate its api
+func NewReceiver(api BaseApi) (Receiver, error) {
+	var r Receiver
+	switch api.Type {
+	case EmailType:
+		r = Mail{BaseApi: api}
+	case DingTalkType:
+		r = DingTalk{BaseApi: api}
+	case WebhookType:
+		r = Webhook{BaseApi: api}
+	case WeComType:
+		r = WeCom{BaseApi: api}
+	case FeishuType:
+		r = Feishu{BaseApi: api}
+	case OnCallType:
+		r = OnCall{BaseApi: api}
+	case BrowserType:
+		r = Browser{BaseApi: api}
+	default:
+		return nil, fmt.Errorf("type %s not match", api.Type)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid receiver %s: %s", api, scrubError(err, api).Error())
+	}
+	if api.Throttle != nil {
+		if err := api.Throttle.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid throttle of receiver %s: %s", api, err.Error())
+		}
+	}
+	return r, nil
+}
+
+func validateUrl(address string) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("address must be http(s) url")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("address host could not be empty")
+	}
+	return nil
+}
+
+// doRequest : send request and return response body, non 2xx status code is treated as error
+func doRequest(req *http.Request) ([]byte, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, scrubError(err, BaseApi{})
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return body, fmt.Errorf("request failed with code %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
+func postJson(address string, payload interface{}) ([]byte, error) {
+	content, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, address, bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doRequest(req)
+}
@@ -0,0 +1,142 @@
+package alert
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// InhibitRule : while an alert matching SourceMatchers is firing, alerts matching TargetMatchers with the same
+// values of Equal labels are suppressed. Absent label is treated as empty string.
+// For example source {sensor_type="gateway"}, target {sensor_type!="gateway"}, equal [project, location]
+type InhibitRule struct {
+	Name           string    `json:"name"` // unique
+	SourceMatchers []Matcher `json:"source_matchers"`
+	TargetMatchers []Matcher `json:"target_matchers"`
+	Equal          []string  `json:"equal"`
+}
+
+// ValidateInhibitRules : validate rules and compile matchers
+func ValidateInhibitRules(rules []*InhibitRule) error {
+	names := make(map[string]bool)
+	for _, r := range rules {
+		if r == nil {
+			return fmt.Errorf("inhibit rule could not be null")
+		}
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		if names[r.Name] {
+			return fmt.Errorf("inhibit rule %s already existed", r.Name)
+		}
+		names[r.Name] = true
+	}
+	return nil
+}
+
+func (r *InhibitRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name of inhibit rule could not be empty")
+	}
+	if len(r.SourceMatchers) == 0 || len(r.TargetMatchers) == 0 {
+		return fmt.Errorf("inhibit rule %s: source and target matchers could not be empty", r.Name)
+	}
+	for _, ms := range [][]Matcher{r.SourceMatchers, r.TargetMatchers} {
+		for i := range ms {
+			if err := ms[i].Validate(); err != nil {
+				return fmt.Errorf("inhibit rule %s: %s", r.Name, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func matchAll(matchers []Matcher, labels map[string]string) bool {
+	for i := range matchers {
+		if !matchers[i].Match(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// inhibits : whether source inhibits target. An alert matching both sides could not inhibit another alert
+// matching both sides, so that alerts of the same kind do not inhibit each other
+func (r *InhibitRule) inhibits(source, target map[string]string) bool {
+	if !matchAll(r.TargetMatchers, target) || !matchAll(r.SourceMatchers, source) {
+		return false
+	}
+	for _, l := range r.Equal {
+		if source[l] != target[l] {
+			return false
+		}
+	}
+	if matchAll(r.SourceMatchers, target) && matchAll(r.TargetMatchers, source) {
+		return false
+	}
+	return true
+}
+
+// Inhibition : target alert suppressed by a firing source alert
+type Inhibition struct {
+	Rule   string            `json:"rule"`
+	Topic  string            `json:"topic"` // topic of source alert
+	Id     string            `json:"id"`    // id of source alert
+	Labels map[string]string `json:"labels"`
+}
+
+// Inhibitor : check alerts against firing alerts, only alerts with id are tracked as firing
+type Inhibitor struct {
+	rules  []*InhibitRule
+	firing func(topic string) []ActiveAlert
+	rw     sync.RWMutex
+}
+
+// NewInhibitor : firing lists active alerts of topic, all topics if topic is empty, such as Tracker.Active
+func NewInhibitor(firing func(topic string) []ActiveAlert) *Inhibitor {
+	return &Inhibitor{firing: firing}
+}
+
+// SetRules : rules must be validated
+func (i *Inhibitor) SetRules(rules []*InhibitRule) {
+	i.rw.Lock()
+	defer i.rw.Unlock()
+	i.rules = rules
+}
+
+func (i *Inhibitor) Rules() []*InhibitRule {
+	i.rw.RLock()
+	defer i.rw.RUnlock()
+	res := make([]*InhibitRule, len(i.rules))
+	copy(res, i.rules)
+	return res
+}
+
+// Inhibited : the first firing alert inhibiting alert of labels. The alert itself is skipped
+// since it is also firing when resent by tracker
+func (i *Inhibitor) Inhibited(labels map[string]string) (Inhibition, bool) {
+	rules := i.Rules()
+	if len(rules) == 0 {
+		return Inhibition{}, false
+	}
+	var candidates []*InhibitRule
+	for _, r := range rules {
+		if matchAll(r.TargetMatchers, labels) {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		return Inhibition{}, false
+	}
+	for _, a := range i.firing("") {
+		if reflect.DeepEqual(a.Labels, labels) {
+			continue
+		}
+		for _, r := range candidates {
+			if r.inhibits(a.Labels, labels) {
+				return Inhibition{Rule: r.Name, Topic: a.Topic, Id: a.Id, Labels: a.Labels}, true
+			}
+		}
+	}
+	return Inhibition{}, false
+}
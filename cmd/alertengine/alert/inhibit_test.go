@@ -0,0 +1,44 @@
+package alert
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+)
+
+func TestInhibitor(t *testing.T) {
+	gateway := map[string]string{ProjectLabel: "1", "location": "A", SensorTypeLabel: "gateway"}
+	var firing []ActiveAlert
+	inhibitor := NewInhibitor(func(topic string) []ActiveAlert {
+		return firing
+	})
+	rules := []*InhibitRule{{
+		Name:           "gateway offline",
+		SourceMatchers: []Matcher{{Label: SensorTypeLabel, Op: MatchEqual, Value: "gateway"}},
+		TargetMatchers: []Matcher{{Label: SensorTypeLabel, Op: MatchRegexp, Value: ".*"}},
+		Equal:          []string{ProjectLabel, "location"},
+	}}
+	assert.Equal(t, ValidateInhibitRules(rules), nil)
+	inhibitor.SetRules(rules)
+
+	sensor := map[string]string{ProjectLabel: "1", "location": "A", SensorTypeLabel: "temperature_air"}
+	_, ok := inhibitor.Inhibited(sensor)
+	assert.Equal(t, ok, false)
+
+	firing = []ActiveAlert{{Topic: "gw", Id: "1", Labels: gateway}}
+	inhibition, ok := inhibitor.Inhibited(sensor)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, inhibition.Rule, "gateway offline")
+	assert.Equal(t, inhibition.Id, "1")
+	// other location is not inhibited
+	other := map[string]string{ProjectLabel: "1", "location": "B", SensorTypeLabel: "temperature_air"}
+	_, ok = inhibitor.Inhibited(other)
+	assert.Equal(t, ok, false)
+	// the source alert itself and other gateways matching both sides are not inhibited
+	_, ok = inhibitor.Inhibited(gateway)
+	assert.Equal(t, ok, false)
+	_, ok = inhibitor.Inhibited(map[string]string{ProjectLabel: "1", "location": "A", SensorTypeLabel: "gateway", SensorMacLabel: "2"})
+	assert.Equal(t, ok, false)
+
+	assert.NotEqual(t, ValidateInhibitRules([]*InhibitRule{{Name: "empty"}}), nil)
+	assert.NotEqual(t, ValidateInhibitRules(append(rules, rules[0])), nil)
+}
@@ -3,20 +3,56 @@ package alert
 import (
 	"fmt"
 	gomail "gopkg.in/mail.v2"
+	"html"
+	"io"
+	"net/mail"
+	"regexp"
+	"strings"
 	"sync"
 )
 
-var client *gomail.Dialer
-var mailFrom string
+var mailPool *smtpPool
+var mailOptions SmtpOptions
 var once sync.Once
 
-func InitMail(host string, port int, account string, password string) {
+// InitMail : init the smtp connection pool used by email receivers
+func InitMail(opts SmtpOptions) (err error) {
 	once.Do(func() {
-		client = gomail.NewDialer(host, port, account, password)
-		mailFrom = account
+		if err = opts.Validate(); err != nil {
+			return
+		}
+		var d *gomail.Dialer
+		if d, err = opts.dialer(); err != nil {
+			return
+		}
+		mailOptions = opts
+		mailPool = newSmtpPool(d.Dial, opts.PoolSize, opts.KeepAlive)
 	})
+	return err
 }
 
+// CloseMail : close idle smtp connections
+func CloseMail() {
+	if mailPool != nil {
+		mailPool.Close()
+	}
+}
+
+// CheckMail : check connectivity of smtp server by a new connection, pooled connections are not affected
+func CheckMail() error {
+	if mailPool == nil {
+		return fmt.Errorf("mail client not init")
+	}
+	c, err := mailPool.dial()
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// ChartFileName : file name of the embedded chart
+const ChartFileName = "chart.png"
+
 type Mail struct {
 	BaseApi
 }
@@ -25,17 +61,78 @@ func (m Mail) Id() string {
 	return m.Address
 }
 
+func (m Mail) Validate() error {
+	if _, err := mail.ParseAddress(m.Address); err != nil {
+		return fmt.Errorf("invalid email address")
+	}
+	return nil
+}
+
 func (m Mail) Message(message Message) error {
-	if client == nil {
+	return SendMail([]string{m.Address}, message)
+}
+
+// SendMail : send message to recipients as one email
+func SendMail(to []string, message Message) error {
+	if mailPool == nil {
 		return fmt.Errorf("mail client not init")
 	}
+	from := mailOptions.from()
+	return mailPool.send(from, to, newMail(from, to, message))
+}
+
+// newMail : multipart email of plain text and html, the content of message is the html part.
+// Recipients of a batch are hidden, the header "To" is the sender
+func newMail(from string, to []string, message Message) *gomail.Message {
 	ms := gomail.NewMessage()
-	ms.SetHeader("From", mailFrom)
-	ms.SetHeader("To", m.Address)
+	ms.SetHeader("From", from)
+	if len(to) == 1 {
+		ms.SetHeader("To", to[0])
+	} else {
+		ms.SetHeader("To", from)
+	}
 	ms.SetHeader("Subject", message.Title())
-	ms.SetBody("text/html", message.Content())
-	if err := client.DialAndSend(ms); err != nil {
-		return err
+	ms.SetBody("text/plain", plainText(message))
+	ms.AddAlternative("text/html", message.Content())
+	// chart is referenced by html template as cid:chart.png
+	if s, ok := message.(Structured); ok && len(s.Data().Chart) > 0 {
+		chart := s.Data().Chart
+		ms.Embed(ChartFileName, gomail.SetCopyFunc(func(w io.Writer) error {
+			_, err := w.Write(chart)
+			return err
+		}))
 	}
-	return nil
+	return ms
+}
+
+var (
+	htmlBreakRegexp = regexp.MustCompile(`(?i)<br\s*/?>|</(p|tr|h[1-6]|div|li|table)>`)
+	htmlCellRegexp  = regexp.MustCompile(`(?i)</t[dh]>`)
+	htmlTagRegexp   = regexp.MustCompile(`<[^>]*>`)
+	blankRegexp     = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// plainText : plain text part of email, the payload is used if present, otherwise html tags are removed from content
+func plainText(message Message) string {
+	if s, ok := message.(Structured); ok {
+		if p := s.Data(); p.ProjectId != "" || p.TaskId != "" {
+			return p.Title() + "\n\n" + p.Content()
+		}
+	}
+	content := message.Content()
+	if !strings.Contains(content, "<") {
+		return content
+	}
+	content = htmlBreakRegexp.ReplaceAllString(content, "\n")
+	content = htmlCellRegexp.ReplaceAllString(content, " ")
+	content = html.UnescapeString(htmlTagRegexp.ReplaceAllString(content, ""))
+	return strings.TrimSpace(blankRegexp.ReplaceAllString(content, "\n\n"))
+}
+
+// mailBatchSize : max recipients of an email
+func mailBatchSize() int {
+	if mailOptions.Batch <= 0 {
+		return 1
+	}
+	return mailOptions.Batch
 }
@@ -0,0 +1,65 @@
+package alert
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Attempt : result of a single delivery attempt
+type Attempt struct {
+	Topic        string
+	ReceiverId   string // Receiver.Id, secret addresses are hashed
+	ReceiverType string
+	MessageHash  string
+	Attempt      int // 1 for the first attempt
+	Time         time.Time
+	Latency      time.Duration
+	Error        error
+}
+
+// Observer : called after every delivery attempt, should not block
+type Observer func(a Attempt)
+
+var observers []Observer
+var observerLock sync.RWMutex
+
+// AddObserver : observe all delivery attempts, for example audit log and metrics
+func AddObserver(o Observer) {
+	observerLock.Lock()
+	defer observerLock.Unlock()
+	observers = append(observers, o)
+}
+
+// MessageHash : sha256 of title and content
+func MessageHash(message Message) string {
+	sum := sha256.Sum256([]byte(message.Title() + "\n" + message.Content()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Deliver : send message to receiver and notify observers, secrets of receiver are scrubbed from the error
+func Deliver(topic string, r Receiver, message Message, attempt int) error {
+	start := time.Now()
+	err := scrubError(r.Message(message), r.Api())
+	observe(topic, r, message, attempt, start, err)
+	return err
+}
+
+func observe(topic string, r Receiver, message Message, attempt int, start time.Time, err error) {
+	a := Attempt{
+		Topic:        topic,
+		ReceiverId:   r.Id(),
+		ReceiverType: r.Api().Type,
+		MessageHash:  MessageHash(message),
+		Attempt:      attempt,
+		Time:         start,
+		Latency:      time.Since(start),
+		Error:        err,
+	}
+	observerLock.RLock()
+	defer observerLock.RUnlock()
+	for _, o := range observers {
+		o(a)
+	}
+}
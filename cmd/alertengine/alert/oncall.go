@@ -0,0 +1,343 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OnCallType : receiver resolved to contacts of the user on call of a schedule at send time, address is the schedule name
+const OnCallType = "oncall"
+
+const defaultRotationPeriod = 7 * 24 * time.Hour
+
+// Rotation : users take turns in order, the first user is on call from start, handoff happens every period
+// at the same time of start, weekly by default
+type Rotation struct {
+	Users  []string  `json:"users"`
+	Start  time.Time `json:"start"`
+	Period string    `json:"period"` // duration, such as 24h for daily rotation, default 168h
+	period time.Duration
+}
+
+func (r *Rotation) Validate() error {
+	if len(r.Users) == 0 {
+		return errors.New("users of rotation could not be empty")
+	}
+	if r.Start.IsZero() {
+		return errors.New("start of rotation could not be empty")
+	}
+	r.period = defaultRotationPeriod
+	if r.Period != "" {
+		d, err := time.ParseDuration(r.Period)
+		if err != nil || d < time.Hour {
+			return fmt.Errorf("invalid rotation period, at least 1h")
+		}
+		r.period = d
+	}
+	return nil
+}
+
+// shift : index of the shift at t, negative before start
+func (r *Rotation) shift(t time.Time) int64 {
+	k := int64(t.Sub(r.Start) / r.period)
+	if t.Before(r.Start) && !r.Start.Add(time.Duration(k)*r.period).Equal(t) {
+		k--
+	}
+	return k
+}
+
+func (r *Rotation) user(k int64) string {
+	n := int64(len(r.Users))
+	return r.Users[((k%n)+n)%n]
+}
+
+// Override : user on call instead of the rotation in a period, for example holidays and swaps
+type Override struct {
+	UserId string    `json:"userId"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason"`
+}
+
+// Shift : user on call in [start, end)
+type Shift struct {
+	UserId string    `json:"userId"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// Schedule : on-call schedule, later overrides take precedence over earlier ones
+type Schedule struct {
+	Name      string     `json:"name"`
+	Rotation  Rotation   `json:"rotation"`
+	Overrides []Override `json:"overrides"`
+}
+
+func (s *Schedule) Validate() error {
+	if s.Name == "" {
+		return errors.New("name of schedule could not be empty")
+	}
+	if err := s.Rotation.Validate(); err != nil {
+		return err
+	}
+	for _, o := range s.Overrides {
+		if o.UserId == "" {
+			return errors.New("userId of override could not be empty")
+		}
+		if !o.End.After(o.Start) {
+			return errors.New("end of override must be after start")
+		}
+	}
+	return nil
+}
+
+// Users : users of rotation and overrides
+func (s *Schedule) Users() []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, id := range s.Rotation.Users {
+		if !seen[id] {
+			seen[id] = true
+			res = append(res, id)
+		}
+	}
+	for _, o := range s.Overrides {
+		if !seen[o.UserId] {
+			seen[o.UserId] = true
+			res = append(res, o.UserId)
+		}
+	}
+	return res
+}
+
+// Shifts : shifts in [from, to), schedule must be validated
+func (s *Schedule) Shifts(from, to time.Time) []Shift {
+	var shifts []Shift
+	if !to.After(from) {
+		return make([]Shift, 0)
+	}
+	r := &s.Rotation
+	for k := r.shift(from); ; k++ {
+		start := r.Start.Add(time.Duration(k) * r.period)
+		if !start.Before(to) {
+			break
+		}
+		shifts = append(shifts, clip(Shift{UserId: r.user(k), Start: start, End: start.Add(r.period)}, from, to))
+	}
+	for _, o := range s.Overrides {
+		if !o.Start.Before(to) || !o.End.After(from) {
+			continue
+		}
+		var res []Shift
+		for _, sh := range shifts {
+			if !sh.Start.Before(o.End) || !sh.End.After(o.Start) {
+				res = append(res, sh)
+				continue
+			}
+			if sh.Start.Before(o.Start) {
+				res = append(res, Shift{UserId: sh.UserId, Start: sh.Start, End: o.Start})
+			}
+			if sh.End.After(o.End) {
+				res = append(res, Shift{UserId: sh.UserId, Start: o.End, End: sh.End})
+			}
+		}
+		shifts = append(res, clip(Shift{UserId: o.UserId, Start: o.Start, End: o.End}, from, to))
+		sort.Slice(shifts, func(i, j int) bool {
+			return shifts[i].Start.Before(shifts[j].Start)
+		})
+	}
+	// merge adjacent shifts of the same user
+	merged := make([]Shift, 0, len(shifts))
+	for _, sh := range shifts {
+		if n := len(merged); n > 0 && merged[n-1].UserId == sh.UserId && merged[n-1].End.Equal(sh.Start) {
+			merged[n-1].End = sh.End
+			continue
+		}
+		merged = append(merged, sh)
+	}
+	return merged
+}
+
+func clip(sh Shift, from, to time.Time) Shift {
+	if sh.Start.Before(from) {
+		sh.Start = from
+	}
+	if sh.End.After(to) {
+		sh.End = to
+	}
+	return sh
+}
+
+// OnCall : shift of the user on call at t, the end is looked up within two periods
+func (s *Schedule) OnCall(t time.Time) Shift {
+	shifts := s.Shifts(t, t.Add(2*s.Rotation.period))
+	return shifts[0]
+}
+
+// OnCall : receiver of the user on call of a schedule
+type OnCall struct {
+	BaseApi
+}
+
+func (o OnCall) Id() string {
+	return o.Address
+}
+
+func (o OnCall) Validate() error {
+	if o.Address == "" {
+		return errors.New("schedule name could not be empty")
+	}
+	return nil
+}
+
+// Message : send message to contacts of the user on call, rendered by default templates.
+// Messages sent by subscribes are resolved before rendering, see expandOnCall
+func (o OnCall) Message(message Message) error {
+	rs, err := resolveOnCall(o.Address, time.Now())
+	if err != nil {
+		return err
+	}
+	var failed []string
+	for _, r := range rs {
+		if err := r.Message(render(OnCallType, nil, r.Api().Type, message)); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("send to on-call %s failed: %s", o.Address, strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Schedules : on-call schedules, users are resolved by directory
+type Schedules struct {
+	schedules map[string]*Schedule
+	users     *Directory
+	rw        sync.RWMutex
+}
+
+func NewSchedules(users *Directory) *Schedules {
+	return &Schedules{schedules: make(map[string]*Schedule), users: users}
+}
+
+var onCallSchedules *Schedules
+var schedulesOnce sync.Once
+
+// InitSchedules : init schedules used by on-call receivers, on-call receivers fail if not init
+func InitSchedules(users *Directory) *Schedules {
+	schedulesOnce.Do(func() {
+		onCallSchedules = NewSchedules(users)
+	})
+	return onCallSchedules
+}
+
+// Set : create or replace schedule, schedule must be validated
+func (s *Schedules) Set(schedule Schedule) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	s.schedules[schedule.Name] = &schedule
+}
+
+func (s *Schedules) Delete(name string) bool {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	if _, ok := s.schedules[name]; !ok {
+		return false
+	}
+	delete(s.schedules, name)
+	return true
+}
+
+func (s *Schedules) Get(name string) (Schedule, bool) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	schedule, ok := s.schedules[name]
+	if !ok {
+		return Schedule{}, false
+	}
+	return *schedule, true
+}
+
+// List : all schedules sorted by name
+func (s *Schedules) List() []Schedule {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	res := make([]Schedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		res = append(res, *schedule)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// Resolve : contacts of the user on call of schedule at t
+func (s *Schedules) Resolve(name string, t time.Time) (string, []Receiver, error) {
+	schedule, ok := s.Get(name)
+	if !ok {
+		return "", nil, fmt.Errorf("schedule %s not exists", name)
+	}
+	userId := schedule.OnCall(t).UserId
+	rs, ok := s.users.Contacts(userId)
+	if !ok {
+		return userId, nil, fmt.Errorf("on-call user %s of schedule %s not exists", userId, name)
+	}
+	if len(rs) == 0 {
+		return userId, nil, fmt.Errorf("on-call user %s of schedule %s has no contact", userId, name)
+	}
+	return userId, rs, nil
+}
+
+func resolveOnCall(name string, t time.Time) ([]Receiver, error) {
+	if onCallSchedules == nil {
+		return nil, errors.New("schedules not init")
+	}
+	_, rs, err := onCallSchedules.Resolve(name, t)
+	return rs, err
+}
+
+// expandOnCall : replace on-call receivers by contacts of the users on call.
+// On-call receivers which could not be resolved are kept, so that the failure is recorded and retried
+func expandOnCall(receivers []Receiver) []Receiver {
+	expanded := false
+	for _, r := range receivers {
+		if _, ok := r.(OnCall); ok {
+			expanded = true
+			break
+		}
+	}
+	if !expanded {
+		return receivers
+	}
+	now := time.Now()
+	seen := make(map[string]bool)
+	res := make([]Receiver, 0, len(receivers))
+	add := func(r Receiver) {
+		key := r.Api().Type + "#" + r.Id()
+		if !seen[key] {
+			seen[key] = true
+			res = append(res, r)
+		}
+	}
+	for _, r := range receivers {
+		o, ok := r.(OnCall)
+		if !ok {
+			add(r)
+			continue
+		}
+		rs, err := resolveOnCall(o.Address, now)
+		if err != nil {
+			add(r)
+			continue
+		}
+		for _, c := range rs {
+			add(c)
+		}
+	}
+	return res
+}
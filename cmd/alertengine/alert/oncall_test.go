@@ -0,0 +1,67 @@
+package alert
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"time"
+)
+
+func TestScheduleShifts(t *testing.T) {
+	start := time.Date(2021, 6, 1, 9, 0, 0, 0, time.Local)
+	s := Schedule{Name: "ops", Rotation: Rotation{Users: []string{"a", "b", "c"}, Start: start, Period: "24h"}}
+	assert.Equal(t, s.Validate(), nil)
+	day := 24 * time.Hour
+
+	assert.Equal(t, s.OnCall(start).UserId, "a")
+	assert.Equal(t, s.OnCall(start.Add(day+time.Hour)), Shift{UserId: "b", Start: start.Add(day + time.Hour), End: start.Add(2 * day)})
+	// before start the rotation goes backwards
+	assert.Equal(t, s.OnCall(start.Add(-time.Hour)).UserId, "c")
+	assert.Equal(t, s.OnCall(start.Add(3*day)).UserId, "a")
+
+	// b swaps with a on the second day, c takes half of the third day
+	s.Overrides = []Override{
+		{UserId: "a", Start: start.Add(day), End: start.Add(2 * day)},
+		{UserId: "a", Start: start.Add(2 * day), End: start.Add(2*day + 12*time.Hour)},
+	}
+	assert.Equal(t, s.Validate(), nil)
+	assert.Equal(t, s.Shifts(start, start.Add(3*day)), []Shift{
+		{UserId: "a", Start: start, End: start.Add(2*day + 12*time.Hour)},
+		{UserId: "c", Start: start.Add(2*day + 12*time.Hour), End: start.Add(3 * day)},
+	})
+	assert.Equal(t, s.Users(), []string{"a", "b", "c"})
+
+	s.Rotation.Period = "10m"
+	assert.NotEqual(t, s.Validate(), nil)
+	s.Rotation.Period, s.Overrides = "", []Override{{UserId: "a", Start: start, End: start}}
+	assert.NotEqual(t, s.Validate(), nil)
+}
+
+func TestExpandOnCall(t *testing.T) {
+	users := NewDirectory()
+	assert.Equal(t, users.SetUser(User{Id: "a", Contacts: []BaseApi{{Type: EmailType, Address: "a@example.com"}}}), nil)
+	assert.Equal(t, users.SetUser(User{Id: "b"}), nil)
+	onCallSchedules = NewSchedules(users)
+	defer func() { onCallSchedules = nil }()
+
+	now := time.Now()
+	for name, userId := range map[string]string{"ops": "a", "dev": "b"} {
+		s := Schedule{Name: name, Rotation: Rotation{Users: []string{userId}, Start: now.Add(-time.Hour)}}
+		assert.Equal(t, s.Validate(), nil)
+		onCallSchedules.Set(s)
+	}
+	_, err := NewReceiver(BaseApi{Type: OnCallType})
+	assert.NotEqual(t, err, nil)
+
+	mail := Mail{BaseApi{Type: EmailType, Address: "a@example.com"}}
+	ops := OnCall{BaseApi{Type: OnCallType, Address: "ops"}}
+	dev := OnCall{BaseApi{Type: OnCallType, Address: "dev"}}
+	missing := OnCall{BaseApi{Type: OnCallType, Address: "missing"}}
+	// contacts of the on-call user are deduplicated with other receivers,
+	// schedules without contacts or not exists are kept to record the failure
+	assert.Equal(t, expandOnCall([]Receiver{mail, ops, dev, missing}), []Receiver{mail, dev, missing})
+
+	userId, _, err := onCallSchedules.Resolve("dev", now)
+	assert.Equal(t, userId, "b")
+	assert.NotEqual(t, err, nil)
+	assert.NotEqual(t, missing.Message(testMessage("test")), nil)
+}
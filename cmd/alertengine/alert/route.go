@@ -0,0 +1,361 @@
+package alert
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// label names derived from payload, a "topic" label is added by alertengine
+const (
+	TopicLabel      = "topic"
+	ProjectLabel    = "project"
+	TaskLabel       = "task"
+	LevelLabel      = "level"
+	SensorTypeLabel = "sensor_type"
+	SensorMacLabel  = "sensor_mac"
+	StateLabel      = "state" // only for structured alerts
+)
+
+// Labeled : message carrying labels, which are matched by routes
+type Labeled interface {
+	Message
+	LabelSet() map[string]string
+}
+
+func (p Payload) LabelSet() map[string]string {
+	labels := map[string]string{
+		ProjectLabel:    p.ProjectId,
+		TaskLabel:       p.TaskId,
+		LevelLabel:      p.Level.String(),
+		SensorTypeLabel: p.SensorType,
+		SensorMacLabel:  p.SensorMac,
+	}
+	if p.State != "" {
+		labels[StateLabel] = string(p.State)
+	}
+	for k, v := range p.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+type labeledMessage struct {
+	Message
+	labels map[string]string
+}
+
+func (l labeledMessage) LabelSet() map[string]string {
+	return l.labels
+}
+
+// WithLabels : attach labels to message, labels of payload are merged
+func WithLabels(message Message, labels map[string]string) Message {
+	if len(labels) == 0 {
+		return message
+	}
+	if p, ok := message.(Payload); ok {
+		merged := make(map[string]string, len(p.Labels)+len(labels))
+		for k, v := range p.Labels {
+			merged[k] = v
+		}
+		for k, v := range labels {
+			merged[k] = v
+		}
+		p.Labels = merged
+		return p
+	}
+	return labeledMessage{Message: message, labels: labels}
+}
+
+// LabelsOf : labels of message, empty if message has no label
+func LabelsOf(message Message) map[string]string {
+	if l, ok := message.(Labeled); ok {
+		return l.LabelSet()
+	}
+	return map[string]string{}
+}
+
+// matcher operators
+const (
+	MatchEqual     = "="
+	MatchNotEqual  = "!="
+	MatchRegexp    = "=~"
+	MatchNotRegexp = "!~"
+)
+
+// Matcher : match value of label, regexp is anchored. Absent label is matched as empty string
+type Matcher struct {
+	Label string `json:"label"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+	re    *regexp.Regexp
+}
+
+func (m *Matcher) Validate() error {
+	if m.Label == "" {
+		return fmt.Errorf("label of matcher could not be empty")
+	}
+	switch m.Op {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid regexp of label %s: %s", m.Label, err.Error())
+		}
+		m.re = re
+	default:
+		return fmt.Errorf("op of matcher must in [%s, %s, %s, %s]", MatchEqual, MatchNotEqual, MatchRegexp, MatchNotRegexp)
+	}
+	return nil
+}
+
+func (m *Matcher) Match(labels map[string]string) bool {
+	v := labels[m.Label]
+	switch m.Op {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	default:
+		return !m.re.MatchString(v)
+	}
+}
+
+// Route : node of routing tree. An alert matching all matchers is passed to child routes in order,
+// the first matching child wins unless its Continue is true, the route itself is used if no child matches.
+// Alerts with the same values of GroupBy labels are sent together after GroupWait
+type Route struct {
+	Name      string    `json:"name"` // unique in the tree
+	Matchers  []Matcher `json:"matchers"`
+	Receivers []BaseApi `json:"receivers"`
+	Continue  bool      `json:"continue"`
+	GroupBy   []string  `json:"group_by"`
+	GroupWait string    `json:"group_wait"` // duration, default 30s if GroupBy is set
+	Routes    []*Route  `json:"routes"`
+	groupWait time.Duration
+	receivers []Receiver
+}
+
+const defaultGroupWait = 30 * time.Second
+
+// ValidateRoutes : validate routes and create receivers
+func ValidateRoutes(routes []*Route) error {
+	return validateRoutes(routes, make(map[string]bool))
+}
+
+func validateRoutes(routes []*Route, names map[string]bool) error {
+	for _, r := range routes {
+		if r == nil {
+			return fmt.Errorf("route could not be null")
+		}
+		if err := r.validate(); err != nil {
+			return err
+		}
+		if names[r.Name] {
+			return fmt.Errorf("route %s already existed", r.Name)
+		}
+		names[r.Name] = true
+		if err := validateRoutes(r.Routes, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Route) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name of route could not be empty")
+	}
+	for i := range r.Matchers {
+		if err := r.Matchers[i].Validate(); err != nil {
+			return fmt.Errorf("route %s: %s", r.Name, err.Error())
+		}
+	}
+	r.receivers = make([]Receiver, 0, len(r.Receivers))
+	for _, api := range r.Receivers {
+		temp, err := NewReceiver(api)
+		if err != nil {
+			return fmt.Errorf("route %s: %s", r.Name, err.Error())
+		}
+		r.receivers = append(r.receivers, temp)
+	}
+	r.groupWait = 0
+	if len(r.GroupBy) > 0 {
+		r.groupWait = defaultGroupWait
+		if r.GroupWait != "" {
+			d, err := time.ParseDuration(r.GroupWait)
+			if err != nil || d < 0 {
+				return fmt.Errorf("route %s: invalid group wait", r.Name)
+			}
+			r.groupWait = d
+		}
+	}
+	return nil
+}
+
+// Match : matched routes of labels, in the order of the tree
+func (r *Route) Match(labels map[string]string) []*Route {
+	for i := range r.Matchers {
+		if !r.Matchers[i].Match(labels) {
+			return nil
+		}
+	}
+	if res := matchRoutes(r.Routes, labels); len(res) > 0 {
+		return res
+	}
+	return []*Route{r}
+}
+
+func matchRoutes(routes []*Route, labels map[string]string) []*Route {
+	var res []*Route
+	for _, child := range routes {
+		matched := child.Match(labels)
+		if len(matched) == 0 {
+			continue
+		}
+		res = append(res, matched...)
+		if !child.Continue {
+			break
+		}
+	}
+	return res
+}
+
+// GroupKey : name of route and values of group labels, such as route{project="3",task="t1"}
+func (r *Route) GroupKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(r.GroupBy))
+	for _, l := range r.GroupBy {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", l, labels[l]))
+	}
+	return r.Name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// GroupMessage : alerts of the same group
+type GroupMessage struct {
+	Key      string
+	Messages []Message
+}
+
+func (g GroupMessage) Title() string {
+	return fmt.Sprintf("[%d] %s", len(g.Messages), g.Messages[0].Title())
+}
+
+func (g GroupMessage) Content() string {
+	contents := make([]string, 0, len(g.Messages))
+	for _, m := range g.Messages {
+		contents = append(contents, fmt.Sprintf("%s\n%s", m.Title(), m.Content()))
+	}
+	return strings.Join(contents, "\n\n---\n\n")
+}
+
+type group struct {
+	route    *Route
+	messages []Message
+	timer    *time.Timer
+}
+
+// Router : dispatch alerts to receivers of matched routes
+type Router struct {
+	routes []*Route
+	groups map[string]*group
+	rw     sync.RWMutex
+}
+
+func NewRouter() *Router {
+	return &Router{groups: make(map[string]*group)}
+}
+
+// SetRoutes : routes must be validated, pending groups are kept and sent to receivers of the old routes
+func (r *Router) SetRoutes(routes []*Route) {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+	r.routes = routes
+}
+
+func (r *Router) Routes() []*Route {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+	res := make([]*Route, len(r.routes))
+	copy(res, r.routes)
+	return res
+}
+
+// Match : matched routes of labels, top level routes are siblings under an implicit root without receivers
+func (r *Router) Match(labels map[string]string) []*Route {
+	r.rw.RLock()
+	defer r.rw.RUnlock()
+	return matchRoutes(r.routes, labels)
+}
+
+// Dispatch : send message to matched routes, return the number of matched routes
+func (r *Router) Dispatch(message Message) int {
+	labels := LabelsOf(message)
+	matched := r.Match(labels)
+	for _, route := range matched {
+		if len(route.receivers) == 0 {
+			continue
+		}
+		if len(route.GroupBy) == 0 {
+			r.send(route.Name, route, message)
+			continue
+		}
+		r.add(route, route.GroupKey(labels), message)
+	}
+	return len(matched)
+}
+
+// add : add message to group, the group is sent after group wait
+func (r *Router) add(route *Route, key string, message Message) {
+	r.rw.Lock()
+	defer r.rw.Unlock()
+	if g, ok := r.groups[key]; ok {
+		g.messages = append(g.messages, message)
+		return
+	}
+	g := &group{route: route, messages: []Message{message}}
+	r.groups[key] = g
+	g.timer = time.AfterFunc(route.groupWait, func() {
+		r.flush(key)
+	})
+}
+
+func (r *Router) flush(key string) {
+	r.rw.Lock()
+	g, ok := r.groups[key]
+	delete(r.groups, key)
+	r.rw.Unlock()
+	if !ok {
+		return
+	}
+	if len(g.messages) == 1 {
+		r.send(key, g.route, g.messages[0])
+	} else {
+		r.send(key, g.route, GroupMessage{Key: key, Messages: g.messages})
+	}
+}
+
+func (r *Router) send(topic string, route *Route, message Message) {
+	// errors are recorded by observers and failed deliveries are retried by queue
+	_ = sendAll(topic, route.receivers, nil, nil, message)
+}
+
+// Close : send all pending groups immediately
+func (r *Router) Close() {
+	r.rw.RLock()
+	keys := make([]string, 0, len(r.groups))
+	for key, g := range r.groups {
+		g.timer.Stop()
+		keys = append(keys, key)
+	}
+	r.rw.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		r.flush(key)
+	}
+}
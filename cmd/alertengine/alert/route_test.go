@@ -0,0 +1,66 @@
+package alert
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"time"
+)
+
+func routeNames(routes []*Route) []string {
+	names := make([]string, 0, len(routes))
+	for _, r := range routes {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func TestRouteMatch(t *testing.T) {
+	routes := []*Route{
+		{Name: "audit", Continue: true},
+		{
+			Name:     "project-3",
+			Matchers: []Matcher{{Label: ProjectLabel, Op: MatchEqual, Value: "3"}},
+			Routes: []*Route{
+				{Name: "alert", Matchers: []Matcher{{Label: LevelLabel, Op: MatchEqual, Value: "Alert"}}},
+				{Name: "temperature", Matchers: []Matcher{{Label: SensorTypeLabel, Op: MatchRegexp, Value: "temperature_.*"}}},
+			},
+		},
+		{Name: "others", Matchers: []Matcher{{Label: ProjectLabel, Op: MatchNotEqual, Value: ""}}},
+	}
+	assert.Equal(t, ValidateRoutes(routes), nil)
+	router := NewRouter()
+	router.SetRoutes(routes)
+
+	p := Payload{ProjectId: "3", Level: AlertLevel, SensorType: "temperature_air"}
+	assert.Equal(t, routeNames(router.Match(p.LabelSet())), []string{"audit", "alert"})
+	p.Level = WarnLevel
+	assert.Equal(t, routeNames(router.Match(p.LabelSet())), []string{"audit", "temperature"})
+	p.SensorType = "humidity"
+	assert.Equal(t, routeNames(router.Match(p.LabelSet())), []string{"audit", "project-3"})
+	p.ProjectId = "4"
+	assert.Equal(t, routeNames(router.Match(p.LabelSet())), []string{"audit", "others"})
+
+	// regexp is anchored
+	m := Matcher{Label: TaskLabel, Op: MatchRegexp, Value: "task"}
+	assert.Equal(t, m.Validate(), nil)
+	assert.Equal(t, m.Match(map[string]string{TaskLabel: "task-1"}), false)
+
+	dup := []*Route{{Name: "a"}, {Name: "b", Routes: []*Route{{Name: "a"}}}}
+	assert.NotEqual(t, ValidateRoutes(dup), nil)
+}
+
+func TestRouterGroup(t *testing.T) {
+	r := &failReceiver{BaseApi: BaseApi{Address: "group"}}
+	route := &Route{Name: "group", GroupBy: []string{TaskLabel}, groupWait: 20 * time.Millisecond, receivers: []Receiver{r}}
+	router := NewRouter()
+	router.SetRoutes([]*Route{route})
+
+	router.Dispatch(Payload{TaskId: "1", SensorMac: "a"})
+	router.Dispatch(Payload{TaskId: "1", SensorMac: "b"})
+	router.Dispatch(Payload{TaskId: "2"})
+	assert.Equal(t, route.GroupKey(map[string]string{TaskLabel: "1"}), `group{task="1"}`)
+	time.Sleep(50 * time.Millisecond)
+	r.mu.Lock()
+	assert.Equal(t, r.calls, 2)
+	r.mu.Unlock()
+}
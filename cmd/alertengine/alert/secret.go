@@ -0,0 +1,562 @@
+package alert
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// RedactedSecret : placeholder of secrets in API responses.
+// Receivers submitted with the placeholder keep the saved secret of the same type and address, see RestoreSecrets
+const RedactedSecret = "******"
+
+// sealedPrefix : prefix of encrypted secrets, secrets without it are saved before encryption is enabled
+const sealedPrefix = "enc:v1:"
+
+// SecretKey : key encrypting data keys, base64 of 32 bytes
+type SecretKey struct {
+	Id  string `yaml:"id"`
+	Key string `yaml:"key"`
+}
+
+// SecretOptions : keys of envelope encryption of receiver secrets. Each secret is encrypted by a random data key,
+// and the data key is encrypted by the first key. The other keys only decrypt secrets saved before rotation.
+// Secrets are saved in plain text if no key is configured
+type SecretOptions struct {
+	Keys []SecretKey `yaml:"keys"`
+}
+
+func (o SecretOptions) Validate() error {
+	_, err := newKeyring(o)
+	return err
+}
+
+// ParseSecretKeys : parse keys in format "id:key,id:key", used by environment variable
+func ParseSecretKeys(s string) ([]SecretKey, error) {
+	var keys []SecretKey
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		i := strings.Index(item, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid secret key %q, format is id:key", item)
+		}
+		keys = append(keys, SecretKey{Id: item[:i], Key: item[i+1:]})
+	}
+	return keys, nil
+}
+
+type keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// newKeyring : nil if no key
+func newKeyring(o SecretOptions) (*keyring, error) {
+	if len(o.Keys) == 0 {
+		return nil, nil
+	}
+	k := &keyring{primary: o.Keys[0].Id, keys: make(map[string]cipher.AEAD)}
+	for _, key := range o.Keys {
+		if key.Id == "" || strings.Contains(key.Id, ":") {
+			return nil, errors.New("id of secret key could not be empty or contain ':'")
+		}
+		if _, ok := k.keys[key.Id]; ok {
+			return nil, fmt.Errorf("secret key %s already existed", key.Id)
+		}
+		raw, err := base64.StdEncoding.DecodeString(key.Key)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("secret key %s must be base64 of 32 bytes", key.Id)
+		}
+		if k.keys[key.Id], err = newGCM(raw); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plain, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid sealed secret")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], additional)
+}
+
+// seal : enc:v1:<key id>:<encrypted data key>:<encrypted secret>
+func (k *keyring) seal(plain string) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	secret, err := seal(aead, []byte(plain), nil)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return sealedPrefix + k.primary + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(secret), nil
+}
+
+func (k *keyring) open(sealed string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(sealed, sealedPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("invalid sealed secret")
+	}
+	kek, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("secret key %s not exists", parts[0])
+	}
+	enc := base64.RawURLEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+	secret, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := open(kek, wrapped, []byte(parts[0]))
+	if err != nil {
+		return "", fmt.Errorf("decrypt data key with secret key %s failed", parts[0])
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(aead, secret, nil)
+	if err != nil {
+		return "", errors.New("decrypt secret failed")
+	}
+	return string(plain), nil
+}
+
+var secretKeys *keyring
+
+// InitSecrets : init keys of receiver secrets, secrets are saved in plain text if no key is configured
+func InitSecrets(opts SecretOptions) error {
+	k, err := newKeyring(opts)
+	if err != nil {
+		return err
+	}
+	secretKeys = k
+	return nil
+}
+
+// SecretsEncrypted : whether secrets are encrypted before saving
+func SecretsEncrypted() bool {
+	return secretKeys != nil
+}
+
+// SealSecret : encrypt secret with the primary key, empty secret is kept
+func SealSecret(s string) (string, error) {
+	if s == "" || secretKeys == nil || strings.HasPrefix(s, sealedPrefix) {
+		return s, nil
+	}
+	return secretKeys.seal(s)
+}
+
+// OpenSecret : decrypt secret, secret saved in plain text is returned as is
+func OpenSecret(s string) (string, error) {
+	if !strings.HasPrefix(s, sealedPrefix) {
+		return s, nil
+	}
+	if secretKeys == nil {
+		return "", errors.New("secret is encrypted but no secret key is configured")
+	}
+	return secretKeys.open(s)
+}
+
+// sensitiveHeader : headers of webhook treated as secrets, such as Authorization and X-Api-Key
+func sensitiveHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"authorization", "cookie", "token", "secret", "key", "password", "signature"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// sensitiveParam : query params of webhook urls treated as secrets, such as access_token, key and sign
+func sensitiveParam(name string) bool {
+	name = strings.ToLower(name)
+	return sensitiveHeader(name) || strings.Contains(name, "sign") || strings.Contains(name, "auth")
+}
+
+// redactURL : url with password of user info and values of sensitive query params replaced by RedactedSecret.
+// Order of params is kept, so that the same url is always redacted to the same string
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return RedactedSecret
+	}
+	var userinfo string
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			userinfo = u.User.Username() + ":" + RedactedSecret + "@"
+			u.User = nil
+		}
+	}
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		for i, param := range params {
+			kv := strings.SplitN(param, "=", 2)
+			name, err := url.QueryUnescape(kv[0])
+			if err != nil || sensitiveParam(name) {
+				params[i] = kv[0] + "=" + RedactedSecret
+			}
+		}
+		u.RawQuery = strings.Join(params, "&")
+	}
+	res := u.String()
+	if userinfo != "" {
+		res = strings.Replace(res, "//", "//"+userinfo, 1)
+	}
+	return res
+}
+
+// secretAddress : addresses of dingTalk, weCom and feishu are tokens of robots or webhook urls containing them,
+// webhook urls are secrets if they carry a password or credentials in query
+func secretAddress(typ, address string) bool {
+	switch typ {
+	case DingTalkType, WeComType, FeishuType:
+		return address != ""
+	case WebhookType:
+		return redactURL(address) != address
+	}
+	return false
+}
+
+func addressHash(address string) string {
+	sum := sha256.Sum256([]byte(address))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ReceiverId : id of receiver in delivery logs, verifications and logs.
+// Secret addresses are replaced by type and hash of the address, which is stable and does not reveal the secret
+func ReceiverId(typ, address string) string {
+	if !secretAddress(typ, address) {
+		return address
+	}
+	return typ + ":" + addressHash(address)
+}
+
+// redactAddress : secret address replaced by RedactedSecret and hash of the address,
+// only credentials are replaced for webhook urls
+func redactAddress(typ, address string) string {
+	if strings.HasPrefix(address, sealedPrefix) {
+		return RedactedSecret
+	}
+	if strings.Contains(address, RedactedSecret) || !secretAddress(typ, address) {
+		return address
+	}
+	if typ == WebhookType {
+		return redactURL(address)
+	}
+	return RedactedSecret + ":" + addressHash(address)
+}
+
+// scrubError : urls of *url.Error are redacted and secret address in the message is replaced,
+// since errors of delivery are saved in delivery logs, verifications and dead letters
+func scrubError(err error, api BaseApi) error {
+	if err == nil {
+		return nil
+	}
+	var e *url.Error
+	if errors.As(err, &e) {
+		e.URL = redactURL(e.URL)
+	}
+	if secretAddress(api.Type, api.Address) && strings.Contains(err.Error(), api.Address) {
+		return errors.New(strings.ReplaceAll(err.Error(), api.Address, redactAddress(api.Type, api.Address)))
+	}
+	return err
+}
+
+// mapSecrets : copy of api with token, secret address and sensitive headers mapped by f
+func (b BaseApi) mapSecrets(f func(string) (string, error)) (BaseApi, error) {
+	var err error
+	if b.Token, err = f(b.Token); err != nil {
+		return b, err
+	}
+	if strings.HasPrefix(b.Address, sealedPrefix) || secretAddress(b.Type, b.Address) {
+		if b.Address, err = f(b.Address); err != nil {
+			return b, err
+		}
+	}
+	if len(b.Headers) > 0 {
+		headers := make(map[string]string, len(b.Headers))
+		for k, v := range b.Headers {
+			if sensitiveHeader(k) {
+				if v, err = f(v); err != nil {
+					return b, err
+				}
+			}
+			headers[k] = v
+		}
+		b.Headers = headers
+	}
+	return b, nil
+}
+
+// Seal : copy of api with secrets encrypted, used before saving
+func (b BaseApi) Seal() (BaseApi, error) {
+	return b.mapSecrets(SealSecret)
+}
+
+// Open : copy of api with secrets decrypted, used after loading
+func (b BaseApi) Open() (BaseApi, error) {
+	api, err := b.mapSecrets(OpenSecret)
+	if err != nil {
+		return b, fmt.Errorf("decrypt secret of %s receiver failed: %s", b.Type, err.Error())
+	}
+	return api, nil
+}
+
+// Redacted : copy of api with secrets replaced by RedactedSecret, used by API responses and logs
+func (b BaseApi) Redacted() BaseApi {
+	api, _ := b.mapSecrets(func(s string) (string, error) {
+		if s == "" {
+			return s, nil
+		}
+		return RedactedSecret, nil
+	})
+	api.Address = redactAddress(b.Type, b.Address)
+	return api
+}
+
+// String : type and redacted address of receiver, so that receivers are safe to log
+func (b BaseApi) String() string {
+	return b.Type + ":" + redactAddress(b.Type, b.Address)
+}
+
+// SealApis : copy of apis with secrets encrypted
+func SealApis(apis []BaseApi) ([]BaseApi, error) {
+	return mapApis(apis, BaseApi.Seal)
+}
+
+// OpenApis : copy of apis with secrets decrypted
+func OpenApis(apis []BaseApi) ([]BaseApi, error) {
+	return mapApis(apis, BaseApi.Open)
+}
+
+// RedactApis : copy of apis with secrets redacted
+func RedactApis(apis []BaseApi) []BaseApi {
+	res, _ := mapApis(apis, func(b BaseApi) (BaseApi, error) {
+		return b.Redacted(), nil
+	})
+	return res
+}
+
+func mapApis(apis []BaseApi, f func(BaseApi) (BaseApi, error)) ([]BaseApi, error) {
+	if apis == nil {
+		return nil, nil
+	}
+	res := make([]BaseApi, 0, len(apis))
+	for _, api := range apis {
+		b, err := f(api)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	return res, nil
+}
+
+// RestoreSecrets : replace redacted secrets of apis by secrets of saved apis with the same type and address,
+// so that receivers returned by API could be submitted back unchanged. Redacted address matches the saved address
+// redacted to the same string
+func RestoreSecrets(apis []BaseApi, saved []BaseApi) ([]BaseApi, error) {
+	return mapApis(apis, func(b BaseApi) (BaseApi, error) {
+		redacted := strings.Contains(b.Address, RedactedSecret)
+		var old *BaseApi
+		for i := range saved {
+			if saved[i].Type != b.Type {
+				continue
+			}
+			if saved[i].Address == b.Address {
+				old = &saved[i]
+				break
+			}
+			if redacted && redactAddress(saved[i].Type, saved[i].Address) == b.Address {
+				if old != nil && old.Address != saved[i].Address {
+					return b, fmt.Errorf("address of %s matches several receivers, the secret is required", b)
+				}
+				old = &saved[i]
+			}
+		}
+		if redacted {
+			if old == nil {
+				return b, fmt.Errorf("address of %s is redacted, the secret is required", b)
+			}
+			b.Address = old.Address
+		}
+		if b.Token == RedactedSecret {
+			if old == nil {
+				return b, fmt.Errorf("token of %s is redacted, the secret is required", b)
+			}
+			b.Token = old.Token
+		}
+		if len(b.Headers) > 0 {
+			headers := make(map[string]string, len(b.Headers))
+			for k, v := range b.Headers {
+				if v == RedactedSecret {
+					if old == nil || old.Headers[k] == "" {
+						return b, fmt.Errorf("header %s of %s is redacted, the secret is required", k, b)
+					}
+					v = old.Headers[k]
+				}
+				headers[k] = v
+			}
+			b.Headers = headers
+		}
+		return b, nil
+	})
+}
+
+// ApisOf : apis of receivers
+func ApisOf(receivers []Receiver) []BaseApi {
+	res := make([]BaseApi, 0, len(receivers))
+	for _, r := range receivers {
+		res = append(res, r.Api())
+	}
+	return res
+}
+
+// mapTiers : copy of tiers with apis of receivers mapped by f
+func mapTiers(tiers []Tier, f func([]BaseApi) ([]BaseApi, error)) ([]Tier, error) {
+	res := make([]Tier, 0, len(tiers))
+	for _, t := range tiers {
+		apis, err := f(t.Receivers)
+		if err != nil {
+			return nil, err
+		}
+		t.Receivers = apis
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// Sealed : copy of policy with secrets encrypted
+func (p EscalationPolicy) Sealed() (EscalationPolicy, error) {
+	var err error
+	p.Tiers, err = mapTiers(p.Tiers, SealApis)
+	return p, err
+}
+
+// Opened : copy of policy with secrets decrypted
+func (p EscalationPolicy) Opened() (EscalationPolicy, error) {
+	var err error
+	p.Tiers, err = mapTiers(p.Tiers, OpenApis)
+	return p, err
+}
+
+// Redacted : copy of policy with secrets redacted
+func (p EscalationPolicy) Redacted() EscalationPolicy {
+	p.Tiers, _ = mapTiers(p.Tiers, func(apis []BaseApi) ([]BaseApi, error) {
+		return RedactApis(apis), nil
+	})
+	return p
+}
+
+// Apis : receivers of all tiers
+func (p EscalationPolicy) Apis() []BaseApi {
+	var res []BaseApi
+	for _, t := range p.Tiers {
+		res = append(res, t.Receivers...)
+	}
+	return res
+}
+
+// mapRoutes : deep copy of routing tree with apis of receivers mapped by f
+func mapRoutes(routes []*Route, f func([]BaseApi) ([]BaseApi, error)) ([]*Route, error) {
+	if routes == nil {
+		return nil, nil
+	}
+	res := make([]*Route, 0, len(routes))
+	for _, r := range routes {
+		if r == nil {
+			res = append(res, r)
+			continue
+		}
+		c := *r
+		var err error
+		if c.Receivers, err = f(r.Receivers); err != nil {
+			return nil, err
+		}
+		if c.Routes, err = mapRoutes(r.Routes, f); err != nil {
+			return nil, err
+		}
+		res = append(res, &c)
+	}
+	return res, nil
+}
+
+// SealRoutes : copy of routes with secrets encrypted
+func SealRoutes(routes []*Route) ([]*Route, error) {
+	return mapRoutes(routes, SealApis)
+}
+
+// OpenRoutes : copy of routes with secrets decrypted
+func OpenRoutes(routes []*Route) ([]*Route, error) {
+	return mapRoutes(routes, OpenApis)
+}
+
+// RedactRoutes : copy of routes with secrets redacted
+func RedactRoutes(routes []*Route) []*Route {
+	res, _ := mapRoutes(routes, func(apis []BaseApi) ([]BaseApi, error) {
+		return RedactApis(apis), nil
+	})
+	return res
+}
+
+// RouteApis : receivers of all routes in the tree
+func RouteApis(routes []*Route) []BaseApi {
+	var res []BaseApi
+	for _, r := range routes {
+		if r != nil {
+			res = append(res, r.Receivers...)
+			res = append(res, RouteApis(r.Routes)...)
+		}
+	}
+	return res
+}
+
+// Redacted : copy of user with secrets of contacts redacted
+func (u User) Redacted() User {
+	u.Contacts = RedactApis(u.Contacts)
+	return u
+}
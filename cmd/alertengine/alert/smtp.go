@@ -0,0 +1,245 @@
+package alert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	gomail "gopkg.in/mail.v2"
+	"io/ioutil"
+	"net"
+	"net/mail"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// tls modes of smtp
+const (
+	SmtpTLSAuto     = ""         // implicit tls on port 465, otherwise starttls if supported by server
+	SmtpTLSImplicit = "implicit" // tls from the beginning, usually port 465
+	SmtpTLSStart    = "starttls" // upgrade by STARTTLS, fail if not supported, usually port 587
+	SmtpTLSNone     = "none"     // plain text, only for trusted networks
+)
+
+var hostnameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+// SmtpOptions : smtp server used by email receivers
+type SmtpOptions struct {
+	Host               string        `yaml:"host"` // hostname or ip
+	Port               int           `yaml:"port"`
+	Account            string        `yaml:"account"`
+	Password           string        `yaml:"password"`
+	From               string        `yaml:"from"` // sender address, account if empty
+	TLS                string        `yaml:"tls"`  // auto/implicit/starttls/none
+	CA                 string        `yaml:"ca"`   // pem file of custom ca, system roots if empty
+	InsecureSkipVerify bool          `yaml:"insecureSkipVerify"`
+	Timeout            time.Duration `yaml:"timeout"`   // timeout of dial and each send
+	PoolSize           int           `yaml:"poolSize"`  // max connections
+	KeepAlive          time.Duration `yaml:"keepAlive"` // idle connections are closed after keepalive
+	Batch              int           `yaml:"batch"`     // max recipients of a message, recipients of a topic are hidden from each other
+}
+
+var DefaultSmtpOptions = SmtpOptions{
+	Timeout:   10 * time.Second,
+	PoolSize:  2,
+	KeepAlive: 30 * time.Second,
+	Batch:     50,
+}
+
+func (o SmtpOptions) Validate() error {
+	if net.ParseIP(o.Host) == nil && !hostnameRegexp.MatchString(o.Host) {
+		return fmt.Errorf("invalid smtp host")
+	}
+	if o.Port <= 0 || o.Port > 65535 {
+		return fmt.Errorf("invalid smtp port")
+	}
+	if o.Account == "" && o.From == "" {
+		return fmt.Errorf("invalid smtp account")
+	}
+	if o.Account != "" && o.Password == "" {
+		return fmt.Errorf("invalid smtp password")
+	}
+	if _, err := mail.ParseAddress(o.from()); err != nil {
+		return fmt.Errorf("invalid smtp from address")
+	}
+	switch o.TLS {
+	case SmtpTLSAuto, SmtpTLSImplicit, SmtpTLSStart, SmtpTLSNone:
+	default:
+		return fmt.Errorf("smtp tls must in [%s, %s, %s] or empty", SmtpTLSImplicit, SmtpTLSStart, SmtpTLSNone)
+	}
+	if o.Timeout < 0 || o.KeepAlive < 0 || o.PoolSize < 0 || o.Batch < 0 {
+		return fmt.Errorf("timeout, poolSize, keepAlive and batch of smtp could not be negative")
+	}
+	_, err := o.tlsConfig()
+	return err
+}
+
+func (o SmtpOptions) from() string {
+	if o.From != "" {
+		return o.From
+	}
+	return o.Account
+}
+
+func (o SmtpOptions) tlsConfig() (*tls.Config, error) {
+	conf := &tls.Config{ServerName: o.Host, InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CA == "" {
+		return conf, nil
+	}
+	content, err := ioutil.ReadFile(o.CA)
+	if err != nil {
+		return nil, fmt.Errorf("read smtp ca failed: %s", err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, errors.New("no certificate found in smtp ca")
+	}
+	conf.RootCAs = pool
+	return conf, nil
+}
+
+func (o SmtpOptions) dialer() (*gomail.Dialer, error) {
+	conf, err := o.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	d := gomail.NewDialer(o.Host, o.Port, o.Account, o.Password)
+	d.TLSConfig = conf
+	d.Timeout = o.Timeout
+	// reconnecting is handled by the pool
+	d.RetryFailure = false
+	switch o.TLS {
+	case SmtpTLSImplicit:
+		d.SSL = true
+	case SmtpTLSStart:
+		d.SSL, d.StartTLSPolicy = false, gomail.MandatoryStartTLS
+	case SmtpTLSNone:
+		d.SSL, d.StartTLSPolicy = false, gomail.NoStartTLS
+	}
+	return d, nil
+}
+
+type smtpConn struct {
+	gomail.SendCloser
+	lastUsed time.Time
+}
+
+// smtpPool : persistent smtp connections, idle connections are closed after keepalive.
+// A message is resent once on a new connection if the pooled one is broken
+type smtpPool struct {
+	dial      func() (gomail.SendCloser, error)
+	keepAlive time.Duration
+	sem       chan struct{} // limit the number of connections
+	idle      []*smtpConn
+	timer     *time.Timer
+	closed    bool
+	mu        sync.Mutex
+}
+
+func newSmtpPool(dial func() (gomail.SendCloser, error), size int, keepAlive time.Duration) *smtpPool {
+	if size <= 0 {
+		size = 1
+	}
+	return &smtpPool{dial: dial, keepAlive: keepAlive, sem: make(chan struct{}, size)}
+}
+
+// get : take an idle connection or dial a new one, reused is true for pooled connection
+func (p *smtpPool) get() (c *smtpConn, reused bool, err error) {
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		c = p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return c, true, nil
+	}
+	p.mu.Unlock()
+	sc, err := p.dial()
+	if err != nil {
+		return nil, false, err
+	}
+	return &smtpConn{SendCloser: sc}, false, nil
+}
+
+// put : return connection to pool, connection is closed if send failed since its state is unknown
+func (p *smtpPool) put(c *smtpConn, err error) {
+	if err != nil || p.keepAlive == 0 {
+		_ = c.Close()
+		return
+	}
+	c.lastUsed = time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		go c.Close()
+		return
+	}
+	p.idle = append(p.idle, c)
+	if p.timer == nil {
+		p.timer = time.AfterFunc(p.keepAlive, p.evict)
+	}
+}
+
+// evict : close connections idle longer than keepalive
+func (p *smtpPool) evict() {
+	p.mu.Lock()
+	p.timer = nil
+	now := time.Now()
+	var expired []*smtpConn
+	kept := p.idle[:0]
+	for _, c := range p.idle {
+		if now.Sub(c.lastUsed) >= p.keepAlive {
+			expired = append(expired, c)
+		} else {
+			kept = append(kept, c)
+		}
+	}
+	p.idle = kept
+	if len(kept) > 0 && !p.closed {
+		p.timer = time.AfterFunc(p.keepAlive-now.Sub(kept[0].lastUsed), p.evict)
+	}
+	p.mu.Unlock()
+	for _, c := range expired {
+		_ = c.Close()
+	}
+}
+
+// send : send message to envelope recipients, which may differ from recipients in headers
+func (p *smtpPool) send(from string, to []string, m *gomail.Message) error {
+	p.sem <- struct{}{}
+	defer func() { <-p.sem }()
+	c, reused, err := p.get()
+	if err != nil {
+		return err
+	}
+	err = c.Send(from, to, m)
+	p.put(c, err)
+	if err == nil || !reused {
+		return err
+	}
+	// the pooled connection may be closed by server, reconnect and try again
+	sc, err := p.dial()
+	if err != nil {
+		return err
+	}
+	c = &smtpConn{SendCloser: sc}
+	err = c.Send(from, to, m)
+	p.put(c, err)
+	return err
+}
+
+// Close : close idle connections, connections in use are closed when returned
+func (p *smtpPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+	for _, c := range idle {
+		_ = c.Close()
+	}
+}
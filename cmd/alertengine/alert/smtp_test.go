@@ -0,0 +1,157 @@
+package alert
+
+import (
+	"bufio"
+	"github.com/go-playground/assert/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSmtp : smtp server without tls and auth, records connections and recipients of each message
+type fakeSmtp struct {
+	ln         net.Listener
+	conns      int
+	recipients [][]string
+	dropAfter  bool // close connection after each message
+	mu         sync.Mutex
+}
+
+func newFakeSmtp(t *testing.T) *fakeSmtp {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, err, nil)
+	f := &fakeSmtp{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSmtp) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) {
+		_, _ = conn.Write([]byte(s + "\r\n"))
+	}
+	reply("220 fake")
+	var rcpts []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(cmd, "RCPT"):
+			rcpts = append(rcpts, strings.TrimSpace(line[len("RCPT TO:"):]))
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			for {
+				if l, err := r.ReadString('\n'); err != nil || l == ".\r\n" {
+					break
+				}
+			}
+			f.mu.Lock()
+			f.recipients = append(f.recipients, rcpts)
+			drop := f.dropAfter
+			f.mu.Unlock()
+			rcpts = nil
+			reply("250 OK")
+			if drop {
+				return
+			}
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (f *fakeSmtp) options() SmtpOptions {
+	host, port, _ := net.SplitHostPort(f.ln.Addr().String())
+	opts := DefaultSmtpOptions
+	opts.Host, opts.From, opts.TLS = host, "alert@example.com", SmtpTLSNone
+	opts.Port, _ = strconv.Atoi(port)
+	opts.PoolSize, opts.Batch = 1, 2
+	return opts
+}
+
+func TestSmtpPool(t *testing.T) {
+	f := newFakeSmtp(t)
+	defer f.ln.Close()
+	opts := f.options()
+	assert.Equal(t, opts.Validate(), nil)
+	d, err := opts.dialer()
+	assert.Equal(t, err, nil)
+	mailPool, mailOptions = newSmtpPool(d.Dial, opts.PoolSize, opts.KeepAlive), opts
+	defer func() {
+		mailPool.Close()
+		mailPool, mailOptions = nil, SmtpOptions{}
+	}()
+
+	// the connection is reused
+	msg := RenderedMessage{Subject: "hello", Body: "<p>world</p>"}
+	assert.Equal(t, Mail{BaseApi{Address: "a@example.com"}}.Message(msg), nil)
+	assert.Equal(t, Mail{BaseApi{Address: "b@example.com"}}.Message(msg), nil)
+	// recipients are sent in batches of 2
+	var rs []Receiver
+	for _, addr := range []string{"c@example.com", "d@example.com", "e@example.com"} {
+		rs = append(rs, Mail{BaseApi{Type: EmailType, Address: addr}})
+	}
+	assert.Equal(t, len(deliverMails("topic", rs, msg)), 0)
+	f.mu.Lock()
+	assert.Equal(t, f.conns, 1)
+	assert.Equal(t, f.recipients, [][]string{
+		{"<a@example.com>"}, {"<b@example.com>"}, {"<c@example.com>", "<d@example.com>"}, {"<e@example.com>"},
+	})
+	// broken pooled connection is replaced
+	f.dropAfter = true
+	f.mu.Unlock()
+	assert.Equal(t, SendMail([]string{"f@example.com"}, msg), nil)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, SendMail([]string{"g@example.com"}, msg), nil)
+	f.mu.Lock()
+	assert.Equal(t, f.conns, 2)
+	assert.Equal(t, len(f.recipients), 6)
+	f.mu.Unlock()
+}
+
+func TestSmtpOptionsValidate(t *testing.T) {
+	opts := DefaultSmtpOptions
+	opts.Host, opts.Port, opts.Account, opts.Password = "smtp.exmail.qq.com", 465, "alert@example.com", "secret"
+	assert.Equal(t, opts.Validate(), nil)
+	opts.Host = "10.0.0.1"
+	assert.Equal(t, opts.Validate(), nil)
+	opts.Host = "smtp exmail"
+	assert.NotEqual(t, opts.Validate(), nil)
+	opts.Host, opts.TLS = "smtp.exmail.qq.com", "ssl"
+	assert.NotEqual(t, opts.Validate(), nil)
+	opts.TLS, opts.CA = SmtpTLSImplicit, "/not/exists.pem"
+	assert.NotEqual(t, opts.Validate(), nil)
+}
+
+func TestMailPlainText(t *testing.T) {
+	digest := RenderedMessage{Subject: "digest", Body: "<h3>摘要</h3><table><tr><td>任务</td><td>a &amp; b</td></tr></table>"}
+	assert.Equal(t, plainText(digest), "摘要\n任务 a & b")
+	p := SamplePayload()
+	m, err := DefaultTemplates[EmailType].Render(p)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, plainText(m), p.Title()+"\n\n"+p.Content())
+}
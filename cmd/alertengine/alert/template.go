@@ -0,0 +1,307 @@
+package alert
+
+import (
+	"anomaly-detect/pkg/alerting"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const templateTimeFormat = "2006-01-02 15:04:05"
+
+// Payload : structured alert, rendered by template of each receiver type
+type Payload struct {
+	ProjectId      string            `json:"project_id"`
+	TaskId         string            `json:"task_id"`
+	SensorMac      string            `json:"sensor_mac"`
+	SensorType     string            `json:"sensor_type"`
+	ReceiveNo      string            `json:"receive_no"`
+	Value          float64           `json:"value"`
+	ThresholdLower float64           `json:"threshold_lower"`
+	ThresholdUpper float64           `json:"threshold_upper"`
+	Level          Level             `json:"level"`
+	Start          time.Time         `json:"start"`
+	Stop           time.Time         `json:"stop"`
+	Link           string            `json:"link"`
+	AckLink        string            `json:"ack_link"`     // signed acknowledge link, set by alertengine
+	SilenceLink    string            `json:"silence_link"` // signed link to silence the alert for SilenceDuration, set by alertengine
+	ChartUrl       string            `json:"chart_url"`    // link of sparkline png, set by alertengine
+	Chart          []byte            `json:"-"`            // sparkline png, embedded in emails as cid:chart.png
+	Subject        string            `json:"subject"`      // optional, used as title if not empty
+	Description    string            `json:"description"`  // optional
+	Labels         map[string]string `json:"labels"`       // extra labels used by routes, for example location
+	State          alerting.State    `json:"state"`        // resolved or firing, empty for legacy payload
+	Fingerprint    string            `json:"fingerprint"`  // identify the alert, used to drop duplicates
+	Annotations    map[string]string `json:"annotations"`
+}
+
+// FromAlert : payload of structured alert, well known annotations are used as subject, description and link
+func FromAlert(a alerting.Alert) Payload {
+	state := a.State
+	if state == "" {
+		state = alerting.Firing
+	}
+	return Payload{
+		ProjectId:      a.ProjectId,
+		TaskId:         a.TaskId,
+		SensorMac:      a.Series.SensorMac,
+		SensorType:     a.Series.SensorType,
+		ReceiveNo:      a.Series.ReceiveNo,
+		Value:          a.Value,
+		ThresholdLower: a.ThresholdLower,
+		ThresholdUpper: a.ThresholdUpper,
+		Level:          Level(a.Level),
+		Start:          a.Start,
+		Stop:           a.Stop,
+		Link:           a.Annotations[alerting.LinkAnnotation],
+		Subject:        a.Annotations[alerting.SummaryAnnotation],
+		Description:    a.Annotations[alerting.DescriptionAnnotation],
+		Labels:         a.Labels,
+		State:          state,
+		Fingerprint:    a.Fingerprint(),
+		Annotations:    a.Annotations,
+	}
+}
+
+// Resolved : whether the payload is a resolved alert
+func (p Payload) Resolved() bool {
+	return p.State == alerting.Resolved
+}
+
+// Title : plain title, used when no template is applied
+func (p Payload) Title() string {
+	if p.Subject != "" {
+		return p.Subject
+	}
+	if p.Resolved() {
+		return fmt.Sprintf("[%s] 项目 %s 任务 %s 告警恢复", p.Level, p.ProjectId, p.TaskId)
+	}
+	return fmt.Sprintf("[%s] 项目 %s 任务 %s 告警", p.Level, p.ProjectId, p.TaskId)
+}
+
+// Content : plain content, used when no template is applied
+func (p Payload) Content() string {
+	var lines []string
+	if p.SensorMac != "" {
+		lines = append(lines, fmt.Sprintf("传感器: %s %s %s", p.SensorMac, p.SensorType, p.ReceiveNo))
+	}
+	lines = append(lines, fmt.Sprintf("数值: %v 阈值: [%v, %v]", p.Value, p.ThresholdLower, p.ThresholdUpper))
+	if !p.Start.IsZero() {
+		lines = append(lines, fmt.Sprintf("时间: %s ~ %s", formatTime(p.Start), formatTime(p.Stop)))
+	}
+	if p.Description != "" {
+		lines = append(lines, p.Description)
+	}
+	if p.Link != "" {
+		lines = append(lines, p.Link)
+	}
+	if p.ChartUrl != "" {
+		lines = append(lines, "趋势图: "+p.ChartUrl)
+	}
+	if p.AckLink != "" {
+		lines = append(lines, "确认告警: "+p.AckLink)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Structured : message carrying a payload, which can be rendered by template
+type Structured interface {
+	Message
+	Data() Payload
+}
+
+func (p Payload) Data() Payload {
+	return p
+}
+
+// SamplePayload : used to preview templates
+func SamplePayload() Payload {
+	now := time.Now()
+	return Payload{
+		ProjectId:      "3",
+		TaskId:         "sample-task",
+		SensorMac:      "C125",
+		SensorType:     "temperature_air",
+		ReceiveNo:      "2",
+		Value:          35.2,
+		ThresholdLower: 10,
+		ThresholdUpper: 29.5,
+		Level:          AlertLevel,
+		Start:          now.Add(-10 * time.Minute),
+		Stop:           now,
+		Link:           "http://localhost/task/sample-task",
+		Description:    "sample alert",
+	}
+}
+
+// Template : subject and body template of a receiver type.
+// Html templates are rendered with html/template, others with text/template
+type Template struct {
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Html    bool   `json:"html"`
+}
+
+var templateFuncs = map[string]interface{}{
+	"time": formatTime,
+	"json": func(v interface{}) (string, error) {
+		content, err := json.Marshal(v)
+		return string(content), err
+	},
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(templateTimeFormat)
+}
+
+func (t Template) Validate() error {
+	if t.Subject == "" || t.Body == "" {
+		return fmt.Errorf("subject and body of template could not be empty")
+	}
+	_, err := t.Render(SamplePayload())
+	return err
+}
+
+// Render : render payload to message
+func (t Template) Render(p Payload) (Message, error) {
+	subject, body, err := t.render(p)
+	if err != nil {
+		return nil, err
+	}
+	return RenderedMessage{Subject: subject, Body: body, Payload: p}, nil
+}
+
+func (t Template) render(data interface{}) (string, string, error) {
+	subject, err := renderText("subject", t.Subject, data)
+	if err != nil {
+		return "", "", fmt.Errorf("render subject failed: %s", err.Error())
+	}
+	var body string
+	if t.Html {
+		tpl, err := htmltemplate.New("body").Funcs(templateFuncs).Parse(t.Body)
+		if err != nil {
+			return "", "", fmt.Errorf("parse body failed: %s", err.Error())
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, data); err != nil {
+			return "", "", fmt.Errorf("render body failed: %s", err.Error())
+		}
+		body = buf.String()
+	} else if body, err = renderText("body", t.Body, data); err != nil {
+		return "", "", fmt.Errorf("render body failed: %s", err.Error())
+	}
+	return subject, body, nil
+}
+
+func renderText(name, text string, data interface{}) (string, error) {
+	tpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RenderedMessage : message rendered from payload
+type RenderedMessage struct {
+	Subject string  `json:"subject"`
+	Body    string  `json:"body"`
+	Payload Payload `json:"-"`
+}
+
+func (r RenderedMessage) Title() string {
+	return r.Subject
+}
+
+func (r RenderedMessage) Content() string {
+	return r.Body
+}
+
+func (r RenderedMessage) Data() Payload {
+	return r.Payload
+}
+
+const defaultSubject = `[{{.Level}}] 项目 {{.ProjectId}} 任务 {{.TaskId}} 告警{{if .Resolved}}恢复{{end}}`
+
+const markdownBody = `### {{if .Subject}}{{.Subject}}{{else}}[{{.Level}}] 任务 {{.TaskId}} 告警{{if .Resolved}}恢复{{end}}{{end}}
+- 项目: {{.ProjectId}}
+- 任务: {{.TaskId}}
+{{- if .SensorMac}}
+- 传感器: {{.SensorMac}} {{.SensorType}} {{.ReceiveNo}}
+{{- end}}
+- 数值: **{{.Value}}**
+- 阈值: [{{.ThresholdLower}}, {{.ThresholdUpper}}]
+- 等级: {{.Level}}
+{{- if .State}}
+- 状态: {{.State}}
+{{- end}}
+{{- if not .Start.IsZero}}
+- 时间: {{time .Start}} ~ {{time .Stop}}
+{{- end}}
+{{- if .Description}}
+
+{{.Description}}
+{{- end}}
+{{- if .ChartUrl}}
+
+![趋势图]({{.ChartUrl}})
+{{- end}}
+{{- if .Link}}
+
+[查看详情]({{.Link}})
+{{- end}}
+{{- if .AckLink}}
+
+[确认告警]({{.AckLink}})
+{{- end}}`
+
+const htmlBody = `<h3>{{if .Subject}}{{.Subject}}{{else}}[{{.Level}}] 任务 {{.TaskId}} 告警{{if .Resolved}}恢复{{end}}{{end}}</h3>
+<table border="1" cellspacing="0" cellpadding="4">
+<tr><td>项目</td><td>{{.ProjectId}}</td></tr>
+<tr><td>任务</td><td>{{.TaskId}}</td></tr>
+{{- if .SensorMac}}
+<tr><td>传感器</td><td>{{.SensorMac}} {{.SensorType}} {{.ReceiveNo}}</td></tr>
+{{- end}}
+<tr><td>数值</td><td><b>{{.Value}}</b></td></tr>
+<tr><td>阈值</td><td>[{{.ThresholdLower}}, {{.ThresholdUpper}}]</td></tr>
+<tr><td>等级</td><td>{{.Level}}</td></tr>
+{{- if .State}}
+<tr><td>状态</td><td>{{.State}}</td></tr>
+{{- end}}
+{{- if not .Start.IsZero}}
+<tr><td>时间</td><td>{{time .Start}} ~ {{time .Stop}}</td></tr>
+{{- end}}
+</table>
+{{- if .Chart}}
+<p><img src="cid:chart.png" alt="趋势图"></p>
+{{- end}}
+{{- if .Description}}
+<p>{{.Description}}</p>
+{{- end}}
+{{- if .Link}}
+<p><a href="{{.Link}}">查看详情</a></p>
+{{- end}}
+{{- if .AckLink}}
+<p><a href="{{.AckLink}}">确认告警</a></p>
+{{- end}}`
+
+const jsonBody = `{{json .}}`
+
+// DefaultTemplates : default template of each receiver type
+var DefaultTemplates = map[string]Template{
+	EmailType:    {Subject: defaultSubject, Body: htmlBody, Html: true},
+	DingTalkType: {Subject: defaultSubject, Body: markdownBody},
+	WeComType:    {Subject: defaultSubject, Body: markdownBody},
+	FeishuType:   {Subject: defaultSubject, Body: markdownBody},
+	WebhookType:  {Subject: defaultSubject, Body: jsonBody},
+}
@@ -0,0 +1,72 @@
+package alert
+
+import (
+	"anomaly-detect/pkg/alerting"
+	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	"strings"
+	"testing"
+)
+
+func TestDefaultTemplates(t *testing.T) {
+	p := SamplePayload()
+	p.Description = "<b>湿度</b>过高"
+	for receiverType, tpl := range DefaultTemplates {
+		assert.Equal(t, tpl.Validate(), nil)
+		message := render("topic", nil, receiverType, p)
+		assert.Equal(t, strings.Contains(message.Title(), p.TaskId), true)
+		structured, ok := message.(Structured)
+		assert.Equal(t, ok, true)
+		assert.Equal(t, structured.Data().TaskId, p.TaskId)
+	}
+
+	// html of email is escaped, markdown keeps the text
+	email := render("topic", nil, EmailType, p)
+	assert.Equal(t, strings.Contains(email.Content(), "<p>&lt;b&gt;湿度&lt;/b&gt;过高</p>"), true)
+	ding := render("topic", nil, DingTalkType, p)
+	assert.Equal(t, strings.HasPrefix(ding.Content(), "### "), true)
+	assert.Equal(t, strings.Contains(ding.Content(), "- 任务: "+p.TaskId), true)
+	assert.Equal(t, strings.Contains(ding.Content(), "<b>湿度</b>过高"), true)
+	// webhook body is the json of payload
+	var decoded Payload
+	assert.Equal(t, json.Unmarshal([]byte(render("topic", nil, WebhookType, p).Content()), &decoded), nil)
+	assert.Equal(t, decoded.SensorMac, p.SensorMac)
+
+	p.State = alerting.Resolved
+	assert.Equal(t, strings.HasSuffix(render("topic", nil, WeComType, p).Title(), "告警恢复"), true)
+}
+
+func TestCustomTemplate(t *testing.T) {
+	templates := map[string]Template{
+		DingTalkType: {Subject: "{{.ProjectId}} 告警", Body: "{{.TaskId}} {{.Value}}"},
+	}
+	p := SamplePayload()
+	custom := render("topic", templates, DingTalkType, p)
+	assert.Equal(t, custom.Title(), p.ProjectId+" 告警")
+	assert.Equal(t, strings.HasPrefix(custom.Content(), p.TaskId+" "), true)
+	// other types use the default templates
+	assert.Equal(t, strings.HasPrefix(render("topic", templates, FeishuType, p).Content(), "### "), true)
+	// receivers without templates and plain messages are kept
+	assert.Equal(t, render("topic", templates, OnCallType, p), Message(p))
+	assert.Equal(t, render("topic", templates, DingTalkType, testMessage("plain")), Message(testMessage("plain")))
+
+	// invalid template falls back to the message itself
+	templates[DingTalkType] = Template{Subject: "{{.Missing}}", Body: "body"}
+	assert.NotEqual(t, templates[DingTalkType].Validate(), nil)
+	assert.Equal(t, render("topic", templates, DingTalkType, p), Message(p))
+	assert.NotEqual(t, Template{Subject: "subject"}.Validate(), nil)
+	assert.NotEqual(t, Template{Subject: "{{", Body: "body"}.Validate(), nil)
+
+	sub := &Subscribe{Topic: "topic"}
+	sub.SetTemplate(EmailType, Template{Subject: "s", Body: "<p>{{.TaskId}}</p>", Html: true})
+	tpl, ok := sub.Template(EmailType)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, tpl.Subject, "s")
+	tpl, ok = sub.Template(WebhookType)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, tpl, DefaultTemplates[WebhookType])
+	_, ok = sub.Template(BrowserType)
+	assert.Equal(t, ok, false)
+	assert.Equal(t, sub.DeleteTemplate(EmailType), true)
+	assert.Equal(t, sub.DeleteTemplate(EmailType), false)
+}
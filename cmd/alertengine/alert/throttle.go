@@ -0,0 +1,261 @@
+package alert
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Throttle : rate limit, duplicate suppression and quiet hours of a receiver or a subscribe
+type Throttle struct {
+	Rate        float64     `json:"rate,omitempty"`         // messages per minute, 0 means unlimited
+	Burst       int         `json:"burst,omitempty"`        // bucket size, default ceil(rate)
+	DedupWindow string      `json:"dedup_window,omitempty"` // duration, same messages within the window are dropped
+	QuietHours  *QuietHours `json:"quiet_hours,omitempty"`  // messages below Alert level are held and sent as one summary afterwards
+	dedupWindow time.Duration
+}
+
+func (t *Throttle) Validate() error {
+	if t.Rate < 0 || t.Burst < 0 {
+		return fmt.Errorf("rate and burst could not be negative")
+	}
+	if t.Burst == 0 && t.Rate > 0 {
+		t.Burst = int(math.Ceil(t.Rate))
+	}
+	t.dedupWindow = 0
+	if t.DedupWindow != "" {
+		d, err := time.ParseDuration(t.DedupWindow)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid dedup window")
+		}
+		t.dedupWindow = d
+	}
+	if t.QuietHours != nil {
+		return t.QuietHours.Validate()
+	}
+	return nil
+}
+
+// QuietHours : daily period in local time, such as 22:00 ~ 08:00
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	start int    // minutes of day
+	end   int
+}
+
+func (q *QuietHours) Validate() error {
+	var err error
+	if q.start, err = parseClock(q.Start); err != nil {
+		return err
+	}
+	if q.end, err = parseClock(q.End); err != nil {
+		return err
+	}
+	if q.start == q.end {
+		return fmt.Errorf("start and end of quiet hours could not be the same")
+	}
+	return nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid clock %s, must be like 22:00", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// In : whether t is in quiet hours
+func (q QuietHours) In(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if q.start < q.end {
+		return m >= q.start && m < q.end
+	}
+	return m >= q.start || m < q.end
+}
+
+// Until : end of the quiet hours containing t
+func (q QuietHours) Until(t time.Time) time.Time {
+	end := time.Date(t.Year(), t.Month(), t.Day(), q.end/60, q.end%60, 0, 0, t.Location())
+	if !end.After(t) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type held struct {
+	topic    string
+	receiver Receiver
+	messages []Message
+	timer    *time.Timer
+}
+
+// throttler : state of throttles keyed by topic or receiver
+type throttler struct {
+	buckets map[string]*bucket
+	seen    map[string]map[string]time.Time // key -> message hash -> last sent
+	held    map[string]*held                // topic#receiver -> messages held in quiet hours
+	mu      sync.Mutex
+}
+
+var defaultThrottler = &throttler{
+	buckets: make(map[string]*bucket),
+	seen:    make(map[string]map[string]time.Time),
+	held:    make(map[string]*held),
+}
+
+// allow : check rate limit and duplicate of key, must hold the lock
+func (th *throttler) allow(key string, t *Throttle, hash string, now time.Time) error {
+	if t.dedupWindow > 0 {
+		seen, ok := th.seen[key]
+		if !ok {
+			seen = make(map[string]time.Time)
+			th.seen[key] = seen
+		}
+		for h, last := range seen {
+			if now.Sub(last) >= t.dedupWindow {
+				delete(seen, h)
+			}
+		}
+		if _, ok := seen[hash]; ok {
+			return fmt.Errorf("duplicate message within %s", t.DedupWindow)
+		}
+	}
+	if t.Rate > 0 {
+		b, ok := th.buckets[key]
+		if !ok {
+			b = &bucket{tokens: float64(t.Burst), last: now}
+			th.buckets[key] = b
+		}
+		b.tokens = math.Min(float64(t.Burst), b.tokens+now.Sub(b.last).Minutes()*t.Rate)
+		b.last = now
+		if b.tokens < 1 {
+			return fmt.Errorf("rate limited to %v per minute", t.Rate)
+		}
+		b.tokens--
+	}
+	if t.dedupWindow > 0 {
+		th.seen[key][hash] = now
+	}
+	return nil
+}
+
+// dedupHash : structured alerts with the same fingerprint, level and state are duplicates even if the value changed,
+// other messages are compared by title and content
+func dedupHash(message Message) string {
+	if s, ok := message.(Structured); ok {
+		if p := s.Data(); p.Fingerprint != "" {
+			return fmt.Sprintf("%s#%d#%s", p.Fingerprint, p.Level, p.State)
+		}
+	}
+	return MessageHash(message)
+}
+
+// allowTopic : check throttle of subscribe before sending to its receivers
+func (th *throttler) allowTopic(topic string, t *Throttle, message Message) error {
+	if t == nil {
+		return nil
+	}
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	return th.allow("topic#"+topic, t, dedupHash(message), time.Now())
+}
+
+// hold : hold message of receiver in quiet hours, return false if the message should be sent now.
+// Quiet hours of receiver take precedence over the one of subscribe
+func (th *throttler) hold(topic string, r Receiver, topicThrottle *Throttle, message, rendered Message) bool {
+	var quiet *QuietHours
+	if t := r.Api().Throttle; t != nil && t.QuietHours != nil {
+		quiet = t.QuietHours
+	} else if topicThrottle != nil {
+		quiet = topicThrottle.QuietHours
+	}
+	now := time.Now()
+	if quiet == nil || !quiet.In(now) || LabelsOf(message)[LevelLabel] == AlertLevel.String() {
+		return false
+	}
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	key := topic + "#" + r.Id()
+	h, ok := th.held[key]
+	if !ok {
+		h = &held{topic: topic, receiver: r}
+		th.held[key] = h
+		h.timer = time.AfterFunc(quiet.Until(now).Sub(now), func() {
+			th.release(key)
+		})
+	}
+	h.messages = append(h.messages, rendered)
+	return true
+}
+
+// allowReceiver : check throttle of receiver
+func (th *throttler) allowReceiver(r Receiver, message Message) error {
+	t := r.Api().Throttle
+	if t == nil {
+		return nil
+	}
+	th.mu.Lock()
+	defer th.mu.Unlock()
+	return th.allow("receiver#"+r.Api().Type+"#"+r.Id(), t, dedupHash(message), time.Now())
+}
+
+// release : send messages held in quiet hours as one summary
+func (th *throttler) release(key string) {
+	th.mu.Lock()
+	h, ok := th.held[key]
+	delete(th.held, key)
+	th.mu.Unlock()
+	if !ok {
+		return
+	}
+	var m Message = h.messages[0]
+	if len(h.messages) > 1 {
+		m = GroupMessage{Key: "quiet hours", Messages: h.messages}
+	}
+	deliver(h.topic, h.receiver, m)
+}
+
+// flush : send all held messages immediately
+func (th *throttler) flush() {
+	th.mu.Lock()
+	keys := make([]string, 0, len(th.held))
+	for key, h := range th.held {
+		h.timer.Stop()
+		keys = append(keys, key)
+	}
+	th.mu.Unlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		th.release(key)
+	}
+}
+
+// FlushHeld : send messages held in quiet hours immediately, called when the server stops
+func FlushHeld() {
+	defaultThrottler.flush()
+}
+
+// HeldCount : number of messages held in quiet hours
+func HeldCount() int {
+	defaultThrottler.mu.Lock()
+	defer defaultThrottler.mu.Unlock()
+	n := 0
+	for _, h := range defaultThrottler.held {
+		n += len(h.messages)
+	}
+	return n
+}
+
+func logSuppressed(topic string, r Receiver, err error) {
+	logrus.Infof("message of %s to %s suppressed: %s", topic, r.Api(), err.Error())
+}
@@ -0,0 +1,65 @@
+package alert
+
+import (
+	"anomaly-detect/pkg/alerting"
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"time"
+)
+
+func TestThrottleAllow(t *testing.T) {
+	th := &throttler{
+		buckets: make(map[string]*bucket),
+		seen:    make(map[string]map[string]time.Time),
+	}
+	now := time.Now()
+	rate := &Throttle{Rate: 2}
+	assert.Equal(t, rate.Validate(), nil)
+	assert.Equal(t, rate.Burst, 2)
+	assert.Equal(t, th.allow("rate", rate, "a", now), nil)
+	assert.Equal(t, th.allow("rate", rate, "b", now), nil)
+	assert.NotEqual(t, th.allow("rate", rate, "c", now), nil)
+	// one token every 30s
+	assert.Equal(t, th.allow("rate", rate, "d", now.Add(30*time.Second)), nil)
+
+	dedup := &Throttle{DedupWindow: "1m"}
+	assert.Equal(t, dedup.Validate(), nil)
+	assert.Equal(t, th.allow("dedup", dedup, "a", now), nil)
+	assert.NotEqual(t, th.allow("dedup", dedup, "a", now.Add(30*time.Second)), nil)
+	assert.Equal(t, th.allow("dedup", dedup, "b", now.Add(30*time.Second)), nil)
+	assert.Equal(t, th.allow("dedup", dedup, "a", now.Add(time.Minute)), nil)
+}
+
+func TestQuietHours(t *testing.T) {
+	q := QuietHours{Start: "22:00", End: "08:00"}
+	assert.Equal(t, q.Validate(), nil)
+	day := time.Date(2022, 3, 1, 0, 0, 0, 0, time.Local)
+	assert.Equal(t, q.In(day.Add(23*time.Hour)), true)
+	assert.Equal(t, q.In(day.Add(7*time.Hour)), true)
+	assert.Equal(t, q.In(day.Add(12*time.Hour)), false)
+	assert.Equal(t, q.Until(day.Add(23*time.Hour)), day.Add(32*time.Hour))
+	assert.Equal(t, q.Until(day.Add(7*time.Hour)), day.Add(8*time.Hour))
+	assert.NotEqual(t, (&QuietHours{Start: "8:00", End: "8:00"}).Validate(), nil)
+}
+
+func TestDedupStructuredAlert(t *testing.T) {
+	a := alerting.Alert{ProjectId: "3", TaskId: "task", Level: alerting.AlertLevel, Value: 35}
+	firing := FromAlert(a)
+	assert.Equal(t, firing.State, alerting.Firing)
+	a.Value = 36
+	assert.Equal(t, dedupHash(FromAlert(a)), dedupHash(firing))
+	// rendered message keeps the payload
+	m, err := DefaultTemplates[DingTalkType].Render(firing)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, dedupHash(m), dedupHash(firing))
+
+	a.State = alerting.Resolved
+	resolved := FromAlert(a)
+	assert.NotEqual(t, dedupHash(resolved), dedupHash(firing))
+	assert.Equal(t, resolved.LabelSet()[StateLabel], "resolved")
+	assert.Equal(t, resolved.Title(), "[Alert] 项目 3 任务 task 告警恢复")
+	m, _ = DefaultTemplates[DingTalkType].Render(resolved)
+	assert.Equal(t, m.Title(), resolved.Title())
+
+	assert.NotEqual(t, dedupHash(testMessage("a")), dedupHash(firing))
+}
@@ -0,0 +1,230 @@
+package alert
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RepeatInterval : repeat period of each level, the higher the level, the shorter the period.
+// zero value means never repeat
+type RepeatInterval struct {
+	Info  time.Duration `yaml:"info" json:"info"`
+	Warn  time.Duration `yaml:"warn" json:"warn"`
+	Alert time.Duration `yaml:"alert" json:"alert"`
+}
+
+var DefaultRepeatInterval = RepeatInterval{
+	Info:  4 * time.Hour,
+	Warn:  time.Hour,
+	Alert: 15 * time.Minute,
+}
+
+func (r RepeatInterval) Of(level Level) time.Duration {
+	switch level {
+	case InfoLevel:
+		return r.Info
+	case WarnLevel:
+		return r.Warn
+	default:
+		return r.Alert
+	}
+}
+
+// ActiveAlert : alert which has not been resolved
+type ActiveAlert struct {
+	Topic          string            `json:"topic"`
+	Id             string            `json:"id"`
+	Level          Level             `json:"level"`
+	Title          string            `json:"title"`
+	Content        string            `json:"content"`
+	Labels         map[string]string `json:"labels"` // labels of the last message, used by inhibit rules
+	FirstTriggered time.Time         `json:"first_triggered"`
+	LastNotified   time.Time         `json:"last_notified"`
+	Notified       int               `json:"notified"`
+	AcknowledgedBy string            `json:"acknowledged_by"` // empty if not acknowledged
+	AcknowledgedAt time.Time         `json:"acknowledged_at"`
+	SilencedUntil  time.Time         `json:"silenced_until"` // not repeated before, zero if not silenced
+	message        Message
+	timer          timer
+}
+
+// timer : *time.Timer, replaced in tests to fire repeats without waiting
+type timer interface {
+	Stop() bool
+}
+
+// SendFunc : deliver message to subscribe of topic
+type SendFunc func(topic string, message Message)
+
+// Tracker : keep active alerts keyed by topic and alert id, and resend them periodically until resolved
+type Tracker struct {
+	interval RepeatInterval
+	send     SendFunc
+	alerts   map[string]*ActiveAlert
+	rw       sync.RWMutex
+	now      func() time.Time
+	after    func(d time.Duration, f func()) timer
+}
+
+func NewTracker(interval RepeatInterval, send SendFunc) *Tracker {
+	return &Tracker{
+		interval: interval,
+		send:     send,
+		alerts:   make(map[string]*ActiveAlert),
+		now:      time.Now,
+		after: func(d time.Duration, f func()) timer {
+			return time.AfterFunc(d, f)
+		},
+	}
+}
+
+func trackerKey(topic, id string) string {
+	return fmt.Sprintf("%s#%s", topic, id)
+}
+
+// Fire : record a firing alert. The message is sent immediately if the alert is new or its level is raised,
+// otherwise only the content is refreshed and it will be sent at the next period.
+// Acknowledged alerts are not repeated until the level is raised. Return true if the message is sent
+func (t *Tracker) Fire(topic, id string, level Level, message Message) bool {
+	t.rw.Lock()
+	defer t.rw.Unlock()
+	key := trackerKey(topic, id)
+	a, ok := t.alerts[key]
+	if !ok {
+		a = &ActiveAlert{
+			Topic:          topic,
+			Id:             id,
+			FirstTriggered: t.now(),
+		}
+		t.alerts[key] = a
+	}
+	raised := !ok || level > a.Level
+	a.Level = level
+	a.Title = message.Title()
+	a.Content = message.Content()
+	a.Labels = LabelsOf(message)
+	a.message = message
+	if raised {
+		a.AcknowledgedBy = ""
+		a.AcknowledgedAt = time.Time{}
+		a.SilencedUntil = time.Time{}
+		t.notify(key, a)
+	} else if a.timer == nil && a.AcknowledgedBy == "" {
+		t.schedule(key, a)
+	}
+	return raised
+}
+
+// Acknowledge : stop repeating the alert until resolved or its level is raised, return false if the alert is not active
+func (t *Tracker) Acknowledge(topic, id, by string) bool {
+	t.rw.Lock()
+	defer t.rw.Unlock()
+	a, ok := t.alerts[trackerKey(topic, id)]
+	if !ok {
+		return false
+	}
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	a.AcknowledgedBy = by
+	a.AcknowledgedAt = t.now()
+	return true
+}
+
+// Silence : do not repeat the alert until the given time or its level is raised, return false if the alert is not active.
+// Acknowledged alerts are kept not repeated
+func (t *Tracker) Silence(topic, id string, until time.Time) bool {
+	t.rw.Lock()
+	defer t.rw.Unlock()
+	key := trackerKey(topic, id)
+	a, ok := t.alerts[key]
+	if !ok {
+		return false
+	}
+	a.SilencedUntil = until
+	if a.AcknowledgedBy == "" {
+		t.schedule(key, a)
+	}
+	return true
+}
+
+// Resolve : stop repeating the alert, return false if the alert is not active
+func (t *Tracker) Resolve(topic, id string) bool {
+	t.rw.Lock()
+	defer t.rw.Unlock()
+	key := trackerKey(topic, id)
+	a, ok := t.alerts[key]
+	if !ok {
+		return false
+	}
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	delete(t.alerts, key)
+	return true
+}
+
+// Active : list active alerts of topic, all topics if topic is empty
+func (t *Tracker) Active(topic string) []ActiveAlert {
+	t.rw.RLock()
+	defer t.rw.RUnlock()
+	res := make([]ActiveAlert, 0)
+	for _, a := range t.alerts {
+		if topic == "" || a.Topic == topic {
+			res = append(res, *a)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].FirstTriggered.Before(res[j].FirstTriggered)
+	})
+	return res
+}
+
+// Stop : stop all timers, active alerts are kept
+func (t *Tracker) Stop() {
+	t.rw.Lock()
+	defer t.rw.Unlock()
+	for _, a := range t.alerts {
+		if a.timer != nil {
+			a.timer.Stop()
+			a.timer = nil
+		}
+	}
+}
+
+// notify : send message in background and schedule the next period, must hold the lock
+func (t *Tracker) notify(key string, a *ActiveAlert) {
+	a.Notified++
+	a.LastNotified = t.now()
+	go t.send(a.Topic, a.message)
+	t.schedule(key, a)
+}
+
+// schedule : must hold the lock
+func (t *Tracker) schedule(key string, a *ActiveAlert) {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	d := t.interval.Of(a.Level)
+	if d <= 0 {
+		return
+	}
+	if silenced := a.SilencedUntil.Sub(t.now()); silenced > d {
+		d = silenced
+	}
+	var tm timer
+	tm = t.after(d, func() {
+		t.rw.Lock()
+		defer t.rw.Unlock()
+		// alert has been resolved or rescheduled
+		if cur, ok := t.alerts[key]; !ok || cur.timer != tm {
+			return
+		}
+		t.notify(key, a)
+	})
+	a.timer = tm
+}
@@ -0,0 +1,113 @@
+package alert
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"time"
+)
+
+type testMessage string
+
+func (t testMessage) Title() string {
+	return string(t)
+}
+
+func (t testMessage) Content() string {
+	return string(t)
+}
+
+// fakeTimers : timers of tracker fired by the test instead of waiting
+type fakeTimers struct {
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	d       time.Duration
+	f       func()
+	stopped bool
+}
+
+func (f *fakeTimer) Stop() bool {
+	stopped := f.stopped
+	f.stopped = true
+	return !stopped
+}
+
+func newFakeTracker(interval RepeatInterval) (*Tracker, *fakeTimers, chan string) {
+	sent := make(chan string, 10)
+	tracker := NewTracker(interval, func(topic string, message Message) {
+		sent <- message.Title()
+	})
+	timers := &fakeTimers{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local)}
+	tracker.now = func() time.Time {
+		return timers.now
+	}
+	tracker.after = func(d time.Duration, f func()) timer {
+		ft := &fakeTimer{d: d, f: f}
+		timers.timers = append(timers.timers, ft)
+		return ft
+	}
+	return tracker, timers, sent
+}
+
+// fire : advance the clock to the last timer and run it, even if it is stopped
+func (f *fakeTimers) fire() *fakeTimer {
+	ft := f.timers[len(f.timers)-1]
+	f.now = f.now.Add(ft.d)
+	ft.f()
+	return ft
+}
+
+func TestTracker(t *testing.T) {
+	tracker, timers, sent := newFakeTracker(RepeatInterval{Alert: 20 * time.Millisecond})
+	tracker.Fire("topic", "1", AlertLevel, testMessage("a"))
+	assert.Equal(t, <-sent, "a")
+	// same level does not send immediately
+	tracker.Fire("topic", "1", AlertLevel, testMessage("b"))
+	assert.Equal(t, len(tracker.Active("topic")), 1)
+	assert.Equal(t, tracker.Active("topic")[0].Title, "b")
+	assert.Equal(t, tracker.Active("topic")[0].Notified, 1)
+	assert.Equal(t, len(timers.timers), 1)
+	assert.Equal(t, timers.timers[0].d, 20*time.Millisecond)
+
+	// repeated by period with the latest message
+	timers.fire()
+	assert.Equal(t, <-sent, "b")
+	timers.fire()
+	assert.Equal(t, <-sent, "b")
+	a := tracker.Active("topic")[0]
+	assert.Equal(t, a.Notified, 3)
+	assert.Equal(t, a.LastNotified, timers.now)
+	assert.Equal(t, len(timers.timers), 3)
+
+	assert.Equal(t, tracker.Resolve("topic", "1"), true)
+	assert.Equal(t, timers.timers[2].stopped, true)
+	// callback of a stopped timer which has already started does nothing
+	timers.fire()
+	assert.Equal(t, len(timers.timers), 3)
+	assert.Equal(t, len(tracker.Active("")), 0)
+	assert.Equal(t, tracker.Resolve("topic", "1"), false)
+	assert.Equal(t, len(sent), 0)
+}
+
+func TestTrackerSilence(t *testing.T) {
+	tracker, timers, sent := newFakeTracker(RepeatInterval{Warn: 20 * time.Millisecond})
+	tracker.Fire("topic", "1", WarnLevel, testMessage("a"))
+	assert.Equal(t, <-sent, "a")
+	assert.Equal(t, tracker.Silence("topic", "1", timers.now.Add(time.Hour)), true)
+	assert.Equal(t, tracker.Silence("topic", "2", timers.now.Add(time.Hour)), false)
+	// the repeat is delayed to the end of silence
+	assert.Equal(t, len(timers.timers), 2)
+	assert.Equal(t, timers.timers[0].stopped, true)
+	assert.Equal(t, timers.timers[1].d, time.Hour)
+	timers.timers[0].f()
+	assert.Equal(t, tracker.Active("topic")[0].Notified, 1)
+
+	// raised level breaks the silence
+	tracker.Fire("topic", "1", AlertLevel, testMessage("b"))
+	assert.Equal(t, <-sent, "b")
+	assert.Equal(t, tracker.Active("topic")[0].SilencedUntil.IsZero(), true)
+	assert.Equal(t, tracker.Active("topic")[0].Notified, 2)
+	assert.Equal(t, timers.timers[1].stopped, true)
+}
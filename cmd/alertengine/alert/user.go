@@ -0,0 +1,276 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// User : user with contact methods, each contact is a receiver
+type User struct {
+	Id       string    `json:"userId"`
+	Name     string    `json:"name"`
+	Contacts []BaseApi `json:"to"`
+}
+
+func (u User) Validate() error {
+	if u.Id == "" {
+		return errors.New("userId could not be empty")
+	}
+	_, err := newReceivers(u.Contacts)
+	return err
+}
+
+// UserSubscription : subscription of user to a project or a task of project.
+// Alerts below level are ignored, contacts of user are used if to is empty
+type UserSubscription struct {
+	UserId    string    `json:"userId"`
+	ProjectId string    `json:"projectId"`
+	TaskId    string    `json:"taskId"` // empty to subscribe all tasks of project
+	Level     Level     `json:"level"`  // minimum level
+	To        []BaseApi `json:"to,omitempty"`
+}
+
+func (s UserSubscription) Validate() error {
+	if s.UserId == "" || s.ProjectId == "" {
+		return errors.New("userId and projectId could not be empty")
+	}
+	if err := s.Level.Validate(); err != nil {
+		return err
+	}
+	_, err := newReceivers(s.To)
+	return err
+}
+
+func (s UserSubscription) key() string {
+	return s.UserId + "#" + s.ProjectId + "#" + s.TaskId
+}
+
+// matches : whether alert of project, task and level is subscribed
+func (s UserSubscription) matches(project, task string, level Level) bool {
+	return s.ProjectId == project && (s.TaskId == "" || s.TaskId == task) && level >= s.Level
+}
+
+// newReceivers : receivers of contacts, on-call is not a contact since it resolves to contacts of users
+func newReceivers(apis []BaseApi) ([]Receiver, error) {
+	rs := make([]Receiver, 0, len(apis))
+	for _, api := range apis {
+		if api.Type == OnCallType {
+			return nil, fmt.Errorf("%s could not be used as contact", OnCallType)
+		}
+		r, err := NewReceiver(api)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
+
+type userEntry struct {
+	user      User
+	receivers []Receiver
+}
+
+type subscriptionEntry struct {
+	sub       UserSubscription
+	receivers []Receiver
+}
+
+// Directory : users and their subscriptions, alerts are sent to contacts of users who subscribed the project or task
+type Directory struct {
+	users map[string]*userEntry
+	subs  map[string]*subscriptionEntry
+	rw    sync.RWMutex
+}
+
+func NewDirectory() *Directory {
+	return &Directory{
+		users: make(map[string]*userEntry),
+		subs:  make(map[string]*subscriptionEntry),
+	}
+}
+
+// SetUser : create or replace user
+func (d *Directory) SetUser(u User) error {
+	rs, err := newReceivers(u.Contacts)
+	if err != nil {
+		return err
+	}
+	d.rw.Lock()
+	defer d.rw.Unlock()
+	d.users[u.Id] = &userEntry{user: u, receivers: rs}
+	return nil
+}
+
+// DeleteUser : delete user and all of its subscriptions
+func (d *Directory) DeleteUser(id string) bool {
+	d.rw.Lock()
+	defer d.rw.Unlock()
+	if _, ok := d.users[id]; !ok {
+		return false
+	}
+	delete(d.users, id)
+	for key, e := range d.subs {
+		if e.sub.UserId == id {
+			delete(d.subs, key)
+		}
+	}
+	return true
+}
+
+func (d *Directory) User(id string) (User, bool) {
+	d.rw.RLock()
+	defer d.rw.RUnlock()
+	e, ok := d.users[id]
+	if !ok {
+		return User{}, false
+	}
+	return e.user, true
+}
+
+// Contacts : receivers of user's contacts, false if user not exists
+func (d *Directory) Contacts(id string) ([]Receiver, bool) {
+	d.rw.RLock()
+	defer d.rw.RUnlock()
+	e, ok := d.users[id]
+	if !ok {
+		return nil, false
+	}
+	return e.receivers, true
+}
+
+// Users : all users sorted by id
+func (d *Directory) Users() []User {
+	d.rw.RLock()
+	defer d.rw.RUnlock()
+	res := make([]User, 0, len(d.users))
+	for _, e := range d.users {
+		res = append(res, e.user)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Id < res[j].Id
+	})
+	return res
+}
+
+// Subscribe : create or replace subscription, the user must exist and have contacts if to of subscription is empty
+func (d *Directory) Subscribe(s UserSubscription) error {
+	rs, err := newReceivers(s.To)
+	if err != nil {
+		return err
+	}
+	d.rw.Lock()
+	defer d.rw.Unlock()
+	u, ok := d.users[s.UserId]
+	if !ok {
+		return fmt.Errorf("user %s not exists", s.UserId)
+	}
+	if len(rs) == 0 && len(u.receivers) == 0 {
+		return fmt.Errorf("user %s has no contact", s.UserId)
+	}
+	d.subs[s.key()] = &subscriptionEntry{sub: s, receivers: rs}
+	return nil
+}
+
+// Unsubscribe : delete subscription of user to project and task
+func (d *Directory) Unsubscribe(userId, projectId, taskId string) bool {
+	key := UserSubscription{UserId: userId, ProjectId: projectId, TaskId: taskId}.key()
+	d.rw.Lock()
+	defer d.rw.Unlock()
+	if _, ok := d.subs[key]; !ok {
+		return false
+	}
+	delete(d.subs, key)
+	return true
+}
+
+// Subscription : subscription of user to project and task
+func (d *Directory) Subscription(userId, projectId, taskId string) (UserSubscription, bool) {
+	key := UserSubscription{UserId: userId, ProjectId: projectId, TaskId: taskId}.key()
+	d.rw.RLock()
+	defer d.rw.RUnlock()
+	e, ok := d.subs[key]
+	if !ok {
+		return UserSubscription{}, false
+	}
+	return e.sub, true
+}
+
+// Subscriptions : subscriptions filtered by user, project and task, empty filters match all.
+// Sorted by project, task and user
+func (d *Directory) Subscriptions(userId, projectId, taskId string) []UserSubscription {
+	d.rw.RLock()
+	defer d.rw.RUnlock()
+	res := make([]UserSubscription, 0)
+	for _, e := range d.subs {
+		if (userId != "" && e.sub.UserId != userId) || (projectId != "" && e.sub.ProjectId != projectId) ||
+			(taskId != "" && e.sub.TaskId != taskId) {
+			continue
+		}
+		res = append(res, e.sub)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].ProjectId != res[j].ProjectId {
+			return res[i].ProjectId < res[j].ProjectId
+		}
+		if res[i].TaskId != res[j].TaskId {
+			return res[i].TaskId < res[j].TaskId
+		}
+		return res[i].UserId < res[j].UserId
+	})
+	return res
+}
+
+// Match : receivers of users who subscribed the project and task of labels, keyed by user id.
+// A user subscribed both the project and the task receives the alert once on each contact
+func (d *Directory) Match(labels map[string]string) map[string][]Receiver {
+	project, task := labels[ProjectLabel], labels[TaskLabel]
+	res := make(map[string][]Receiver)
+	if project == "" {
+		return res
+	}
+	level, err := ParseLevel(labels[LevelLabel])
+	if err != nil {
+		level = InfoLevel
+	}
+	d.rw.RLock()
+	defer d.rw.RUnlock()
+	seen := make(map[string]bool)
+	for _, e := range d.subs {
+		if !e.sub.matches(project, task, level) {
+			continue
+		}
+		rs := e.receivers
+		if len(rs) == 0 {
+			if u, ok := d.users[e.sub.UserId]; ok {
+				rs = u.receivers
+			}
+		}
+		for _, r := range rs {
+			key := e.sub.UserId + "#" + r.Api().Type + "#" + r.Id()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			res[e.sub.UserId] = append(res[e.sub.UserId], r)
+		}
+	}
+	return res
+}
+
+// Dispatch : send message to users who subscribed it, return the number of users
+func (d *Directory) Dispatch(message Message) int {
+	matched := d.Match(LabelsOf(message))
+	for userId, rs := range matched {
+		// errors are recorded by observers and failed deliveries are retried by queue
+		_ = sendAll(UserTopic(userId), rs, nil, nil, message)
+	}
+	return len(matched)
+}
+
+// UserTopic : topic of messages sent to user, used by delivery logs and dead letters
+func UserTopic(userId string) string {
+	return "user#" + userId
+}
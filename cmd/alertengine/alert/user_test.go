@@ -0,0 +1,41 @@
+package alert
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+)
+
+func TestDirectoryMatch(t *testing.T) {
+	d := NewDirectory()
+	alice := User{Id: "alice", Contacts: []BaseApi{{Type: WebhookType, Address: "http://localhost/alice"}}}
+	assert.Equal(t, d.SetUser(alice), nil)
+	assert.Equal(t, d.SetUser(User{Id: "bob"}), nil)
+
+	// bob has no contact, subscription without contacts is rejected
+	assert.NotEqual(t, d.Subscribe(UserSubscription{UserId: "bob", ProjectId: "3"}), nil)
+	assert.NotEqual(t, d.Subscribe(UserSubscription{UserId: "carol", ProjectId: "3"}), nil)
+	assert.Equal(t, d.Subscribe(UserSubscription{
+		UserId: "bob", ProjectId: "3", TaskId: "task", Level: AlertLevel,
+		To: []BaseApi{{Type: WebhookType, Address: "http://localhost/bob"}},
+	}), nil)
+	// alice subscribed both the project and the task, receives once
+	assert.Equal(t, d.Subscribe(UserSubscription{UserId: "alice", ProjectId: "3", Level: WarnLevel}), nil)
+	assert.Equal(t, d.Subscribe(UserSubscription{UserId: "alice", ProjectId: "3", TaskId: "task"}), nil)
+
+	matched := d.Match(Payload{ProjectId: "3", TaskId: "task", Level: AlertLevel}.LabelSet())
+	assert.Equal(t, len(matched), 2)
+	assert.Equal(t, len(matched["alice"]), 1)
+	assert.Equal(t, matched["bob"][0].Id(), "http://localhost/bob")
+
+	matched = d.Match(Payload{ProjectId: "3", TaskId: "other", Level: InfoLevel}.LabelSet())
+	assert.Equal(t, len(matched), 0)
+	matched = d.Match(Payload{ProjectId: "3", TaskId: "other", Level: WarnLevel}.LabelSet())
+	assert.Equal(t, len(matched["alice"]), 1)
+	assert.Equal(t, len(d.Match(map[string]string{TaskLabel: "task"})), 0)
+
+	assert.Equal(t, len(d.Subscriptions("alice", "", "")), 2)
+	assert.Equal(t, d.Unsubscribe("alice", "3", ""), true)
+	assert.Equal(t, len(d.Match(Payload{ProjectId: "3", TaskId: "other", Level: AlertLevel}.LabelSet())), 0)
+	assert.Equal(t, d.DeleteUser("bob"), true)
+	assert.Equal(t, len(d.Subscriptions("", "3", "")), 1)
+}
@@ -0,0 +1,85 @@
+package alert
+
+import (
+	"sync"
+	"time"
+)
+
+// Verification : result of sending a test message through receiver
+type Verification struct {
+	ReceiverId string    `json:"receiver_id"`
+	Type       string    `json:"type"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error"`
+	LatencyMs  int64     `json:"latency_ms"`
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+// TestPayload : message used to verify receivers
+func TestPayload() Payload {
+	p := SamplePayload()
+	p.Subject = "[测试] 告警接收器验证"
+	p.Level = InfoLevel
+	p.Description = "这是一条测试消息，用于验证接收器配置，请忽略"
+	return p
+}
+
+// VerifyReceivers : send test message rendered with templates through receivers concurrently, results are in the same order.
+// Throttles and retry queue are bypassed
+func VerifyReceivers(topic string, receivers []Receiver, templates map[string]Template) []Verification {
+	res := make([]Verification, len(receivers))
+	p := TestPayload()
+	var wg sync.WaitGroup
+	for i, r := range receivers {
+		wg.Add(1)
+		go func(i int, r Receiver) {
+			defer wg.Done()
+			start := time.Now()
+			err := Deliver(topic, r, render(topic, templates, r.Api().Type, p), 1)
+			res[i] = Verification{
+				ReceiverId: r.Id(),
+				Type:       r.Api().Type,
+				Success:    err == nil,
+				LatencyMs:  time.Since(start).Milliseconds(),
+				VerifiedAt: start,
+			}
+			if err != nil {
+				res[i].Error = err.Error()
+			}
+		}(i, r)
+	}
+	wg.Wait()
+	return res
+}
+
+// Verify : verify receiver of id or address, all receivers if id is empty. Results are recorded in Verified
+func (s *Subscribe) Verify(id string) []Verification {
+	s.rw.RLock()
+	receivers := make([]Receiver, 0, len(s.Receiver))
+	for _, r := range s.Receiver {
+		if id == "" || r.Id() == id || r.Api().Address == id {
+			receivers = append(receivers, r)
+		}
+	}
+	templates := make(map[string]Template, len(s.Templates))
+	for k, v := range s.Templates {
+		templates[k] = v
+	}
+	s.rw.RUnlock()
+
+	res := VerifyReceivers(s.Topic, receivers, templates)
+	for _, v := range res {
+		s.SetVerified(v)
+	}
+	return res
+}
+
+// SetVerified : record the last verification result of receiver
+func (s *Subscribe) SetVerified(v Verification) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	if s.Verified == nil {
+		s.Verified = make(map[string]Verification)
+	}
+	s.Verified[v.ReceiverId] = v
+}
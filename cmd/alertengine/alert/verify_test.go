@@ -0,0 +1,27 @@
+package alert
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	ok := &failReceiver{BaseApi: BaseApi{Type: WebhookType, Address: "ok"}}
+	bad := &failReceiver{BaseApi: BaseApi{Type: WebhookType, Address: "bad"}, fails: 1}
+	sub := &Subscribe{Topic: "topic", Receiver: []Receiver{ok, bad}}
+
+	res := sub.Verify("")
+	assert.Equal(t, len(res), 2)
+	assert.Equal(t, res[0].Success, true)
+	assert.Equal(t, res[1].Success, false)
+	assert.Equal(t, res[1].Error, "failed")
+	assert.Equal(t, sub.Verified["bad"].Success, false)
+
+	// the second attempt of bad succeeds
+	assert.Equal(t, sub.Verify("bad")[0].Success, true)
+	assert.Equal(t, sub.Verified["bad"].Success, true)
+	assert.Equal(t, len(sub.Verify("none")), 0)
+
+	sub.UpdateReceiver([]Receiver{ok})
+	assert.Equal(t, len(sub.Verifications()), 1)
+}
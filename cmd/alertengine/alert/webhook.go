@@ -0,0 +1,119 @@
+package alert
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// default body of webhook
+const defaultWebhookBody = `{"title": {{json .Title}}, "content": {{json .Content}}{{if .Payload}}, "payload": {{json .Payload}}{{end}}}`
+
+const (
+	SignatureHeader = "X-Alert-Signature"
+	TimestampHeader = "X-Alert-Timestamp"
+)
+
+var webhookFuncs = template.FuncMap{
+	// json : encode value as json, use it to quote strings in body template
+	"json": func(v interface{}) (string, error) {
+		content, err := json.Marshal(v)
+		return string(content), err
+	},
+}
+
+// Webhook : generic http webhook
+// Address  url of webhook
+// Token    secret of HMAC-SHA256 signature, no signature if empty. the hex signature of "timestamp\nbody"
+// is set to header X-Alert-Signature and the unix timestamp is set to X-Alert-Timestamp
+// Method   http method, default POST
+// Headers  extra headers
+// Body     text/template of body, message is provided as .Title and .Content, structured alert as .Payload
+// (nil for plain message), template function json can be used to encode them, for example {"text": {{json .Content}}}
+type Webhook struct {
+	BaseApi
+}
+
+func (w Webhook) Id() string {
+	return ReceiverId(WebhookType, w.Address)
+}
+
+func (w Webhook) method() string {
+	if w.Method == "" {
+		return http.MethodPost
+	}
+	return strings.ToUpper(w.Method)
+}
+
+func (w Webhook) template() (*template.Template, error) {
+	body := w.Body
+	if body == "" {
+		body = defaultWebhookBody
+	}
+	return template.New("webhook").Funcs(webhookFuncs).Parse(body)
+}
+
+func (w Webhook) Validate() error {
+	if err := validateUrl(w.Address); err != nil {
+		return err
+	}
+	switch w.method() {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("method must in [POST, PUT, PATCH]")
+	}
+	if _, err := w.template(); err != nil {
+		return fmt.Errorf("invalid body template: %s", err.Error())
+	}
+	return nil
+}
+
+func (w Webhook) Message(message Message) error {
+	tpl, err := w.template()
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	data := map[string]interface{}{
+		"Title":   message.Title(),
+		"Content": message.Content(),
+		"Payload": nil,
+	}
+	if structured, ok := message.(Structured); ok {
+		data["Payload"] = structured.Data()
+	}
+	if err := tpl.Execute(&body, data); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(w.method(), w.Address, bytes.NewReader(body.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	if w.Token != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(w.Token, timestamp, body.Bytes()))
+	}
+	_, err = doRequest(req)
+	return err
+}
+
+// Sign : HMAC-SHA256 signature of webhook body, receivers can use it to verify the request
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,58 @@
+package alert
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhook(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	w := Webhook{BaseApi{Type: WebhookType, Address: srv.URL + "/hook", Token: "secret",
+		Options: Options{Method: "put", Headers: map[string]string{"X-Project": "p1"}}}}
+	assert.Equal(t, w.Validate(), nil)
+	p := SamplePayload()
+	assert.Equal(t, w.Message(p), nil)
+	assert.Equal(t, req.Method, http.MethodPut)
+	assert.Equal(t, req.Header.Get("Content-Type"), "application/json")
+	assert.Equal(t, req.Header.Get("X-Project"), "p1")
+
+	// signature is hex of HMAC-SHA256 of "timestamp\nbody"
+	timestamp := req.Header.Get(TimestampHeader)
+	assert.NotEqual(t, timestamp, "")
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(timestamp + "\n"))
+	mac.Write(body)
+	assert.Equal(t, req.Header.Get(SignatureHeader), hex.EncodeToString(mac.Sum(nil)))
+	assert.Equal(t, Sign("secret", timestamp, body), req.Header.Get(SignatureHeader))
+
+	var m map[string]interface{}
+	assert.Equal(t, json.Unmarshal(body, &m), nil)
+	assert.Equal(t, m["title"], p.Title())
+	assert.Equal(t, m["content"], p.Content())
+	assert.Equal(t, m["payload"].(map[string]interface{})["task_id"], p.TaskId)
+
+	// plain message without payload and signature, custom body
+	w.Token, w.Body = "", `{"text": {{json .Title}}}`
+	assert.Equal(t, w.Message(testMessage("hello \"world\"")), nil)
+	assert.Equal(t, req.Header.Get(SignatureHeader), "")
+	assert.Equal(t, string(body), `{"text": "hello \"world\""}`)
+
+	status = http.StatusInternalServerError
+	assert.NotEqual(t, w.Message(testMessage("hello")), nil)
+}
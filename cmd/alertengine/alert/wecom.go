@@ -0,0 +1,57 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const weComWebhook = "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=%s"
+
+// WeCom : 企业微信群机器人
+// Address  key of robot or the whole webhook url
+type WeCom struct {
+	BaseApi
+}
+
+func (w WeCom) Id() string {
+	return ReceiverId(WeComType, w.Address)
+}
+
+func (w WeCom) url() string {
+	if strings.HasPrefix(w.Address, "http://") || strings.HasPrefix(w.Address, "https://") {
+		return w.Address
+	}
+	return fmt.Sprintf(weComWebhook, w.Address)
+}
+
+func (w WeCom) Validate() error {
+	if w.Address == "" {
+		return fmt.Errorf("address could not be empty")
+	}
+	return validateUrl(w.url())
+}
+
+func (w WeCom) Message(message Message) error {
+	payload := map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"content": fmt.Sprintf("### %s\n%s", message.Title(), message.Content()),
+		},
+	}
+	body, err := postJson(w.url(), payload)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("wecom robot error %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
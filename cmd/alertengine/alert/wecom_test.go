@@ -0,0 +1,41 @@
+package alert
+
+import (
+	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWeCom(t *testing.T) {
+	var key string
+	var m map[string]interface{}
+	result := `{"errcode": 0, "errmsg": "ok"}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.URL.Query().Get("key")
+		m = nil
+		_ = json.NewDecoder(r.Body).Decode(&m)
+		_, _ = w.Write([]byte(result))
+	}))
+	defer srv.Close()
+
+	w := WeCom{BaseApi{Type: WeComType, Address: srv.URL + "/cgi-bin/webhook/send?key=abc"}}
+	assert.Equal(t, w.Validate(), nil)
+	assert.Equal(t, w.Message(RenderedMessage{Subject: "告警", Body: "内容"}), nil)
+	assert.Equal(t, key, "abc")
+	assert.Equal(t, m["msgtype"], "markdown")
+	assert.Equal(t, m["markdown"], map[string]interface{}{"content": "### 告警\n内容"})
+
+	// key of robot without url
+	assert.Equal(t, WeCom{BaseApi{Type: WeComType, Address: "abc"}}.url(), "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=abc")
+
+	result = `{"errcode": 93000, "errmsg": "invalid webhook url"}`
+	err := w.Message(RenderedMessage{Subject: "告警", Body: "内容"})
+	assert.NotEqual(t, err, nil)
+	assert.Equal(t, strings.Contains(err.Error(), "93000"), true)
+	// invalid response
+	result = `not json`
+	assert.NotEqual(t, w.Message(RenderedMessage{Subject: "告警", Body: "内容"}), nil)
+}
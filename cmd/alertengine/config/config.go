@@ -1,41 +1,60 @@
 package config
 
 import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/pkg/influxdb"
 	"anomaly-detect/pkg/mysql"
-	"fmt"
 	"gopkg.in/yaml.v2"
 	"os"
-	"strings"
+	"time"
 )
 
-type SmtpService struct {
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	Account  string `yaml:"account"`
-	Password string `yaml:"password"`
+// SmtpService : smtp server of email receivers, host could be a hostname or an ip
+type SmtpService = alert.SmtpOptions
+
+// PubSub : receive alerts from dapr pub/sub component
+type PubSub struct {
+	Name string `yaml:"name"` // pubsub component name, disabled if empty
+	// pubsub topic -> subscribe topic. Events are delivered to the mapped subscribe topic if it is not empty,
+	// otherwise to the topic in event data or the pubsub topic itself
+	Topics map[string]string `yaml:"topics"`
 }
 
-func (s SmtpService) Validate() error {
-	if len(strings.Split(s.Host, ".")) != 4 {
-		return fmt.Errorf("invalid smtp host")
-	}
-	if s.Port <= 0 || s.Port > 65535 {
-		return fmt.Errorf("invalid smtp port")
-	}
-	if s.Account == "" {
-		return fmt.Errorf("invalid smtp account")
-	}
-	if s.Password == "" {
-		return fmt.Errorf("invalid smtp password")
-	}
-	return nil
+// Chart : sparkline of the alerting series embedded in notifications
+type Chart struct {
+	Enable      bool          `yaml:"enable"`
+	Measurement string        `yaml:"measurement"`
+	Field       string        `yaml:"field"`
+	Before      time.Duration `yaml:"before"` // range before the start of alert
+	After       time.Duration `yaml:"after"`  // range after the stop of alert
+	Width       int           `yaml:"width"`
+	Height      int           `yaml:"height"`
+	BaseUrl     string        `yaml:"baseUrl"` // external address for chart links, use ack.baseUrl if empty
+	Expire      time.Duration `yaml:"expire"`  // how long the chart links are available
+}
+
+// Browser : push alerts to browsers by server-sent events
+type Browser struct {
+	Tokens map[string]string `yaml:"tokens"` // client name -> token, the stream is disabled if empty
+	Buffer int               `yaml:"buffer"` // latest events kept for replay after reconnection
 }
 
 type Config struct {
-	Mysql mysql.Account `yaml:"mysql"`
-	Smtp  SmtpService   `yaml:"smtp"`
+	Mysql    mysql.Account        `yaml:"mysql"`
+	Smtp     SmtpService          `yaml:"smtp"`
+	Repeat   alert.RepeatInterval `yaml:"repeat"`   // 周期告警的周期, 为 0 时不重复推送
+	Retry    alert.RetryPolicy    `yaml:"retry"`    // 推送失败的重试策略
+	Ack      alert.AckSigner      `yaml:"ack"`      // 告警确认链接签名, 未配置时消息中不附带确认链接
+	PubSub   PubSub               `yaml:"pubsub"`   // 通过 dapr pub/sub 接收告警
+	Influxdb influxdb.Account     `yaml:"influxdb"` // 用于查询告警序列绘制趋势图
+	Chart    Chart                `yaml:"chart"`    // 告警消息中的趋势图
+	Secret   alert.SecretOptions  `yaml:"secret"`   // 接收器密钥 (token 等) 的加密密钥, 可由环境变量 SecretKeysEnv 覆盖
+	Browser  Browser              `yaml:"browser"`  // 浏览器实时推送
 }
 
+// SecretKeysEnv : keys of receiver secrets in format "id:key,id:key", the first key encrypts
+const SecretKeysEnv = "ALERTENGINE_SECRET_KEYS"
+
 func (c Config) Validate() error {
 	if err := c.Mysql.Validate(); err != nil {
 		return err
@@ -43,17 +62,51 @@ func (c Config) Validate() error {
 	if err := c.Smtp.Validate(); err != nil {
 		return err
 	}
+	if err := c.Secret.Validate(); err != nil {
+		return err
+	}
+	if err := c.Retry.Validate(); err != nil {
+		return err
+	}
+	if c.Chart.Enable {
+		if err := c.Influxdb.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func ParseYaml(path string) (*Config, error) {
-	conf := &Config{}
+	conf := &Config{
+		Smtp:   alert.DefaultSmtpOptions,
+		Repeat: alert.DefaultRepeatInterval,
+		Retry:  alert.DefaultRetryPolicy,
+		Ack:    alert.AckSigner{Expire: 24 * time.Hour},
+		Chart: Chart{
+			Measurement: "sensor_data",
+			Field:       "value",
+			Before:      time.Hour,
+			After:       10 * time.Minute,
+			Width:       600,
+			Height:      160,
+			Expire:      24 * time.Hour,
+		},
+		Browser: Browser{Buffer: alert.DefaultHubBuffer},
+	}
 	if f, err := os.Open(path); err != nil {
 		return nil, err
 	} else {
 		if err = yaml.NewDecoder(f).Decode(conf); err != nil {
 			return nil, err
 		}
+		if err = conf.Retry.Validate(); err != nil {
+			return nil, err
+		}
+		if v := os.Getenv(SecretKeysEnv); v != "" {
+			if conf.Secret.Keys, err = alert.ParseSecretKeys(v); err != nil {
+				return nil, err
+			}
+		}
 		return conf, nil
 	}
 }
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"anomaly-detect/cmd/alertengine/model"
+	"anomaly-detect/pkg/influxdb"
+	"anomaly-detect/pkg/mysql"
+	"fmt"
+	"sync"
+)
+
+var (
+	MysqlClient    *mysql.Connector
+	InfluxdbClient *influxdb.Connector // only used by charts, nil if charts are disabled
+	mysqlOnce      = &sync.Once{}
+	influxOnce     = &sync.Once{}
+)
+
+func InitMysqlClient(c mysql.Account) {
+	mysqlOnce.Do(func() {
+		conn, err := mysql.NewConnector(c.Address, c.Database, c.Username, c.Password)
+		if err != nil {
+			panic(fmt.Errorf("init mysql conn failed %s", err.Error()))
+		}
+		MysqlClient = conn
+	})
+}
+
+func InitInfluxdbClient(c influxdb.Account) {
+	influxOnce.Do(func() {
+		conn, err := influxdb.NewConnector(c.Address, c.Bucket, c.Token, c.Org)
+		if err != nil {
+			panic(fmt.Errorf("init influxdb conn failed %s", err.Error()))
+		}
+		InfluxdbClient = conn
+	})
+}
+
+func InfluxdbClientClose() {
+	if InfluxdbClient != nil {
+		InfluxdbClient.Close()
+	}
+}
+
+// MysqlClientClose : close connections of mysql, called after server stopped
+func MysqlClientClose() {
+	if MysqlClient == nil {
+		return
+	}
+	if sqlDB, err := MysqlClient.DB.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+}
+
+func Init() {
+	// init table
+	if MysqlClient == nil {
+		panic("mysql client has not init")
+	}
+	tables := []interface{}{
+		&model.Subscribe{},
+		&model.Receiver{},
+		&model.Template{},
+		&model.DeadLetter{},
+		&model.DeliveryLog{},
+		&model.Escalation{},
+		&model.Route{},
+		&model.Verification{},
+		&model.User{},
+		&model.UserSubscription{},
+		&model.Schedule{},
+		&model.InhibitRule{},
+		&model.Inhibited{},
+	}
+	// AutoMigrate only creates missing tables and columns, existing data is kept
+	if err := MysqlClient.DB.AutoMigrate(tables...); err != nil {
+		panic(fmt.Sprintf("cannot migrate database: %s", err.Error()))
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"anomaly-detect/cmd/alertengine/alert"
 	"anomaly-detect/cmd/alertengine/config"
+	"anomaly-detect/cmd/alertengine/db"
 	"anomaly-detect/cmd/alertengine/server"
 	"flag"
 	"fmt"
@@ -30,15 +31,44 @@ func main() {
 		return
 	}
 
-	alert.InitMail(conf.Smtp.Host, conf.Smtp.Port, conf.Smtp.Account, conf.Smtp.Password)
+	// init mysql connector
+	db.InitMysqlClient(conf.Mysql)
+	logrus.Infof("init mysql success using config database:%s username:%s url:%s",
+		conf.Mysql.Database,
+		conf.Mysql.Username,
+		conf.Mysql.Address,
+	)
+	db.Init()
+	defer db.MysqlClientClose()
+
+	// init influxdb connector, only used by charts
+	if conf.Chart.Enable {
+		db.InitInfluxdbClient(conf.Influxdb)
+		defer db.InfluxdbClientClose()
+		logrus.Infof("init influxdb success using config url:%s bucket:%s", conf.Influxdb.Address, conf.Influxdb.Bucket)
+	}
+
+	if err := alert.InitMail(conf.Smtp); err != nil {
+		logrus.Errorf("server start failed: %s", err.Error())
+		return
+	}
+
+	if err := alert.InitSecrets(conf.Secret); err != nil {
+		logrus.Errorf("server start failed: %s", err.Error())
+		return
+	}
+	if !alert.SecretsEncrypted() {
+		logrus.Warnf("no secret key configured, secrets of receivers are saved in plain text")
+	}
 
 	exit := make(chan error)      // internal exit signal, cause by program error
 	sg := make(chan os.Signal, 1) // external interrupt signal, send by user
 	signal.Notify(sg, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
-	serv := server.NewServer(exit)
+	serv := server.NewServer(conf, exit)
 	go serv.Start()
 
+	// subscribes are saved by Stop after in-flight requests finish
 	select {
 	case info := <-sg:
 		serv.Stop()
@@ -0,0 +1,189 @@
+package model
+
+import "time"
+
+type Subscribe struct {
+	Topic         string    `gorm:"column:topic;primaryKey;not null" json:"topic"`
+	Triggered     int       `gorm:"column:triggered;not null" json:"triggered"`
+	LastTriggered time.Time `gorm:"column:last_triggered" json:"last_triggered"`
+	Throttle      string    `gorm:"column:throttle;type:text" json:"throttle"` // json of alert.Throttle, empty if not set
+	Digest        string    `gorm:"column:digest" json:"digest"`               // digest period, empty if disabled
+	CreatedAt     time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (s Subscribe) TableName() string {
+	return "alert_subscribe"
+}
+
+type Receiver struct {
+	ID      int    `gorm:"column:id;primaryKey;not null;autoIncrement" json:"id"`
+	Topic   string `gorm:"column:topic;not null;index" json:"topic"`
+	Type    string `gorm:"column:type;not null" json:"type"`
+	Address string `gorm:"column:address;not null" json:"address"`
+	Token   string `gorm:"column:token" json:"token"`
+	Options string `gorm:"column:options;type:text" json:"options"` // json of alert.Options
+}
+
+func (r Receiver) TableName() string {
+	return "alert_receiver"
+}
+
+type Template struct {
+	Topic   string `gorm:"column:topic;primaryKey;not null" json:"topic"`
+	Type    string `gorm:"column:type;primaryKey;not null" json:"type"` // receiver type
+	Subject string `gorm:"column:subject;type:text;not null" json:"subject"`
+	Body    string `gorm:"column:body;type:text;not null" json:"body"`
+	Html    bool   `gorm:"column:html;not null" json:"html"`
+}
+
+func (t Template) TableName() string {
+	return "alert_template"
+}
+
+// DeadLetter : delivery which still failed after max attempts
+type DeadLetter struct {
+	ID        int       `gorm:"column:id;primaryKey;not null;autoIncrement" json:"id"`
+	Topic     string    `gorm:"column:topic;not null;index" json:"topic"`
+	Type      string    `gorm:"column:type;not null" json:"type"` // receiver type
+	Address   string    `gorm:"column:address;not null" json:"address"`
+	Token     string    `gorm:"column:token" json:"-"`
+	Options   string    `gorm:"column:options;type:text" json:"-"`
+	Subject   string    `gorm:"column:subject;type:text" json:"subject"`
+	Body      string    `gorm:"column:body;type:text" json:"body"`
+	Payload   string    `gorm:"column:payload;type:text" json:"payload"` // json of alert.Payload, empty for plain message
+	Attempts  int       `gorm:"column:attempts;not null" json:"attempts"`
+	LastError string    `gorm:"column:last_error;type:text" json:"last_error"`
+	CreatedAt time.Time `gorm:"column:created_at;index" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (d DeadLetter) TableName() string {
+	return "alert_dead_letter"
+}
+
+// DeliveryLog : audit log of every delivery attempt
+type DeliveryLog struct {
+	ID           int       `gorm:"column:id;primaryKey;not null;autoIncrement" json:"id"`
+	Topic        string    `gorm:"column:topic;not null;index" json:"topic"`
+	ReceiverId   string    `gorm:"column:receiver_id;not null;index" json:"receiver_id"`
+	ReceiverType string    `gorm:"column:receiver_type;not null" json:"receiver_type"`
+	MessageHash  string    `gorm:"column:message_hash;not null" json:"message_hash"`
+	Attempt      int       `gorm:"column:attempt;not null" json:"attempt"`
+	Success      bool      `gorm:"column:success;not null" json:"success"`
+	Error        string    `gorm:"column:error;type:text" json:"error"`
+	LatencyMs    int64     `gorm:"column:latency_ms;not null" json:"latency_ms"`
+	CreatedAt    time.Time `gorm:"column:created_at;not null;index" json:"created_at"`
+}
+
+func (d DeliveryLog) TableName() string {
+	return "alert_delivery_log"
+}
+
+// Escalation : escalation policy of topic
+type Escalation struct {
+	Topic     string    `gorm:"column:topic;primaryKey;not null" json:"topic"`
+	Tiers     string    `gorm:"column:tiers;type:text;not null" json:"tiers"` // json of []alert.Tier
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (e Escalation) TableName() string {
+	return "alert_escalation"
+}
+
+// Route : top level route of routing tree, child routes are stored in content
+type Route struct {
+	ID        int       `gorm:"column:id;primaryKey;not null;autoIncrement" json:"id"`
+	Position  int       `gorm:"column:position;not null" json:"position"` // order of top level routes
+	Name      string    `gorm:"column:name;not null" json:"name"`
+	Content   string    `gorm:"column:content;type:text;not null" json:"content"` // json of alert.Route
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (r Route) TableName() string {
+	return "alert_route"
+}
+
+// Verification : the last verification result of receiver
+type Verification struct {
+	Topic      string    `gorm:"column:topic;primaryKey;not null" json:"topic"`
+	ReceiverId string    `gorm:"column:receiver_id;primaryKey;not null" json:"receiver_id"`
+	Type       string    `gorm:"column:type;not null" json:"type"`
+	Success    bool      `gorm:"column:success;not null" json:"success"`
+	Error      string    `gorm:"column:error;type:text" json:"error"`
+	LatencyMs  int64     `gorm:"column:latency_ms;not null" json:"latency_ms"`
+	VerifiedAt time.Time `gorm:"column:verified_at" json:"verified_at"`
+}
+
+func (v Verification) TableName() string {
+	return "alert_verification"
+}
+
+// User : user with contact methods
+type User struct {
+	ID        string    `gorm:"column:id;primaryKey;not null" json:"id"`
+	Name      string    `gorm:"column:name" json:"name"`
+	Contacts  string    `gorm:"column:contacts;type:text;not null" json:"contacts"` // json of []alert.BaseApi
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (u User) TableName() string {
+	return "alert_user"
+}
+
+// UserSubscription : subscription of user to project or task, empty task_id means all tasks of project
+type UserSubscription struct {
+	UserId    string    `gorm:"column:user_id;primaryKey;not null" json:"user_id"`
+	ProjectId string    `gorm:"column:project_id;primaryKey;not null" json:"project_id"`
+	TaskId    string    `gorm:"column:task_id;primaryKey;not null" json:"task_id"`
+	Level     int       `gorm:"column:level;not null" json:"level"`     // minimum level
+	To        string    `gorm:"column:to_contacts;type:text" json:"to"` // json of []alert.BaseApi, empty to use contacts of user
+	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (s UserSubscription) TableName() string {
+	return "alert_user_subscription"
+}
+
+// Schedule : on-call schedule
+type Schedule struct {
+	Name      string    `gorm:"column:name;primaryKey;not null" json:"name"`
+	Content   string    `gorm:"column:content;type:text;not null" json:"content"` // json of alert.Schedule
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (s Schedule) TableName() string {
+	return "alert_schedule"
+}
+
+// InhibitRule : inhibit rules are replaced as a whole
+type InhibitRule struct {
+	ID        int       `gorm:"column:id;primaryKey;not null;autoIncrement" json:"id"`
+	Position  int       `gorm:"column:position;not null" json:"position"`
+	Name      string    `gorm:"column:name;not null" json:"name"`
+	Content   string    `gorm:"column:content;type:text;not null" json:"content"` // json of alert.InhibitRule
+	UpdatedAt time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+func (r InhibitRule) TableName() string {
+	return "alert_inhibit_rule"
+}
+
+// Inhibited : message suppressed by inhibit rule instead of being delivered
+type Inhibited struct {
+	ID           int       `gorm:"column:id;primaryKey;not null;autoIncrement" json:"id"`
+	Topic        string    `gorm:"column:topic;not null;index" json:"topic"`
+	Title        string    `gorm:"column:title;type:text" json:"title"`
+	Labels       string    `gorm:"column:labels;type:text" json:"labels"` // json of labels of the message
+	Rule         string    `gorm:"column:rule;not null" json:"rule"`
+	SourceTopic  string    `gorm:"column:source_topic;not null" json:"source_topic"`
+	SourceId     string    `gorm:"column:source_id;not null" json:"source_id"`
+	SourceLabels string    `gorm:"column:source_labels;type:text" json:"source_labels"`
+	CreatedAt    time.Time `gorm:"column:created_at;index" json:"created_at"`
+}
+
+func (i Inhibited) TableName() string {
+	return "alert_inhibited"
+}
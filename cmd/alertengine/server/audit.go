@@ -0,0 +1,146 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/model"
+	"anomaly-detect/cmd/alertengine/store"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	auditBufferSize    = 4096
+	auditBatchSize     = 100
+	auditFlushInterval = time.Second
+)
+
+// auditLog : write delivery attempts to mysql in batches
+type auditLog struct {
+	ch       chan model.DeliveryLog
+	save     func([]model.DeliveryLog) error // store.SaveDeliveryLogs
+	interval time.Duration                   // logs are flushed at least once per interval
+	wg       sync.WaitGroup
+	closed   bool
+	rw       sync.RWMutex
+}
+
+func newAuditLog(save func([]model.DeliveryLog) error, interval time.Duration) *auditLog {
+	a := &auditLog{ch: make(chan model.DeliveryLog, auditBufferSize), save: save, interval: interval}
+	a.wg.Add(1)
+	go a.run()
+	return a
+}
+
+// pending : logs waiting to be written
+func (a *auditLog) pending() int {
+	return len(a.ch)
+}
+
+// observe : used as alert.Observer, drop the log if buffer is full instead of blocking delivery
+func (a *auditLog) observe(attempt alert.Attempt) {
+	record := model.DeliveryLog{
+		Topic:        attempt.Topic,
+		ReceiverId:   attempt.ReceiverId,
+		ReceiverType: attempt.ReceiverType,
+		MessageHash:  attempt.MessageHash,
+		Attempt:      attempt.Attempt,
+		Success:      attempt.Error == nil,
+		LatencyMs:    attempt.Latency.Milliseconds(),
+		CreatedAt:    attempt.Time,
+	}
+	if attempt.Error != nil {
+		record.Error = attempt.Error.Error()
+	}
+	a.rw.RLock()
+	defer a.rw.RUnlock()
+	if a.closed {
+		return
+	}
+	select {
+	case a.ch <- record:
+	default:
+		logrus.Warnf("audit log buffer is full, drop log of %s to %s", record.Topic, record.ReceiverId)
+	}
+}
+
+func (a *auditLog) run() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	batch := make([]model.DeliveryLog, 0, auditBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := a.save(batch); err != nil {
+			logrus.Errorf("save %d delivery logs failed: %s", len(batch), err.Error())
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case record, ok := <-a.ch:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= auditBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close : flush pending logs
+func (a *auditLog) Close() {
+	a.rw.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.ch)
+	}
+	a.rw.Unlock()
+	a.wg.Wait()
+}
+
+// get delivery history
+// params: topic receiver success(true/false) start end limit type.
+// receiver is id of receiver, or address if type is set, which is converted to id since secret addresses are hashed
+func (s *Server) getDelivery(resp http.ResponseWriter, req *http.Request) {
+	start, stop, err := parseTimeRange(req)
+	if err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "invalid time: " + err.Error()})
+		return
+	}
+	limit, err := parseLimit(req)
+	if err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "invalid limit"})
+		return
+	}
+	var success *bool
+	if v := req.URL.Query().Get("success"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": "success must be true or false"})
+			return
+		}
+		success = &b
+	}
+	q := req.URL.Query()
+	receiver := q.Get("receiver")
+	if t := q.Get("type"); t != "" && receiver != "" {
+		receiver = alert.ReceiverId(t, receiver)
+	}
+	records, err := store.GetDeliveryLogs(q.Get("topic"), receiver, success, start, stop, limit)
+	if err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": records})
+}
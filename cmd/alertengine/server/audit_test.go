@@ -0,0 +1,61 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/model"
+	"errors"
+	"github.com/go-playground/assert/v2"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	var mu sync.Mutex
+	var batches []int
+	var saved []model.DeliveryLog
+	// logs are flushed only by batch size and close
+	a := newAuditLog(func(logs []model.DeliveryLog) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, len(logs))
+		saved = append(saved, logs...)
+		return nil
+	}, time.Hour)
+
+	ding := alert.DingTalk{BaseApi: alert.BaseApi{Type: alert.DingTalkType, Address: "access"}}
+	for i := 0; i < 2*auditBatchSize+50; i++ {
+		attempt := alert.Attempt{Topic: "topic", ReceiverId: ding.Id(), ReceiverType: alert.DingTalkType, Attempt: 1}
+		if i == 0 {
+			attempt.Error = errors.New("failed")
+		}
+		a.observe(attempt)
+	}
+	a.Close()
+	// logs after close are dropped, close again does nothing
+	a.observe(alert.Attempt{Topic: "topic"})
+	a.Close()
+
+	assert.Equal(t, batches, []int{auditBatchSize, auditBatchSize, 50})
+	assert.Equal(t, len(saved), 2*auditBatchSize+50)
+	assert.Equal(t, saved[0].Success, false)
+	assert.Equal(t, saved[0].Error, "failed")
+	assert.Equal(t, saved[1].Success, true)
+	assert.Equal(t, saved[1].ReceiverId, alert.ReceiverId(alert.DingTalkType, "access"))
+	assert.Equal(t, strings.Contains(saved[1].ReceiverId, "access"), false)
+}
+
+func TestParseLimit(t *testing.T) {
+	cases := map[string]int{"": defaultQueryLimit, "?limit=1": 1, "?limit=1000": maxQueryLimit}
+	for query, expect := range cases {
+		limit, err := parseLimit(httptest.NewRequest("GET", "/delivery"+query, nil))
+		assert.Equal(t, err, nil)
+		assert.Equal(t, limit, expect)
+	}
+	for _, query := range []string{"?limit=0", "?limit=-1", "?limit=1001", "?limit=a"} {
+		_, err := parseLimit(httptest.NewRequest("GET", "/delivery"+query, nil))
+		assert.NotEqual(t, err, nil)
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/config"
+	"anomaly-detect/cmd/alertengine/db"
+	"anomaly-detect/pkg/chart"
+	"anomaly-detect/pkg/influxdb"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	chartQueryTimeout = 5 * time.Second
+	chartPoints       = 120 // number of aggregate windows of chart
+)
+
+type chartItem struct {
+	data   []byte
+	expire time.Time
+}
+
+// chartCache : charts kept in memory, served by chart links in messages
+type chartCache struct {
+	conf  config.Chart
+	items map[string]chartItem
+	mu    sync.Mutex
+}
+
+func newChartCache(conf config.Chart) *chartCache {
+	return &chartCache{conf: conf, items: make(map[string]chartItem)}
+}
+
+// put : save chart and return its id, expired charts are removed
+func (c *chartCache) put(data []byte) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	id := hex.EncodeToString(b)
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, item := range c.items {
+		if now.After(item.expire) {
+			delete(c.items, k)
+		}
+	}
+	c.items[id] = chartItem{data: data, expire: now.Add(c.conf.Expire)}
+	return id
+}
+
+func (c *chartCache) get(id string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[id]
+	if !ok || time.Now().After(item.expire) {
+		return nil, false
+	}
+	return item.data, true
+}
+
+func escapeFlux(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// chartFlux : query series of sensor in payload between start and stop
+func chartFlux(bucket string, conf config.Chart, p alert.Payload, start, stop time.Time) string {
+	every := stop.Sub(start) / chartPoints
+	if every < time.Second {
+		every = time.Second
+	}
+	filters := []string{
+		fmt.Sprintf(influxdb.MeasurementSnippet, escapeFlux(conf.Measurement)),
+		fmt.Sprintf(influxdb.FieldSnippet, escapeFlux(conf.Field)),
+	}
+	for _, tag := range [][2]string{
+		{"project_id", p.ProjectId}, {"sensor_mac", p.SensorMac}, {"sensor_type", p.SensorType}, {"receive_no", p.ReceiveNo},
+	} {
+		if tag[1] != "" {
+			filters = append(filters, fmt.Sprintf(influxdb.TagSnippet, tag[0], escapeFlux(tag[1])))
+		}
+	}
+	return strings.Join([]string{
+		fmt.Sprintf(influxdb.BucketSnippet, escapeFlux(bucket)),
+		fmt.Sprintf(influxdb.TimeRangeSnippet, start.UTC().Format(time.RFC3339), stop.UTC().Format(time.RFC3339)),
+		fmt.Sprintf(influxdb.FilterSnippet, strings.Join(filters, " and ")),
+		fmt.Sprintf(influxdb.AggregateSnippet, fmt.Sprintf("%ds", int(every.Seconds())), "mean", true),
+	}, "\n")
+}
+
+// attachChart : render sparkline of the series around the alert, failures are only logged
+func (s *Server) attachChart(p *alert.Payload) {
+	if s.charts == nil || db.InfluxdbClient == nil || p.SensorMac == "" {
+		return
+	}
+	conf := s.charts.conf
+	stop := p.Stop
+	if stop.IsZero() {
+		stop = time.Now()
+	}
+	start := p.Start
+	if start.IsZero() || start.After(stop) {
+		start = stop
+	}
+	start, stop = start.Add(-conf.Before), stop.Add(conf.After)
+	if now := time.Now(); stop.After(now) {
+		stop = now
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), chartQueryTimeout)
+	defer cancel()
+	series, err := db.InfluxdbClient.QueryMultiple(chartFlux(db.InfluxdbClient.Bucket, conf, *p, start, stop), ctx)
+	if err != nil || len(series.Columns) == 0 {
+		if err == nil {
+			err = fmt.Errorf("no data")
+		}
+		logrus.Errorf("query chart of %s %s failed: %s", p.SensorMac, p.SensorType, err.Error())
+		return
+	}
+	sp := chart.Sparkline{
+		Width:  conf.Width,
+		Height: conf.Height,
+		Time:   series.Time,
+		Values: series.Value[series.Columns[0]],
+		Start:  p.Start,
+		Stop:   p.Stop,
+	}
+	if p.ThresholdLower != 0 || p.ThresholdUpper != 0 {
+		lower, upper := p.ThresholdLower, p.ThresholdUpper
+		sp.Lower, sp.Upper = &lower, &upper
+	}
+	var buf bytes.Buffer
+	if err := sp.Render(&buf); err != nil {
+		logrus.Errorf("render chart of %s %s failed: %s", p.SensorMac, p.SensorType, err.Error())
+		return
+	}
+	p.Chart = buf.Bytes()
+	id := s.charts.put(p.Chart)
+	baseUrl := conf.BaseUrl
+	if baseUrl == "" {
+		baseUrl = s.signer.BaseUrl
+	}
+	if baseUrl != "" {
+		p.ChartUrl = fmt.Sprintf("%s%s%s/%s.png", baseUrl, BasePath, ChartPath, id)
+	}
+}
+
+// get chart png embedded in messages
+func (s *Server) getChart(resp http.ResponseWriter, req *http.Request) {
+	id := strings.TrimSuffix(mux.Vars(req)["id"], ".png")
+	if s.charts == nil {
+		write(resp, http.StatusNotFound, map[string]interface{}{"error": "chart not enabled"})
+		return
+	}
+	data, ok := s.charts.get(id)
+	if !ok {
+		write(resp, http.StatusNotFound, map[string]interface{}{"error": "chart not exists or expired"})
+		return
+	}
+	resp.Header().Set("Content-Type", "image/png")
+	resp.Header().Set("Cache-Control", "max-age=86400")
+	_, _ = resp.Write(data)
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/config"
+	"github.com/go-playground/assert/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChartFlux(t *testing.T) {
+	conf := config.Chart{Measurement: "sensor_data", Field: "value"}
+	stop := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	p := alert.Payload{ProjectId: "3", SensorMac: `C1"25`, SensorType: "temperature_air"}
+	flux := chartFlux("bucket", conf, p, stop.Add(-2*time.Hour), stop)
+	assert.Equal(t, strings.Contains(flux, `range(start: 2022-03-01T08:00:00Z, stop: 2022-03-01T10:00:00Z)`), true)
+	assert.Equal(t, strings.Contains(flux, `r.sensor_mac == "C1\"25"`), true)
+	assert.Equal(t, strings.Contains(flux, `receive_no`), false)
+	assert.Equal(t, strings.Contains(flux, `aggregateWindow(every: 60s, fn: mean, createEmpty: true)`), true)
+
+	c := newChartCache(config.Chart{Expire: time.Hour})
+	id := c.put([]byte("png"))
+	data, ok := c.get(id)
+	assert.Equal(t, ok, true)
+	assert.Equal(t, string(data), "png")
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/model"
+	"anomaly-detect/cmd/alertengine/store"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const queryTimeFormat = "2006-01-02 15:04:05"
+
+const defaultQueryLimit = 100
+const maxQueryLimit = 1000
+
+// saveDeadLetter : used by retry queue
+func saveDeadLetter(d alert.Delivery) {
+	if err := store.SaveDeadLetter(d); err != nil {
+		logrus.Errorf("save dead letter of %s to %s failed: %s", d.Topic, d.Receiver.Api(), err.Error())
+	} else {
+		logrus.Warnf("message of %s to %s moved to dead letter after %d attempts: %s",
+			d.Topic, d.Receiver.Api(), d.Attempts, d.LastError)
+	}
+}
+
+// parseTimeRange : parse start and end in format 2006-01-02 15:04:05, default last 7 days
+func parseTimeRange(req *http.Request) (time.Time, time.Time, error) {
+	stop := time.Now()
+	start := stop.Add(-7 * 24 * time.Hour)
+	var err error
+	if v := req.URL.Query().Get("start"); v != "" {
+		if start, err = time.ParseInLocation(queryTimeFormat, v, time.Local); err != nil {
+			return start, stop, err
+		}
+	}
+	if v := req.URL.Query().Get("end"); v != "" {
+		if stop, err = time.ParseInLocation(queryTimeFormat, v, time.Local); err != nil {
+			return start, stop, err
+		}
+	}
+	return start, stop, nil
+}
+
+// parseLimit : limit must be in [1, maxQueryLimit], default defaultQueryLimit
+func parseLimit(req *http.Request) (int, error) {
+	v := req.URL.Query().Get("limit")
+	if v == "" {
+		return defaultQueryLimit, nil
+	}
+	limit, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	// negative limit means no limit in gorm
+	if limit < 1 || limit > maxQueryLimit {
+		return 0, fmt.Errorf("limit must be in [1, %d]", maxQueryLimit)
+	}
+	return limit, nil
+}
+
+// get dead letters
+// params: topic start end limit
+func (s *Server) getDeadLetter(resp http.ResponseWriter, req *http.Request) {
+	start, stop, err := parseTimeRange(req)
+	if err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "invalid time: " + err.Error()})
+		return
+	}
+	limit, err := parseLimit(req)
+	if err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "invalid limit"})
+		return
+	}
+	records, err := store.GetDeadLetters(req.URL.Query().Get("topic"), start, stop, limit)
+	if err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	for i, r := range records {
+		records[i].Address = redactDeadLetterAddress(r)
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": records})
+}
+
+// redeliver dead letter once, it is deleted if success
+// params: id
+func (s *Server) redeliver(resp http.ResponseWriter, req *http.Request) {
+	id, err := strconv.Atoi(req.URL.Query().Get("id"))
+	if err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "invalid id"})
+		return
+	}
+	record, err := store.GetDeadLetter(id)
+	if err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "dead letter not exists"})
+		return
+	}
+	receiver, message, err := restoreDeadLetter(record)
+	if err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err := alert.Deliver(record.Topic, receiver, message, record.Attempts+1); err != nil {
+		_ = store.SaveDeadLetterAttempt(id, record.Attempts+1, err.Error())
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "redeliver failed: " + err.Error()})
+		return
+	}
+	if err := store.DelDeadLetter(id); err != nil {
+		logrus.Errorf("delete dead letter %d failed: %s", id, err.Error())
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "redeliver success"})
+}
+
+// redactDeadLetterAddress : address of dead letter in API responses, secret address is redacted
+func redactDeadLetterAddress(record model.DeadLetter) string {
+	address, err := alert.OpenSecret(record.Address)
+	if err != nil {
+		return alert.RedactedSecret
+	}
+	return alert.BaseApi{Type: record.Type, Address: address}.Redacted().Address
+}
+
+func restoreDeadLetter(record model.DeadLetter) (alert.Receiver, alert.Message, error) {
+	api, err := store.ToApi(model.Receiver{
+		Topic:   record.Topic,
+		Type:    record.Type,
+		Address: record.Address,
+		Token:   record.Token,
+		Options: record.Options,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	receiver, err := alert.NewReceiver(api)
+	if err != nil {
+		return nil, nil, err
+	}
+	if record.Payload == "" {
+		return receiver, StringMessage{Subject: record.Subject, Msg: record.Body}, nil
+	}
+	var payload alert.Payload
+	if err := json.Unmarshal([]byte(record.Payload), &payload); err != nil {
+		return nil, nil, err
+	}
+	return receiver, alert.RenderedMessage{Subject: record.Subject, Body: record.Body, Payload: payload}, nil
+}
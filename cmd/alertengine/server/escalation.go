@@ -0,0 +1,202 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/store"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// loadEscalations : load escalation policies of existing topics, must hold the lock
+func (s *Server) loadEscalations() error {
+	records, err := store.GetAllEscalations()
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if _, ok := s.subscribes[r.Topic]; !ok {
+			continue
+		}
+		p, err := store.ToPolicy(r)
+		if err == nil {
+			err = p.Validate()
+		}
+		if err != nil {
+			logrus.Errorf("load escalation policy of topic %s failed: %s", r.Topic, err.Error())
+			continue
+		}
+		s.escalator.SetPolicy(&p)
+	}
+	return nil
+}
+
+// escalate : notify receivers of escalation tier with templates of the subscribe
+func (s *Server) escalate(topic string, receivers []alert.Receiver, message alert.Message) {
+	s.rw.RLock()
+	sub, ok := s.subscribes[topic]
+	s.rw.RUnlock()
+	if !ok || s.inhibited(topic, message) {
+		return
+	}
+	if err := sub.SendTo(receivers, message); err != nil {
+		logrus.Errorf("escalate message of %s failed: %s", topic, err.Error())
+	}
+}
+
+// get escalation policies and escalating alerts of topic, all topics if topic is empty
+func (s *Server) getEscalation(resp http.ResponseWriter, req *http.Request) {
+	topic := req.URL.Query().Get("topic")
+	write(resp, http.StatusOK, map[string]interface{}{
+		"msg": "success",
+		"data": map[string]interface{}{
+			"policies":    redactPolicies(s.escalator.Policies(topic)),
+			"escalations": s.escalator.Escalations(topic),
+		},
+	})
+}
+
+func redactPolicies(policies []alert.EscalationPolicy) []alert.EscalationPolicy {
+	for i := range policies {
+		policies[i] = policies[i].Redacted()
+	}
+	return policies
+}
+
+// set escalation policy of topic, the old one is replaced
+func (s *Server) setEscalation(resp http.ResponseWriter, req *http.Request) {
+	data := alert.EscalationPolicy{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	var saved []alert.BaseApi
+	for _, p := range s.escalator.Policies(data.Topic) {
+		saved = append(saved, p.Apis()...)
+	}
+	for i := range data.Tiers {
+		apis, err := alert.RestoreSecrets(data.Tiers[i].Receivers, saved)
+		if err != nil {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		data.Tiers[i].Receivers = apis
+	}
+	if err := data.Validate(); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	if _, ok := s.subscribes[data.Topic]; !ok {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "topic not exists"})
+		return
+	}
+	if err := store.SaveEscalation(data); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "save escalation policy failed: " + err.Error()})
+		return
+	}
+	s.escalator.SetPolicy(&data)
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "update success"})
+}
+
+// delete escalation policy of topic, escalating alerts of topic are stopped
+func (s *Server) deleteEscalation(resp http.ResponseWriter, req *http.Request) {
+	topic := req.URL.Query().Get("topic")
+	if len(s.escalator.Policies(topic)) == 0 || topic == "" {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "escalation policy not exists"})
+		return
+	}
+	if err := store.DelEscalation(topic); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "delete escalation policy failed: " + err.Error()})
+		return
+	}
+	s.escalator.DeletePolicy(topic)
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "delete success"})
+}
+
+// acknowledge alert, stop repeating and escalating it until resolved
+func (s *Server) acknowledge(resp http.ResponseWriter, req *http.Request) {
+	type requestBody struct {
+		Topic string `json:"topic"`
+		Id    string `json:"id"`
+		By    string `json:"by"`
+	}
+	data := requestBody{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if data.By == "" {
+		data.By = req.RemoteAddr
+	}
+	status, msg, err := s.ack(data.Topic, data.Id, data.By)
+	writeResult(resp, status, msg, err)
+}
+
+func (s *Server) ack(topic, id, by string) (int, string, error) {
+	if topic == "" || id == "" {
+		return http.StatusBadRequest, "", errors.New("topic and id could not be empty")
+	}
+	tracked := s.tracker.Acknowledge(topic, id, by)
+	escalating := s.escalator.Stop(topic, id)
+	if !tracked && !escalating {
+		return http.StatusBadRequest, "", errors.New("alert not active")
+	}
+	logrus.Infof("alert %s of topic %s acknowledged by %s", id, topic, by)
+	return http.StatusOK, "acknowledge success", nil
+}
+
+// silence alert, stop repeating it for a duration, default 1h. Escalation is not affected
+func (s *Server) silence(resp http.ResponseWriter, req *http.Request) {
+	type requestBody struct {
+		Topic    string `json:"topic"`
+		Id       string `json:"id"`
+		Duration string `json:"duration"`
+		By       string `json:"by"`
+	}
+	data := requestBody{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	d := alert.SilenceDuration
+	if data.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(data.Duration); err != nil || d <= 0 {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": "duration must be positive duration"})
+			return
+		}
+	}
+	if data.By == "" {
+		data.By = req.RemoteAddr
+	}
+	status, msg, err := s.silenceFor(data.Topic, data.Id, d, data.By)
+	writeResult(resp, status, msg, err)
+}
+
+func (s *Server) silenceFor(topic, id string, d time.Duration, by string) (int, string, error) {
+	if topic == "" || id == "" {
+		return http.StatusBadRequest, "", errors.New("topic and id could not be empty")
+	}
+	until := time.Now().Add(d)
+	if !s.tracker.Silence(topic, id, until) {
+		return http.StatusBadRequest, "", errors.New("alert not active")
+	}
+	logrus.Infof("alert %s of topic %s silenced until %s by %s", id, topic, until.Format(queryTimeFormat), by)
+	return http.StatusOK, "silence success", nil
+}
+
+func writeResult(resp http.ResponseWriter, status int, msg string, err error) {
+	if err != nil {
+		write(resp, status, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	write(resp, status, map[string]interface{}{"msg": msg})
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/db"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	mysqlPingTimeout = 3 * time.Second
+	smtpCheckExpire  = time.Minute // smtp is checked by a new connection, so the result is cached
+)
+
+// smtpCheck : cached result of smtp connectivity
+type smtpCheck struct {
+	err     error
+	checked time.Time
+	mu      sync.Mutex
+}
+
+func (c *smtpCheck) check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checked.IsZero() || time.Since(c.checked) >= smtpCheckExpire {
+		c.err = alert.CheckMail()
+		c.checked = time.Now()
+	}
+	return c.err
+}
+
+func checkMysql() error {
+	if db.MysqlClient == nil {
+		return errors.New("mysql client not init")
+	}
+	sqlDB, err := db.MysqlClient.DB.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mysqlPingTimeout)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
+
+// liveness : the process is able to serve http
+func (s *Server) liveness(resp http.ResponseWriter, req *http.Request) {
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "ok"})
+}
+
+// readiness : mysql and smtp are reachable and the server is not stopping
+func (s *Server) readiness(resp http.ResponseWriter, req *http.Request) {
+	checks := make(map[string]string)
+	ready := true
+	add := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+		} else {
+			checks[name] = "ok"
+		}
+	}
+	if atomic.LoadInt32(&s.stopped) == 1 {
+		add("server", errors.New("stopping"))
+	}
+	add("mysql", checkMysql())
+	add("smtp", s.smtp.check())
+	if !ready {
+		write(resp, http.StatusServiceUnavailable, map[string]interface{}{"error": "not ready", "data": checks})
+		return
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "ready", "data": checks})
+}
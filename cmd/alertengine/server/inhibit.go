@@ -0,0 +1,106 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/store"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+// loadInhibitRules : load inhibit rules from mysql
+func (s *Server) loadInhibitRules() error {
+	rules, err := store.GetInhibitRules()
+	if err != nil {
+		return err
+	}
+	if err := alert.ValidateInhibitRules(rules); err != nil {
+		return err
+	}
+	s.inhibitor.SetRules(rules)
+	return nil
+}
+
+// inhibited : whether message of topic is inhibited by a firing alert, inhibited messages are recorded
+func (s *Server) inhibited(topic string, message alert.Message) bool {
+	inhibition, ok := s.inhibitor.Inhibited(alert.LabelsOf(message))
+	if !ok {
+		return false
+	}
+	s.metrics.inhibit(topic)
+	logrus.Infof("message %s of %s inhibited by alert %s of %s, rule %s",
+		message.Title(), topic, inhibition.Id, inhibition.Topic, inhibition.Rule)
+	if err := store.SaveInhibited(topic, message, inhibition); err != nil {
+		logrus.Errorf("save inhibited message of %s failed: %s", topic, err.Error())
+	}
+	return true
+}
+
+// get inhibit rules
+func (s *Server) getInhibitRule(resp http.ResponseWriter, req *http.Request) {
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": s.inhibitor.Rules()})
+}
+
+// replace inhibit rules
+func (s *Server) setInhibitRule(resp http.ResponseWriter, req *http.Request) {
+	type requestBody struct {
+		Rules []*alert.InhibitRule `json:"rules"`
+	}
+	data := requestBody{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err := alert.ValidateInhibitRules(data.Rules); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err := store.SaveInhibitRules(data.Rules); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "save inhibit rules failed: " + err.Error()})
+		return
+	}
+	s.inhibitor.SetRules(data.Rules)
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "update success"})
+}
+
+// get inhibited messages
+// params: topic start end limit
+func (s *Server) getInhibited(resp http.ResponseWriter, req *http.Request) {
+	start, stop, err := parseTimeRange(req)
+	if err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "invalid time: " + err.Error()})
+		return
+	}
+	limit, err := parseLimit(req)
+	if err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "invalid limit"})
+		return
+	}
+	records, err := store.GetInhibited(req.URL.Query().Get("topic"), start, stop, limit)
+	if err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": records})
+}
+
+// test which firing alert inhibits the labels, nothing is recorded
+func (s *Server) testInhibit(resp http.ResponseWriter, req *http.Request) {
+	type requestBody struct {
+		Labels map[string]string `json:"labels"`
+	}
+	data := requestBody{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	inhibition, ok := s.inhibitor.Inhibited(data.Labels)
+	if !ok {
+		write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": nil})
+		return
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": inhibition})
+}
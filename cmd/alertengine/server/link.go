@@ -0,0 +1,75 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// linkPage : page of signed links. Links are opened by GET, which only shows a confirm form,
+// so that link previews of chat tools and mail scanners do not change the alert. The form posts the signed query back
+var linkPage = template.Must(template.New("link").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Title}}</title></head>
+<body style="font-family: sans-serif; margin: 2em;">
+<h3>{{.Title}}</h3>
+<p>{{.Text}}</p>
+{{if .Action}}<form method="post" action="{{.Action}}"><button type="submit">{{.Button}}</button></form>{{end}}
+</body>
+</html>`))
+
+type linkPageData struct {
+	Title  string
+	Text   string
+	Action string // url of the confirm form, no form if empty
+	Button string
+}
+
+func renderLinkPage(resp http.ResponseWriter, status int, data linkPageData) {
+	resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// the page should not be cached or embedded
+	resp.Header().Set("Cache-Control", "no-store")
+	resp.Header().Set("X-Frame-Options", "DENY")
+	resp.WriteHeader(status)
+	_ = linkPage.Execute(resp, data)
+}
+
+// signedLink : GET renders the confirm form, POST with the signed query applies the action
+func (s *Server) signedLink(action, title string, apply func(topic, id string) (int, string, error)) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		if err := s.signer.Verify(action, q); err != nil {
+			renderLinkPage(resp, http.StatusForbidden, linkPageData{Title: title, Text: "链接无效: " + err.Error()})
+			return
+		}
+		topic, id := q.Get("topic"), q.Get("id")
+		if req.Method == http.MethodGet {
+			renderLinkPage(resp, http.StatusOK, linkPageData{
+				Title:  title,
+				Text:   fmt.Sprintf("主题 %s 的告警 %s", topic, id),
+				Action: req.URL.RequestURI(),
+				Button: title,
+			})
+			return
+		}
+		status, msg, err := apply(topic, id)
+		if err != nil {
+			msg = err.Error()
+		}
+		renderLinkPage(resp, status, linkPageData{Title: title, Text: msg})
+	}
+}
+
+func (s *Server) acknowledgeLink() http.HandlerFunc {
+	return s.signedLink(alert.AckAction, "确认告警", func(topic, id string) (int, string, error) {
+		return s.ack(topic, id, "link")
+	})
+}
+
+// silenceLink : silence alert for alert.SilenceDuration
+func (s *Server) silenceLink() http.HandlerFunc {
+	return s.signedLink(alert.SilenceAction, "静默告警", func(topic, id string) (int, string, error) {
+		return s.silenceFor(topic, id, alert.SilenceDuration, "link")
+	})
+}
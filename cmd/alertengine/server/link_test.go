@@ -0,0 +1,47 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"github.com/go-playground/assert/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedLink(t *testing.T) {
+	s := &Server{
+		tracker:   alert.NewTracker(alert.RepeatInterval{}, func(topic string, message alert.Message) {}),
+		escalator: alert.NewEscalator(func(topic string, receivers []alert.Receiver, message alert.Message) {}),
+		signer:    alert.AckSigner{Secret: "secret", BaseUrl: "http://localhost", Expire: time.Hour},
+	}
+	defer s.tracker.Stop()
+	s.tracker.Fire("topic", "1", alert.AlertLevel, alert.SamplePayload())
+	handler := s.handler()
+	do := func(method, link string) *httptest.ResponseRecorder {
+		u, _ := url.Parse(link)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest(method, u.RequestURI(), nil))
+		return resp
+	}
+	ackLink := s.signer.Link(BasePath+AckPath, alert.AckAction, "topic", "1")
+	silenceLink := s.signer.Link(BasePath+SilencePath, alert.SilenceAction, "topic", "1")
+
+	// GET only shows the confirm form
+	resp := do(http.MethodGet, ackLink)
+	assert.Equal(t, resp.Code, http.StatusOK)
+	assert.Equal(t, strings.Contains(resp.Body.String(), `<form method="post"`), true)
+	assert.Equal(t, s.tracker.Active("topic")[0].AcknowledgedBy, "")
+
+	// silence link could not acknowledge
+	forged := strings.Replace(silenceLink, SilencePath, AckPath, 1)
+	assert.Equal(t, do(http.MethodPost, forged).Code, http.StatusForbidden)
+	assert.Equal(t, s.tracker.Active("topic")[0].AcknowledgedBy, "")
+
+	assert.Equal(t, do(http.MethodPost, silenceLink).Code, http.StatusOK)
+	assert.Equal(t, s.tracker.Active("topic")[0].SilencedUntil.IsZero(), false)
+	assert.Equal(t, do(http.MethodPost, ackLink).Code, http.StatusOK)
+	assert.Equal(t, s.tracker.Active("topic")[0].AcknowledgedBy, "link")
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// latencyBuckets : upper bounds in seconds of delivery latency histogram
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type histogram struct {
+	counts []uint64 // not cumulative, the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets)+1)
+	}
+	i := sort.SearchFloat64s(latencyBuckets, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+type deliveryKey struct {
+	receiverType string
+	outcome      string
+}
+
+// metrics : counters exposed in prometheus text format, gauges are collected from the server on scrape
+type metrics struct {
+	received   map[string]uint64      // topic -> messages
+	inhibited  map[string]uint64      // topic -> messages
+	deliveries map[deliveryKey]uint64 // attempts by receiver type and outcome
+	latency    map[string]*histogram  // receiver type -> latency of attempts
+	mu         sync.Mutex
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		received:   make(map[string]uint64),
+		inhibited:  make(map[string]uint64),
+		deliveries: make(map[deliveryKey]uint64),
+		latency:    make(map[string]*histogram),
+	}
+}
+
+func (m *metrics) receive(topic string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received[topic]++
+}
+
+func (m *metrics) inhibit(topic string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inhibited[topic]++
+}
+
+// observe : used as alert.Observer
+func (m *metrics) observe(a alert.Attempt) {
+	outcome := "success"
+	if a.Error != nil {
+		outcome = "failure"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries[deliveryKey{a.ReceiverType, outcome}]++
+	h, ok := m.latency[a.ReceiverType]
+	if !ok {
+		h = &histogram{}
+		m.latency[a.ReceiverType] = h
+	}
+	h.observe(a.Latency.Seconds())
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// labelPairs : pairs of name and value
+func labelPairs(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	items := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		items = append(items, fmt.Sprintf(`%s="%s"`, pairs[i], labelEscaper.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(items, ",") + "}"
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeTopicCounter(w io.Writer, name, help string, values map[string]uint64) {
+	writeHeader(w, name, "counter", help)
+	topics := make([]string, 0, len(values))
+	for t := range values {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	for _, t := range topics {
+		_, _ = fmt.Fprintf(w, "%s%s %d\n", name, labelPairs("topic", t), values[t])
+	}
+}
+
+func formatFloat(v float64) string {
+	return fmt.Sprintf("%g", v)
+}
+
+// write : counters and histograms
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writeTopicCounter(w, "alertengine_messages_received_total", "Alerts received by http api or pub/sub.", m.received)
+	writeTopicCounter(w, "alertengine_messages_inhibited_total", "Messages suppressed by inhibit rules.", m.inhibited)
+
+	writeHeader(w, "alertengine_deliveries_total", "counter", "Delivery attempts by receiver type and outcome.")
+	keys := make([]deliveryKey, 0, len(m.deliveries))
+	for k := range m.deliveries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].receiverType != keys[j].receiverType {
+			return keys[i].receiverType < keys[j].receiverType
+		}
+		return keys[i].outcome < keys[j].outcome
+	})
+	for _, k := range keys {
+		_, _ = fmt.Fprintf(w, "alertengine_deliveries_total%s %d\n",
+			labelPairs("receiver_type", k.receiverType, "outcome", k.outcome), m.deliveries[k])
+	}
+
+	const latency = "alertengine_delivery_latency_seconds"
+	writeHeader(w, latency, "histogram", "Latency of delivery attempts by receiver type.")
+	types := make([]string, 0, len(m.latency))
+	for t := range m.latency {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		h := m.latency[t]
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += h.counts[i]
+			_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", latency, labelPairs("receiver_type", t, "le", formatFloat(le)), cumulative)
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket%s %d\n", latency, labelPairs("receiver_type", t, "le", "+Inf"), h.count)
+		_, _ = fmt.Fprintf(w, "%s_sum%s %s\n", latency, labelPairs("receiver_type", t), formatFloat(h.sum))
+		_, _ = fmt.Fprintf(w, "%s_count%s %d\n", latency, labelPairs("receiver_type", t), h.count)
+	}
+}
+
+func writeGauge(w io.Writer, name, help string, value int) {
+	writeHeader(w, name, "gauge", help)
+	_, _ = fmt.Fprintf(w, "%s %d\n", name, value)
+}
+
+// getMetrics : prometheus text format
+func (s *Server) getMetrics(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	resp.WriteHeader(http.StatusOK)
+	s.metrics.write(resp)
+
+	active := make(map[string]uint64)
+	for _, a := range s.tracker.Active("") {
+		active[a.Topic]++
+	}
+	writeHeader(resp, "alertengine_active_alerts", "gauge", "Firing alerts tracked by id.")
+	topics := make([]string, 0, len(active))
+	for t := range active {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	for _, t := range topics {
+		_, _ = fmt.Fprintf(resp, "alertengine_active_alerts%s %d\n", labelPairs("topic", t), active[t])
+	}
+	writeGauge(resp, "alertengine_retry_queue_depth", "Deliveries waiting for retry.", s.queue.Len())
+	writeGauge(resp, "alertengine_held_messages", "Messages held in quiet hours.", alert.HeldCount())
+	writeGauge(resp, "alertengine_audit_queue_depth", "Delivery logs waiting to be written.", s.audit.pending())
+	writeGauge(resp, "alertengine_browser_clients", "Browsers connected to the stream.", len(s.hub.Clients()))
+}
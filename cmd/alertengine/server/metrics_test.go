@@ -0,0 +1,38 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"errors"
+	"github.com/go-playground/assert/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := newMetrics()
+	m.receive("a")
+	m.receive("a")
+	m.receive(`b"1`)
+	m.observe(alert.Attempt{ReceiverType: alert.EmailType, Latency: 200 * time.Millisecond})
+	m.observe(alert.Attempt{ReceiverType: alert.EmailType, Latency: 3 * time.Second, Error: errors.New("timeout")})
+
+	var b strings.Builder
+	m.write(&b)
+	out := b.String()
+	for _, line := range []string{
+		`alertengine_messages_received_total{topic="a"} 2`,
+		`alertengine_messages_received_total{topic="b\"1"} 1`,
+		`alertengine_deliveries_total{receiver_type="email",outcome="failure"} 1`,
+		`alertengine_deliveries_total{receiver_type="email",outcome="success"} 1`,
+		`alertengine_delivery_latency_seconds_bucket{receiver_type="email",le="0.1"} 0`,
+		`alertengine_delivery_latency_seconds_bucket{receiver_type="email",le="0.25"} 1`,
+		`alertengine_delivery_latency_seconds_bucket{receiver_type="email",le="5"} 2`,
+		`alertengine_delivery_latency_seconds_bucket{receiver_type="email",le="+Inf"} 2`,
+		`alertengine_delivery_latency_seconds_sum{receiver_type="email"} 3.2`,
+		`alertengine_delivery_latency_seconds_count{receiver_type="email"} 2`,
+		`# TYPE alertengine_delivery_latency_seconds histogram`,
+	} {
+		assert.Equal(t, strings.Contains(out, line+"\n"), true)
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/store"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// loadSchedules : load on-call schedules from mysql
+func (s *Server) loadSchedules() error {
+	schedules, err := store.GetAllSchedules()
+	if err != nil {
+		return err
+	}
+	for _, schedule := range schedules {
+		if err := schedule.Validate(); err != nil {
+			logrus.Errorf("load schedule %s failed: %s", schedule.Name, err.Error())
+			continue
+		}
+		s.schedules.Set(schedule)
+	}
+	return nil
+}
+
+// get schedule by name, all schedules if name is empty
+func (s *Server) getSchedule(resp http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("name")
+	if name == "" {
+		write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": s.schedules.List()})
+		return
+	}
+	if schedule, ok := s.schedules.Get(name); !ok {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "schedule not exists"})
+	} else {
+		write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": []alert.Schedule{schedule}})
+	}
+}
+
+// create or replace schedule, users of schedule must exist
+func (s *Server) setSchedule(resp http.ResponseWriter, req *http.Request) {
+	data := alert.Schedule{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err := data.Validate(); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	for _, id := range data.Users() {
+		if _, ok := s.users.User(id); !ok {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": fmt.Sprintf("user %s not exists", id)})
+			return
+		}
+	}
+	if err := store.SaveSchedule(data); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "save schedule failed: " + err.Error()})
+		return
+	}
+	s.schedules.Set(data)
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "update success"})
+}
+
+// scheduleUsedBy : topic of subscribe or escalation policy which uses schedule as receiver, must hold the lock
+func (s *Server) scheduleUsedBy(name string) string {
+	used := func(apis []alert.BaseApi) bool {
+		for _, api := range apis {
+			if api.Type == alert.OnCallType && api.Address == name {
+				return true
+			}
+		}
+		return false
+	}
+	for topic, sub := range s.subscribes {
+		apis := make([]alert.BaseApi, 0)
+		for _, r := range sub.Receivers() {
+			apis = append(apis, r.Api())
+		}
+		if used(apis) {
+			return topic
+		}
+	}
+	for _, p := range s.escalator.Policies("") {
+		for _, tier := range p.Tiers {
+			if used(tier.Receivers) {
+				return p.Topic
+			}
+		}
+	}
+	return ""
+}
+
+// delete schedule which is not used by subscribes and escalation policies
+func (s *Server) deleteSchedule(resp http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("name")
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	if _, ok := s.schedules.Get(name); !ok {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "schedule not exists"})
+		return
+	}
+	if topic := s.scheduleUsedBy(name); topic != "" {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "schedule is used by topic " + topic})
+		return
+	}
+	if err := store.DelSchedule(name); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "delete schedule failed: " + err.Error()})
+		return
+	}
+	s.schedules.Delete(name)
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "delete success"})
+}
+
+// maxOnCallRange : limit of the range of shifts, rotation period is at least 1h
+const maxOnCallRange = 90 * 24 * time.Hour
+
+// get who is on call now, or the shifts in [start, end) if start is present. End is 7 days after start by default,
+// range could not exceed maxOnCallRange.
+// params: name start end, all schedules if name is empty
+func (s *Server) getOnCall(resp http.ResponseWriter, req *http.Request) {
+	type item struct {
+		Name   string        `json:"name"`
+		Shifts []alert.Shift `json:"shifts"`
+	}
+	var start, stop time.Time
+	var err error
+	query := req.URL.Query()
+	if v := query.Get("start"); v != "" {
+		if start, err = time.ParseInLocation(queryTimeFormat, v, time.Local); err != nil {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": "invalid time: " + err.Error()})
+			return
+		}
+		stop = start.Add(7 * 24 * time.Hour)
+		if v := query.Get("end"); v != "" {
+			if stop, err = time.ParseInLocation(queryTimeFormat, v, time.Local); err != nil {
+				write(resp, http.StatusBadRequest, map[string]interface{}{"error": "invalid time: " + err.Error()})
+				return
+			}
+		}
+		if !stop.After(start) {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": "end must be after start"})
+			return
+		}
+		if stop.Sub(start) > maxOnCallRange {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": "range of shifts could not exceed 90 days"})
+			return
+		}
+	}
+	schedules := s.schedules.List()
+	if name := query.Get("name"); name != "" {
+		schedule, ok := s.schedules.Get(name)
+		if !ok {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": "schedule not exists"})
+			return
+		}
+		schedules = []alert.Schedule{schedule}
+	}
+	res := make([]item, 0, len(schedules))
+	for _, schedule := range schedules {
+		if start.IsZero() {
+			res = append(res, item{Name: schedule.Name, Shifts: []alert.Shift{schedule.OnCall(time.Now())}})
+		} else {
+			res = append(res, item{Name: schedule.Name, Shifts: schedule.Shifts(start, stop)})
+		}
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": res})
+}
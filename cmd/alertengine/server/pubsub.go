@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync/atomic"
+)
+
+// status of pub/sub event response, see https://docs.dapr.io/reference/api/pubsub_api/
+const (
+	eventSuccess = "SUCCESS"
+	eventRetry   = "RETRY"
+	eventDrop    = "DROP"
+)
+
+type daprSubscription struct {
+	PubsubName string `json:"pubsubname"`
+	Topic      string `json:"topic"`
+	Route      string `json:"route"`
+}
+
+// cloudEvent : fields of CloudEvents envelope used by alertengine
+type cloudEvent struct {
+	Id              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+	DataBase64      string          `json:"data_base64"`
+	Topic           string          `json:"topic"`
+	PubsubName      string          `json:"pubsubname"`
+}
+
+// payload : decode data of event, data may be a json object, a string of json or base64 encoded
+func (e cloudEvent) payload() ([]byte, error) {
+	if e.DataBase64 != "" {
+		return base64.StdEncoding.DecodeString(e.DataBase64)
+	}
+	if len(e.Data) > 0 && e.Data[0] == '"' {
+		var content string
+		if err := json.Unmarshal(e.Data, &content); err != nil {
+			return nil, err
+		}
+		return []byte(content), nil
+	}
+	return e.Data, nil
+}
+
+// daprSubscribe : topics subscribed by alertengine, called by dapr sidecar on start
+func (s *Server) daprSubscribe(resp http.ResponseWriter, req *http.Request) {
+	subs := make([]daprSubscription, 0, len(s.pubsub.Topics))
+	if s.pubsub.Name != "" {
+		for topic := range s.pubsub.Topics {
+			subs = append(subs, daprSubscription{PubsubName: s.pubsub.Name, Topic: topic, Route: DaprEventPath})
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Topic < subs[j].Topic
+	})
+	write(resp, http.StatusOK, subs)
+}
+
+// daprEvent : handle CloudEvents delivered by dapr sidecar. Malformed events are dropped,
+// events received after stopped or failed to be pushed are retried by dapr
+func (s *Server) daprEvent(resp http.ResponseWriter, req *http.Request) {
+	if atomic.LoadInt32(&s.stopped) == 1 {
+		write(resp, http.StatusOK, map[string]interface{}{"status": eventRetry})
+		return
+	}
+	event := cloudEvent{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &event); err != nil {
+		s.dropEvent(resp, event, err)
+		return
+	}
+	if event.PubsubName != s.pubsub.Name {
+		s.dropEvent(resp, event, fmt.Errorf("unknown pubsub %s", event.PubsubName))
+		return
+	}
+	mapped, ok := s.pubsub.Topics[event.Topic]
+	if !ok {
+		s.dropEvent(resp, event, fmt.Errorf("unknown topic %s", event.Topic))
+		return
+	}
+	content, err := event.payload()
+	if err != nil {
+		s.dropEvent(resp, event, err)
+		return
+	}
+	data := pushRequest{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		s.dropEvent(resp, event, err)
+		return
+	}
+	if mapped != "" {
+		data.Topic = mapped
+	} else if data.Topic == "" {
+		data.Topic = event.Topic
+	}
+	_, code, err := s.accept(data)
+	status := eventStatus(code, err)
+	switch status {
+	case eventDrop:
+		s.dropEvent(resp, event, err)
+		return
+	case eventRetry:
+		logrus.Errorf("handle event %s of topic %s failed, retry: %s", event.Id, event.Topic, err.Error())
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"status": status})
+}
+
+// eventStatus : status of event by the result of accept, invalid requests are dropped and others are retried
+func eventStatus(code int, err error) string {
+	if err == nil {
+		return eventSuccess
+	}
+	if code == http.StatusBadRequest {
+		return eventDrop
+	}
+	return eventRetry
+}
+
+func (s *Server) dropEvent(resp http.ResponseWriter, event cloudEvent, err error) {
+	logrus.Errorf("drop event %s of topic %s: %s", event.Id, event.Topic, err.Error())
+	write(resp, http.StatusOK, map[string]interface{}{"status": eventDrop})
+}
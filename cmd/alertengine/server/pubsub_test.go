@@ -0,0 +1,149 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/config"
+	"anomaly-detect/pkg/dapr"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSidecar : load programmatic subscriptions of app and deliver published data as CloudEvents
+type fakeSidecar struct {
+	app      string
+	subs     []daprSubscription
+	statuses []string
+	mu       sync.Mutex
+}
+
+func (f *fakeSidecar) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	// /v1.0/publish/{pubsub}/{topic}
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/v1.0/publish/"), "/")
+	var data json.RawMessage
+	if err := json.NewDecoder(req.Body).Decode(&data); err != nil || len(parts) != 2 {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, sub := range f.subs {
+		if sub.PubsubName != parts[0] || sub.Topic != parts[1] {
+			continue
+		}
+		event, _ := json.Marshal(cloudEvent{
+			Id: "1", Source: "test", Type: "com.dapr.event.sent", DataContentType: "application/json",
+			Data: data, Topic: sub.Topic, PubsubName: sub.PubsubName,
+		})
+		r, err := http.Post(f.app+sub.Route, "application/json", bytes.NewReader(event))
+		if err != nil {
+			resp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var status struct {
+			Status string `json:"status"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&status)
+		r.Body.Close()
+		f.mu.Lock()
+		f.statuses = append(f.statuses, status.Status)
+		f.mu.Unlock()
+		resp.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resp.WriteHeader(http.StatusNotFound)
+}
+
+func (f *fakeSidecar) last() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.statuses[len(f.statuses)-1]
+}
+
+func TestDaprPubSub(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		mu.Lock()
+		received = append(received, fmt.Sprintf("%s %v", req.URL.Path, body["title"]))
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	s := &Server{
+		subscribes: make(map[string]*alert.Subscribe),
+		router:     alert.NewRouter(),
+		users:      alert.NewDirectory(),
+		tracker:    alert.NewTracker(alert.RepeatInterval{}, func(topic string, message alert.Message) {}),
+		inhibitor:  alert.NewInhibitor(func(topic string) []alert.ActiveAlert { return nil }),
+		hub:        alert.NewHub(0),
+		metrics:    newMetrics(),
+		escalator:  alert.NewEscalator(func(topic string, receivers []alert.Receiver, message alert.Message) {}),
+		pubsub:     config.PubSub{Name: "pubsub", Topics: map[string]string{"alerts": "", "task": "mapped"}},
+	}
+	routes := []*alert.Route{
+		{
+			Name:      "mapped",
+			Matchers:  []alert.Matcher{{Label: alert.TopicLabel, Op: alert.MatchEqual, Value: "mapped"}},
+			Receivers: []alert.BaseApi{{Type: alert.WebhookType, Address: receiver.URL + "/mapped"}},
+		},
+		{
+			Name:      "others",
+			Receivers: []alert.BaseApi{{Type: alert.WebhookType, Address: receiver.URL + "/others"}},
+		},
+	}
+	assert.Equal(t, alert.ValidateRoutes(routes), nil)
+	s.router.SetRoutes(routes)
+	app := httptest.NewServer(s.handler())
+	defer app.Close()
+
+	sidecar := &fakeSidecar{app: app.URL}
+	r, err := http.Get(app.URL + DaprSubscribePath)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, json.NewDecoder(r.Body).Decode(&sidecar.subs), nil)
+	r.Body.Close()
+	assert.Equal(t, len(sidecar.subs), 2)
+	assert.Equal(t, sidecar.subs[0], daprSubscription{PubsubName: "pubsub", Topic: "alerts", Route: DaprEventPath})
+
+	fake := httptest.NewServer(sidecar)
+	defer fake.Close()
+	u, _ := url.Parse(fake.URL)
+	port, _ := strconv.Atoi(u.Port())
+	d := &dapr.Dapr{DaprHttpPort: port}
+
+	msg := pushRequest{Topic: "task-1", Level: alert.WarnLevel, Msg: StringMessage{Subject: "hello", Msg: "world"}}
+	assert.Equal(t, d.Publish("pubsub", "alerts", msg), nil)
+	assert.Equal(t, sidecar.last(), eventSuccess)
+	// topic of event data is replaced by the mapped subscribe topic
+	assert.Equal(t, d.Publish("pubsub", "task", msg), nil)
+	assert.Equal(t, sidecar.last(), eventSuccess)
+
+	msg.Level = 5
+	assert.Equal(t, d.Publish("pubsub", "alerts", msg), nil)
+	assert.Equal(t, sidecar.last(), eventDrop)
+	assert.NotEqual(t, d.Publish("pubsub", "unknown", msg), nil)
+
+	s.stopped = 1
+	assert.Equal(t, d.Publish("pubsub", "alerts", msg), nil)
+	assert.Equal(t, sidecar.last(), eventRetry)
+
+	mu.Lock()
+	assert.Equal(t, received, []string{"/others hello", "/mapped hello"})
+	mu.Unlock()
+}
+
+func TestEventStatus(t *testing.T) {
+	assert.Equal(t, eventStatus(http.StatusOK, nil), eventSuccess)
+	assert.Equal(t, eventStatus(http.StatusBadRequest, errors.New("invalid level")), eventDrop)
+	// message not pushed is retried by dapr
+	assert.Equal(t, eventStatus(http.StatusInternalServerError, errors.New("push message failed")), eventRetry)
+}
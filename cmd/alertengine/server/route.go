@@ -0,0 +1,95 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/store"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// loadRoutes : load routing tree from mysql
+func (s *Server) loadRoutes() error {
+	routes, err := store.GetRoutes()
+	if err != nil {
+		return err
+	}
+	if err := alert.ValidateRoutes(routes); err != nil {
+		return err
+	}
+	s.router.SetRoutes(routes)
+	return nil
+}
+
+// get routing tree
+func (s *Server) getRoute(resp http.ResponseWriter, req *http.Request) {
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": alert.RedactRoutes(s.router.Routes())})
+}
+
+// replace routing tree
+func (s *Server) setRoute(resp http.ResponseWriter, req *http.Request) {
+	type requestBody struct {
+		Routes []*alert.Route `json:"routes"`
+	}
+	data := requestBody{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err := restoreRouteSecrets(data.Routes, alert.RouteApis(s.router.Routes())); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err := alert.ValidateRoutes(data.Routes); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err := store.SaveRoutes(data.Routes); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "save routes failed: " + err.Error()})
+		return
+	}
+	s.router.SetRoutes(data.Routes)
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "update success"})
+}
+
+// restoreRouteSecrets : restore redacted secrets of receivers in the routing tree
+func restoreRouteSecrets(routes []*alert.Route, saved []alert.BaseApi) error {
+	for _, r := range routes {
+		if r == nil {
+			continue
+		}
+		apis, err := alert.RestoreSecrets(r.Receivers, saved)
+		if err != nil {
+			return fmt.Errorf("route %s: %s", r.Name, err.Error())
+		}
+		r.Receivers = apis
+		if err := restoreRouteSecrets(r.Routes, saved); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// test which routes and groups the labels are dispatched to, nothing is sent
+func (s *Server) testRoute(resp http.ResponseWriter, req *http.Request) {
+	type requestBody struct {
+		Labels map[string]string `json:"labels"`
+	}
+	type item struct {
+		Name     string `json:"name"`
+		GroupKey string `json:"group_key"`
+	}
+	data := requestBody{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	res := make([]item, 0)
+	for _, r := range s.router.Match(data.Labels) {
+		res = append(res, item{Name: r.Name, GroupKey: r.GroupKey(data.Labels)})
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": res})
+}
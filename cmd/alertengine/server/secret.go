@@ -0,0 +1,59 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/store"
+	"fmt"
+	"net/http"
+)
+
+// rotateSecrets : save secrets of all receivers again, so that they are encrypted by the first secret key.
+// Secrets saved in plain text before encryption is enabled are encrypted as well.
+// Old keys could be removed from config after rotation
+func (s *Server) rotateSecrets(resp http.ResponseWriter, req *http.Request) {
+	if !alert.SecretsEncrypted() {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "no secret key configured"})
+		return
+	}
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	fail := func(what string, err error) {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": fmt.Sprintf("rotate secrets of %s failed: %s", what, err.Error())})
+	}
+	for _, sub := range s.subscribes {
+		if err := store.Store(sub); err != nil {
+			fail("subscribe "+sub.Topic, err)
+			return
+		}
+	}
+	for _, p := range s.escalator.Policies("") {
+		if err := store.SaveEscalation(p); err != nil {
+			fail("escalation policy "+p.Topic, err)
+			return
+		}
+	}
+	if err := store.SaveRoutes(s.router.Routes()); err != nil {
+		fail("routes", err)
+		return
+	}
+	for _, u := range s.users.Users() {
+		if err := store.SaveUser(u); err != nil {
+			fail("user "+u.Id, err)
+			return
+		}
+	}
+	if err := store.SaveUserSubscriptions(s.users.Subscriptions("", "", "")); err != nil {
+		fail("user subscriptions", err)
+		return
+	}
+	deadLetters, err := store.ResealDeadLetters()
+	if err != nil {
+		fail("dead letters", err)
+		return
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "rotate success", "data": map[string]interface{}{
+		"subscribes":  len(s.subscribes),
+		"users":       len(s.users.Users()),
+		"deadLetters": deadLetters,
+	}})
+}
@@ -2,60 +2,272 @@ package server
 
 import (
 	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/config"
+	"anomaly-detect/cmd/alertengine/store"
+	"anomaly-detect/pkg/alerting"
 	"anomaly-detect/pkg/dapr"
 	"anomaly-detect/pkg/env"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Server struct {
 	*dapr.Dapr
 	subscribes map[string]*alert.Subscribe
+	tracker    *alert.Tracker // 周期告警
+	queue      *alert.Queue   // 推送失败重试
+	audit      *auditLog      // 推送记录
+	metrics    *metrics       // prometheus 指标
+	smtp       *smtpCheck     // 就绪检查
+	escalator  *alert.Escalator
+	router     *alert.Router    // 按标签路由
+	inhibitor  *alert.Inhibitor // 告警抑制
+	users      *alert.Directory // 用户订阅
+	schedules  *alert.Schedules // 值班表
+	hub        *alert.Hub       // 浏览器推送
+	browser    config.Browser
+	signer     alert.AckSigner
+	pubsub     config.PubSub
+	charts     *chartCache // nil if charts are disabled
+	stopped    int32       // pub/sub events are retried by dapr after stopped
+	httpServer *http.Server
 	rw         sync.RWMutex
 	exit       chan error
 }
 
-func NewServer(exit chan error) *Server {
+func NewServer(conf *config.Config, exit chan error) *Server {
 	serviceName := env.GetEnvString(dapr.AppIdEnv, defaultServiceName)
 	servicePort := env.GetEnvInt(dapr.AppPortEnv, defaultHttpPort)
 	daprInstance := dapr.NewDapr(serviceName, servicePort)
-	return &Server{
+	s := &Server{
 		Dapr:       daprInstance,
 		subscribes: make(map[string]*alert.Subscribe),
+		router:     alert.NewRouter(),
+		users:      alert.NewDirectory(),
 		exit:       exit,
+		signer:     conf.Ack,
+		pubsub:     conf.PubSub,
+		browser:    conf.Browser,
 	}
+	if conf.Chart.Enable {
+		s.charts = newChartCache(conf.Chart)
+	}
+	s.schedules = alert.InitSchedules(s.users)
+	s.hub = alert.InitBrowserHub(conf.Browser.Buffer)
+	s.tracker = alert.NewTracker(conf.Repeat, s.deliver)
+	s.inhibitor = alert.NewInhibitor(s.tracker.Active)
+	s.queue = alert.InitQueue(conf.Retry, saveDeadLetter)
+	s.escalator = alert.NewEscalator(s.escalate)
+	s.audit = newAuditLog(store.SaveDeliveryLogs, auditFlushInterval)
+	alert.AddObserver(s.audit.observe)
+	s.metrics = newMetrics()
+	s.smtp = &smtpCheck{}
+	alert.AddObserver(s.metrics.observe)
+	s.httpServer = &http.Server{Addr: fmt.Sprintf(":%d", s.AppPort), Handler: s.handler()}
+	return s
 }
 
 func (s *Server) Start() {
+	if err := s.Load(); err != nil {
+		s.exit <- fmt.Errorf("load subscribes failed: %s", err.Error())
+		return
+	}
+
+	logrus.Infof("start listening on port %d", s.AppPort)
+	// ErrServerClosed is returned after Stop
+	if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.exit <- err
+	}
+}
+
+// handler : routes of http api and dapr pub/sub
+func (s *Server) handler() http.Handler {
 	r := mux.NewRouter()
 	r.Use(loggingMiddleware)
+	r.HandleFunc(DaprSubscribePath, s.daprSubscribe).Methods(http.MethodGet)
+	r.HandleFunc(DaprEventPath, s.daprEvent).Methods(http.MethodPost)
+	r.HandleFunc(MetricsPath, s.getMetrics).Methods(http.MethodGet)
+	r.HandleFunc(LivenessPath, s.liveness).Methods(http.MethodGet)
+	r.HandleFunc(ReadinessPath, s.readiness).Methods(http.MethodGet)
 	//// routes
 	api := r.PathPrefix(BasePath).Subrouter()
 	api.HandleFunc(AlertPath, s.push).Methods(http.MethodPost)
+	api.HandleFunc(ActivePath, s.getActive).Methods(http.MethodGet)
+	// signed links: GET shows a confirm form which posts the signed query back
+	api.HandleFunc(AckPath, s.acknowledgeLink()).Methods(http.MethodGet)
+	api.HandleFunc(AckPath, s.acknowledgeLink()).Methods(http.MethodPost).Queries("sign", "{sign}")
+	api.HandleFunc(AckPath, s.acknowledge).Methods(http.MethodPost)
+	api.HandleFunc(SilencePath, s.silenceLink()).Methods(http.MethodGet)
+	api.HandleFunc(SilencePath, s.silenceLink()).Methods(http.MethodPost).Queries("sign", "{sign}")
+	api.HandleFunc(SilencePath, s.silence).Methods(http.MethodPost)
 	api.HandleFunc(SubscribePath, s.createSubscribe).Methods(http.MethodPost)
 	api.HandleFunc(SubscribePath, s.getSubscribe).Methods(http.MethodGet)
 	api.HandleFunc(SubscribePath, s.updateSubscribe).Methods(http.MethodPatch)
 	api.HandleFunc(SubscribePath, s.deleteSubscribe).Methods(http.MethodDelete)
+	api.HandleFunc(TemplatePath, s.getTemplate).Methods(http.MethodGet)
+	api.HandleFunc(TemplatePath, s.setTemplate).Methods(http.MethodPut)
+	api.HandleFunc(TemplatePath, s.deleteTemplate).Methods(http.MethodDelete)
+	api.HandleFunc(PreviewPath, s.previewTemplate).Methods(http.MethodPost)
+	api.HandleFunc(DeadPath, s.getDeadLetter).Methods(http.MethodGet)
+	api.HandleFunc(RedeliverPath, s.redeliver).Methods(http.MethodPost)
+	api.HandleFunc(DeliveryPath, s.getDelivery).Methods(http.MethodGet)
+	api.HandleFunc(EscalatePath, s.getEscalation).Methods(http.MethodGet)
+	api.HandleFunc(EscalatePath, s.setEscalation).Methods(http.MethodPut)
+	api.HandleFunc(EscalatePath, s.deleteEscalation).Methods(http.MethodDelete)
+	api.HandleFunc(RoutePath, s.getRoute).Methods(http.MethodGet)
+	api.HandleFunc(RoutePath, s.setRoute).Methods(http.MethodPut)
+	api.HandleFunc(RouteTestPath, s.testRoute).Methods(http.MethodPost)
+	api.HandleFunc(VerifyPath, s.verifyReceiver).Methods(http.MethodPost)
+	api.HandleFunc(ChartPath+"/{id}", s.getChart).Methods(http.MethodGet)
+	api.HandleFunc(UserPath, s.getUser).Methods(http.MethodGet)
+	api.HandleFunc(UserPath, s.setUser).Methods(http.MethodPut)
+	api.HandleFunc(UserPath, s.deleteUser).Methods(http.MethodDelete)
+	api.HandleFunc(UserSubscribePath, s.createUserSubscribe).Methods(http.MethodPost)
+	api.HandleFunc(UserSubscribePath, s.getUserSubscribe).Methods(http.MethodGet)
+	api.HandleFunc(UserSubscribePath, s.updateUserSubscribe).Methods(http.MethodPatch)
+	api.HandleFunc(UserSubscribePath, s.deleteUserSubscribe).Methods(http.MethodDelete)
+	api.HandleFunc(OnCallPath, s.getOnCall).Methods(http.MethodGet)
+	api.HandleFunc(SchedulePath, s.getSchedule).Methods(http.MethodGet)
+	api.HandleFunc(SchedulePath, s.setSchedule).Methods(http.MethodPut)
+	api.HandleFunc(SchedulePath, s.deleteSchedule).Methods(http.MethodDelete)
+	api.HandleFunc(InhibitPath, s.getInhibitRule).Methods(http.MethodGet)
+	api.HandleFunc(InhibitPath, s.setInhibitRule).Methods(http.MethodPut)
+	api.HandleFunc(InhibitTestPath, s.testInhibit).Methods(http.MethodPost)
+	api.HandleFunc(InhibitedPath, s.getInhibited).Methods(http.MethodGet)
+	api.HandleFunc(SecretRotatePath, s.rotateSecrets).Methods(http.MethodPost)
+	api.HandleFunc(StreamPath, s.stream).Methods(http.MethodGet)
+	api.HandleFunc(StreamClientsPath, s.streamClients).Methods(http.MethodGet)
+	return r
+}
 
-	addr := fmt.Sprintf(":%d", s.AppPort)
-	logrus.Infof("start listening on port %d", s.AppPort)
-	if err := http.ListenAndServe(addr, r); err != nil {
-		s.exit <- err
+// Stop : stop accepting requests and wait for in-flight requests until shutdownTimeout,
+// then stop background deliveries, flush held messages and save subscribes.
+// Browser streams are closed first since they never finish by themselves
+func (s *Server) Stop() {
+	atomic.StoreInt32(&s.stopped, 1)
+	s.hub.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		logrus.Errorf("shutdown http server failed: %s", err.Error())
 	}
+	s.tracker.Stop()
+	s.escalator.Close()
+	s.router.Close()
+	s.rw.RLock()
+	for _, sub := range s.subscribes {
+		sub.FlushDigest()
+	}
+	s.rw.RUnlock()
+	alert.FlushHeld()
+	s.queue.Stop()
+	alert.CloseMail()
+	s.Save()
+	s.audit.Close()
 }
 
-func (s *Server) Stop() {
-	//TODO: do something clean
+// Load : load all subscribes and their receivers from mysql
+func (s *Server) Load() error {
+	subs, err := store.GetAll()
+	if err != nil {
+		return err
+	}
+	receivers, err := store.GetAllReceivers()
+	if err != nil {
+		return err
+	}
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	for _, sub := range subs {
+		s.subscribes[sub.Topic] = &alert.Subscribe{
+			Topic:         sub.Topic,
+			Receiver:      make([]alert.Receiver, 0),
+			CreatedAt:     sub.CreatedAt,
+			UpdatedAt:     sub.UpdatedAt,
+			Triggered:     sub.Triggered,
+			LastTriggered: sub.LastTriggered,
+		}
+		if d, err := alert.ParseDigest(sub.Digest); err != nil {
+			logrus.Errorf("load digest of topic %s failed: %s", sub.Topic, err.Error())
+		} else {
+			s.subscribes[sub.Topic].SetDigest(sub.Digest, d)
+		}
+		throttle, err := store.ToThrottle(sub)
+		if err == nil && throttle != nil {
+			err = throttle.Validate()
+		}
+		if err != nil {
+			logrus.Errorf("load throttle of topic %s failed: %s", sub.Topic, err.Error())
+			continue
+		}
+		s.subscribes[sub.Topic].Throttle = throttle
+	}
+	for _, r := range receivers {
+		sub, ok := s.subscribes[r.Topic]
+		if !ok {
+			continue
+		}
+		api, err := store.ToApi(r)
+		if err != nil {
+			logrus.Errorf("load receiver %s of topic %s failed: %s", alert.BaseApi{Type: r.Type, Address: r.Address}, r.Topic, err.Error())
+			continue
+		}
+		if temp, err := alert.NewReceiver(api); err == nil {
+			sub.Receiver = append(sub.Receiver, temp)
+		} else {
+			logrus.Errorf("load receiver %s of topic %s failed: %s", alert.BaseApi{Type: r.Type, Address: r.Address}, r.Topic, err.Error())
+		}
+	}
+	templates, err := store.GetAllTemplates()
+	if err != nil {
+		return err
+	}
+	for _, t := range templates {
+		if sub, ok := s.subscribes[t.Topic]; ok {
+			sub.SetTemplate(t.Type, alert.Template{Subject: t.Subject, Body: t.Body, Html: t.Html})
+		}
+	}
+	if err := s.loadEscalations(); err != nil {
+		return err
+	}
+	if err := s.loadRoutes(); err != nil {
+		return err
+	}
+	if err := s.loadInhibitRules(); err != nil {
+		return err
+	}
+	if err := s.loadVerifications(); err != nil {
+		return err
+	}
+	if err := s.loadUsers(); err != nil {
+		return err
+	}
+	if err := s.loadSchedules(); err != nil {
+		return err
+	}
+	logrus.Infof("load %d subscribes", len(subs))
+	return nil
 }
 
+// Save : persist all subscribes to mysql
 func (s *Server) Save() {
-
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	for _, sub := range s.subscribes {
+		if err := store.Store(sub); err != nil {
+			logrus.Errorf("save subscribe %s failed: %s", sub.Topic, err.Error())
+		}
+	}
 }
 
 func writeJson(w http.ResponseWriter, data interface{}) error {
@@ -76,11 +288,34 @@ func write(w http.ResponseWriter, status int, data interface{}) {
 
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		logrus.Infof("from=%s req=%s method=%s", req.RemoteAddr, req.RequestURI, req.Method)
+		// scrapes and probes are too frequent to log
+		switch req.URL.Path {
+		case MetricsPath, LivenessPath, ReadinessPath:
+		default:
+			logrus.Infof("from=%s req=%s method=%s", req.RemoteAddr, redactedURI(req.URL), req.Method)
+		}
 		next.ServeHTTP(w, req)
 	})
 }
 
+// credentials in query are not logged, such as browser tokens and signatures of links
+var redactedParams = []string{"token", "sign"}
+
+func redactedURI(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for _, p := range redactedParams {
+		if query.Get(p) != "" {
+			query.Set(p, alert.RedactedSecret)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.RequestURI()
+	}
+	return u.EscapedPath() + "?" + query.Encode()
+}
+
 type StringMessage struct {
 	Subject string `json:"subject"`
 	Msg     string `json:"msg"`
@@ -94,30 +329,119 @@ func (s StringMessage) Content() string {
 	return s.Msg
 }
 
-func (s *Server) push(resp http.ResponseWriter, req *http.Request) {
-	type requestBody struct {
-		Topic string        `json:"topic"`
-		Msg   StringMessage `json:"msg"`
+// pushRequest : alert pushed by http api or pub/sub
+type pushRequest struct {
+	Topic    string            `json:"topic"`
+	Id       string            `json:"id"`
+	Level    alert.Level       `json:"level"`
+	Resolved bool              `json:"resolved"`
+	Msg      StringMessage     `json:"msg"`
+	Payload  *alert.Payload    `json:"payload"` // structured alert, rendered by templates. msg is ignored if present
+	Labels   map[string]string `json:"labels"`  // labels matched by routes, merged into labels of payload
+	Alert    *alerting.Alert   `json:"alert"`   // structured alert sent by controller, id, level, resolved and payload are derived from it
+}
+
+// fromAlert : derive legacy fields from structured alert, topic is the task id if empty
+func (data *pushRequest) fromAlert() error {
+	if err := data.Alert.Validate(); err != nil {
+		return err
 	}
-	data := requestBody{}
+	p := alert.FromAlert(*data.Alert)
+	data.Payload = &p
+	data.Id = data.Alert.Key()
+	data.Level = alert.Level(data.Alert.Level)
+	data.Resolved = data.Alert.IsResolved()
+	if data.Topic == "" {
+		data.Topic = data.Alert.TaskId
+	}
+	return nil
+}
+
+// push : messages with id are tracked as active alerts and resent periodically by level until resolved,
+// messages without id are sent once
+func (s *Server) push(resp http.ResponseWriter, req *http.Request) {
+	data := pushRequest{}
 	body, _ := ioutil.ReadAll(req.Body)
 	if err := json.Unmarshal(body, &data); err != nil {
 		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if msg, status, err := s.accept(data); err != nil {
+		write(resp, status, map[string]interface{}{"error": err.Error()})
 	} else {
-		err = s.sendMessage(data.Topic, data.Msg)
-		if err != nil {
-			write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "push message failed: " + err.Error()})
+		write(resp, status, map[string]interface{}{"msg": msg})
+	}
+}
+
+// accept : handle pushed alert, return message and http status
+func (s *Server) accept(data pushRequest) (string, int, error) {
+	if data.Alert != nil {
+		if err := data.fromAlert(); err != nil {
+			return "", http.StatusBadRequest, err
+		}
+	}
+	var message alert.Message = data.Msg
+	level := data.Level
+	if data.Payload != nil {
+		message = *data.Payload
+		level = data.Payload.Level
+	}
+	if err := level.Validate(); err != nil {
+		return "", http.StatusBadRequest, err
+	}
+	s.metrics.receive(data.Topic)
+	if data.Payload != nil && !data.Resolved {
+		s.attachChart(data.Payload)
+		message = *data.Payload
+	}
+	labels := map[string]string{alert.TopicLabel: data.Topic}
+	if data.Payload == nil {
+		labels[alert.LevelLabel] = level.String()
+	}
+	for k, v := range data.Labels {
+		labels[k] = v
+	}
+	if data.Id != "" {
+		message = alert.WithAckLink(message, s.signer.Link(BasePath+AckPath, alert.AckAction, data.Topic, data.Id))
+		message = alert.WithSilenceLink(message, s.signer.Link(BasePath+SilencePath, alert.SilenceAction, data.Topic, data.Id))
+	}
+	// labels are attached after ack link, so they are kept by the wrapped message
+	message = alert.WithLabels(message, labels)
+	if data.Id != "" {
+		if data.Resolved {
+			escalating := s.escalator.Stop(data.Topic, data.Id)
+			if !s.tracker.Resolve(data.Topic, data.Id) && !escalating {
+				return "alert not active", http.StatusOK, nil
+			}
 		} else {
-			write(resp, http.StatusOK, map[string]interface{}{"msg": "write success"})
+			// escalation restarts when the level of acknowledged alert is raised
+			if s.tracker.Fire(data.Topic, data.Id, level, message) {
+				s.escalator.Start(data.Topic, data.Id, message)
+			} else {
+				s.escalator.Update(data.Topic, data.Id, message)
+			}
+			return "write success", http.StatusOK, nil
 		}
 	}
+	if err := s.sendMessage(data.Topic, message); err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("push message failed: %s", err.Error())
+	}
+	return "write success", http.StatusOK, nil
+}
+
+// get active alerts
+func (s *Server) getActive(resp http.ResponseWriter, req *http.Request) {
+	topic := req.URL.Query().Get("topic")
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": s.tracker.Active(topic)})
 }
 
 // create subscribe
 func (s *Server) createSubscribe(resp http.ResponseWriter, req *http.Request) {
 	type requestBody struct {
-		Topic string          `json:"topic"`
-		To    []alert.BaseApi `json:"to"`
+		Topic    string          `json:"topic"`
+		To       []alert.BaseApi `json:"to"`
+		Throttle *alert.Throttle `json:"throttle"`
+		Digest   string          `json:"digest"`
 	}
 	data := requestBody{}
 	body, _ := ioutil.ReadAll(req.Body)
@@ -131,35 +455,56 @@ func (s *Server) createSubscribe(resp http.ResponseWriter, req *http.Request) {
 		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "topic already existed"})
 		return
 	} else {
-		var rs []alert.Receiver
-		for _, r := range data.To {
-			if temp := createReceiver(r); temp != nil {
-				rs = append(rs, temp)
-			} else {
-				write(resp, http.StatusBadRequest, map[string]interface{}{"error": "type not match"})
+		rs, err := createReceivers(data.To, nil)
+		if err != nil {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		if data.Throttle != nil {
+			if err := data.Throttle.Validate(); err != nil {
+				write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+				return
 			}
 		}
-		s.subscribes[data.Topic] = &alert.Subscribe{
+		digest, err := alert.ParseDigest(data.Digest)
+		if err != nil {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		sub := &alert.Subscribe{
 			Topic:         data.Topic,
 			Receiver:      rs,
+			Throttle:      data.Throttle,
 			CreatedAt:     time.Now(),
 			UpdatedAt:     time.Now(),
 			Triggered:     0,
 			LastTriggered: time.Time{},
 		}
+		sub.SetDigest(data.Digest, digest)
+		if err := store.Store(sub); err != nil {
+			write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "save subscribe failed: " + err.Error()})
+			return
+		}
+		s.subscribes[data.Topic] = sub
 	}
 	write(resp, http.StatusOK, map[string]interface{}{"msg": "create success"})
 }
 
-func createReceiver(r alert.BaseApi) alert.Receiver {
-	switch r.Type {
-	case "email":
-		return alert.Mail{BaseApi: r}
-	case "dingTalk":
-		return alert.DingTalk{BaseApi: r}
-	default:
-		return nil
+// createReceivers : create receivers of apis, redacted secrets are restored from saved apis
+func createReceivers(apis []alert.BaseApi, saved []alert.BaseApi) ([]alert.Receiver, error) {
+	apis, err := alert.RestoreSecrets(apis, saved)
+	if err != nil {
+		return nil, err
+	}
+	rs := make([]alert.Receiver, 0)
+	for _, r := range apis {
+		temp, err := alert.NewReceiver(r)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, temp)
 	}
+	return rs, nil
 }
 
 // update subscribe
@@ -171,7 +516,9 @@ func (s *Server) updateSubscribe(resp http.ResponseWriter, req *http.Request) {
 	}
 
 	type requestBody struct {
-		To []alert.Receiver `json:"to"`
+		To       []alert.BaseApi `json:"to"`
+		Throttle *alert.Throttle `json:"throttle"` // unchanged if absent
+		Digest   *string         `json:"digest"`   // unchanged if absent, empty to disable
 	}
 	data := requestBody{}
 	body, _ := ioutil.ReadAll(req.Body)
@@ -184,7 +531,42 @@ func (s *Server) updateSubscribe(resp http.ResponseWriter, req *http.Request) {
 	if sub, ok := s.subscribes[topic]; !ok {
 		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "topic not exists"})
 	} else {
-		sub.UpdateReceiver(data.To)
+		rs, err := createReceivers(data.To, alert.ApisOf(sub.Receivers()))
+		if err != nil {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		if data.Throttle != nil {
+			if err := data.Throttle.Validate(); err != nil {
+				write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+				return
+			}
+		}
+		state := sub.State()
+		oldDigest := state.Digest
+		newDigest := oldDigest
+		if data.Digest != nil {
+			newDigest = *data.Digest
+		}
+		digest, err := alert.ParseDigest(newDigest)
+		if err != nil {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		old, oldThrottle := sub.Receivers(), state.Throttle
+		sub.UpdateReceiver(rs)
+		if data.Throttle != nil {
+			sub.SetThrottle(data.Throttle)
+		}
+		sub.SetDigest(newDigest, digest)
+		if err := store.Store(sub); err != nil {
+			sub.UpdateReceiver(old)
+			sub.SetThrottle(oldThrottle)
+			d, _ := alert.ParseDigest(oldDigest)
+			sub.SetDigest(oldDigest, d)
+			write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "save subscribe failed: " + err.Error()})
+			return
+		}
 		write(resp, http.StatusOK, map[string]interface{}{"msg": "update success"})
 	}
 }
@@ -212,19 +594,42 @@ func (s *Server) deleteSubscribe(resp http.ResponseWriter, req *http.Request) {
 	if _, ok := s.subscribes[topic]; !ok {
 		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "topic not exists"})
 	} else {
+		if err := store.Del(topic); err != nil {
+			write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "delete subscribe failed: " + err.Error()})
+			return
+		}
 		delete(s.subscribes, topic)
+		s.escalator.DeletePolicy(topic)
 		write(resp, http.StatusOK, map[string]interface{}{"msg": "delete success"})
 	}
 }
 
+// sendMessage : send message to subscribe of topic, receivers of routes matched by labels of message
+// and users who subscribed the project or task of message. Messages inhibited by firing alerts are only recorded
 func (s *Server) sendMessage(taskName string, message alert.Message) error {
-	s.rw.Lock()
-	defer s.rw.Unlock()
-	if sub, ok := s.subscribes[taskName]; !ok {
+	if s.inhibited(taskName, message) {
 		return nil
-	} else {
-		sub.Triggered++
-		sub.LastTriggered = time.Now()
-		return sub.Send(message)
+	}
+	s.hub.Publish(taskName, "", message)
+	s.router.Dispatch(message)
+	s.users.Dispatch(message)
+	s.rw.RLock()
+	sub, ok := s.subscribes[taskName]
+	s.rw.RUnlock()
+	if !ok {
+		return nil
+	}
+	// saving and sending (which may be slow) are not under lock
+	triggered, lastTriggered := sub.Trigger()
+	if err := store.SaveTriggered(sub.Topic, triggered, lastTriggered); err != nil {
+		logrus.Errorf("save trigger counter of %s failed: %s", sub.Topic, err.Error())
+	}
+	return sub.Send(message)
+}
+
+// deliver : used by tracker to resend active alerts
+func (s *Server) deliver(topic string, message alert.Message) {
+	if err := s.sendMessage(topic, message); err != nil {
+		logrus.Errorf("deliver message of %s failed: %s", topic, err.Error())
 	}
 }
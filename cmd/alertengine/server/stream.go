@@ -0,0 +1,135 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const streamHeartbeat = 30 * time.Second
+
+// authenticate : token of query or bearer token of header, since EventSource of browsers could not set headers.
+// Returns name of the token
+func (s *Server) authenticate(req *http.Request) (string, bool) {
+	token := req.URL.Query().Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		return "", false
+	}
+	for name, t := range s.browser.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// authorize : respond error if the stream is disabled or token is invalid
+func (s *Server) authorize(resp http.ResponseWriter, req *http.Request) (string, bool) {
+	if len(s.browser.Tokens) == 0 {
+		write(resp, http.StatusNotFound, map[string]interface{}{"error": "browser stream is disabled"})
+		return "", false
+	}
+	name, ok := s.authenticate(req)
+	if !ok {
+		write(resp, http.StatusUnauthorized, map[string]interface{}{"error": "invalid token"})
+		return "", false
+	}
+	return name, true
+}
+
+func splitQuery(v string) []string {
+	var res []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// stream : push alerts to browser by server-sent events.
+// Query topics, projects and channels are separated by comma, all alerts of topics are pushed if none is set.
+// Events missed since Last-Event-ID (set by EventSource on reconnection, or query lastEventId) are replayed
+func (s *Server) stream(resp http.ResponseWriter, req *http.Request) {
+	name, ok := s.authorize(resp, req)
+	if !ok {
+		return
+	}
+	flusher, ok := resp.(http.Flusher)
+	if !ok {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "streaming is not supported"})
+		return
+	}
+	query := req.URL.Query()
+	filter := alert.StreamFilter{
+		Topics:   splitQuery(query.Get("topics")),
+		Projects: splitQuery(query.Get("projects")),
+		Channels: splitQuery(query.Get("channels")),
+	}
+	lastId := req.Header.Get("Last-Event-ID")
+	if lastId == "" {
+		lastId = query.Get("lastEventId")
+	}
+	var last uint64
+	if lastId != "" {
+		var err error
+		if last, err = strconv.ParseUint(lastId, 10, 64); err != nil {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": fmt.Sprintf("invalid last event id %s", lastId)})
+			return
+		}
+	}
+
+	client := s.hub.Connect(name, req.RemoteAddr, filter, last)
+	defer s.hub.Disconnect(client)
+	header := resp.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	resp.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintf(resp, ": connected %d\n\n", client.Id)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(resp, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e, ok := <-client.Events():
+			// closed if the client is too slow or server is stopping, browser reconnects and replays
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err = fmt.Fprintf(resp, "id: %d\nevent: alert\ndata: %s\n\n", e.Id, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// streamClients : connected browsers, require a token as the stream
+func (s *Server) streamClients(resp http.ResponseWriter, req *http.Request) {
+	if _, ok := s.authorize(resp, req); !ok {
+		return
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"data": s.hub.Clients()})
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/config"
+	"github.com/go-playground/assert/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestStreamAuth(t *testing.T) {
+	s := &Server{hub: alert.NewHub(0), browser: config.Browser{Tokens: map[string]string{"wall": "secret"}}}
+	for token, status := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "secret": http.StatusOK} {
+		resp := httptest.NewRecorder()
+		s.streamClients(resp, httptest.NewRequest(http.MethodGet, BasePath+StreamClientsPath+"?token="+token, nil))
+		assert.Equal(t, resp.Code, status)
+	}
+
+	u, _ := url.Parse("/api/stream?token=secret&topics=a")
+	assert.Equal(t, redactedURI(u), "/api/stream?token=%2A%2A%2A%2A%2A%2A&topics=a")
+	u, _ = url.Parse("/api/alert/ack?topic=a&id=1&sign=abc")
+	assert.Equal(t, redactedURI(u), "/api/alert/ack?id=1&sign=%2A%2A%2A%2A%2A%2A&topic=a")
+	u, _ = url.Parse("/api/subscribe?topic=a")
+	assert.Equal(t, redactedURI(u), "/api/subscribe?topic=a")
+}
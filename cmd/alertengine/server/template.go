@@ -0,0 +1,137 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/store"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+// get templates of topic sorted by type, including digest templates and the default ones of types without custom template
+func (s *Server) getTemplate(resp http.ResponseWriter, req *http.Request) {
+	topic := req.URL.Query().Get("topic")
+	type item struct {
+		Type    string `json:"type"`
+		Default bool   `json:"default"`
+		alert.Template
+	}
+	data := make([]item, 0)
+	custom := make(map[string]alert.Template)
+	s.rw.RLock()
+	if sub, ok := s.subscribes[topic]; ok {
+		custom = sub.CustomTemplates()
+	}
+	s.rw.RUnlock()
+	for _, t := range alert.TemplateTypes() {
+		if c, ok := custom[t]; ok {
+			data = append(data, item{Type: t, Default: false, Template: c})
+		} else {
+			d, _ := alert.DefaultTemplate(t)
+			data = append(data, item{Type: t, Default: true, Template: d})
+		}
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": data})
+}
+
+// set template of topic and receiver type, type with suffix .digest sets the digest template of receiver type
+func (s *Server) setTemplate(resp http.ResponseWriter, req *http.Request) {
+	type requestBody struct {
+		Topic string `json:"topic"`
+		Type  string `json:"type"`
+		alert.Template
+	}
+	data := requestBody{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if _, ok := alert.DefaultTemplate(data.Type); !ok {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "type not match"})
+		return
+	}
+	if err := alert.ValidateTemplate(data.Type, data.Template); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	sub, ok := s.subscribes[data.Topic]
+	if !ok {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "topic not exists"})
+		return
+	}
+	if err := store.SaveTemplate(data.Topic, data.Type, data.Template); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "save template failed: " + err.Error()})
+		return
+	}
+	sub.SetTemplate(data.Type, data.Template)
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "update success"})
+}
+
+// delete template of topic and receiver type, the default template will be used
+func (s *Server) deleteTemplate(resp http.ResponseWriter, req *http.Request) {
+	topic := req.URL.Query().Get("topic")
+	receiverType := req.URL.Query().Get("type")
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	sub, ok := s.subscribes[topic]
+	if !ok {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "topic not exists"})
+		return
+	}
+	if _, ok := sub.CustomTemplates()[receiverType]; !ok {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "template not exists"})
+		return
+	}
+	if err := store.DelTemplate(topic, receiverType); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "delete template failed: " + err.Error()})
+		return
+	}
+	sub.DeleteTemplate(receiverType)
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "delete success"})
+}
+
+// preview template with payload, use sample payload if absent. Digest templates are previewed with a sample digest.
+// the template of topic (or the default one) is used if subject and body are empty
+func (s *Server) previewTemplate(resp http.ResponseWriter, req *http.Request) {
+	type requestBody struct {
+		Topic   string         `json:"topic"`
+		Type    string         `json:"type"`
+		Payload *alert.Payload `json:"payload"`
+		alert.Template
+	}
+	data := requestBody{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	t := data.Template
+	if t.Subject == "" && t.Body == "" {
+		var ok bool
+		s.rw.RLock()
+		sub, found := s.subscribes[data.Topic]
+		s.rw.RUnlock()
+		if found {
+			t, ok = sub.Template(data.Type)
+		} else {
+			t, ok = alert.DefaultTemplate(data.Type)
+		}
+		if !ok {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": "type not match"})
+			return
+		}
+	}
+	payload := alert.SamplePayload()
+	if data.Payload != nil {
+		payload = *data.Payload
+	}
+	message, err := t.Preview(data.Type, payload)
+	if err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": message})
+}
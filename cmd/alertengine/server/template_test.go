@@ -0,0 +1,67 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	sub := &alert.Subscribe{Topic: "topic"}
+	sub.SetTemplate(alert.DingTalkType, alert.Template{Subject: "custom {{.TaskId}}", Body: "{{.Value}}"})
+	s := &Server{subscribes: map[string]*alert.Subscribe{"topic": sub}}
+	handler := s.handler()
+	do := func(method, uri, body string) (int, map[string]interface{}) {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest(method, BasePath+uri, strings.NewReader(body)))
+		var m map[string]interface{}
+		_ = json.Unmarshal(resp.Body.Bytes(), &m)
+		return resp.Code, m
+	}
+
+	// sorted by receiver type
+	code, m := do(http.MethodGet, TemplatePath+"?topic=topic", "")
+	assert.Equal(t, code, http.StatusOK)
+	var types []string
+	for _, item := range m["data"].([]interface{}) {
+		i := item.(map[string]interface{})
+		types = append(types, i["type"].(string))
+		assert.Equal(t, i["default"], i["type"] != alert.DingTalkType)
+	}
+	assert.Equal(t, types, []string{"dingTalk", "dingTalk.digest", "email", "email.digest", "feishu", "feishu.digest",
+		"weCom", "weCom.digest", "webhook", "webhook.digest"})
+
+	// template of topic, default template and template of request
+	p := alert.SamplePayload()
+	code, m = do(http.MethodPost, PreviewPath, `{"topic": "topic", "type": "dingTalk"}`)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, m["data"].(map[string]interface{})["subject"], "custom "+p.TaskId)
+	code, m = do(http.MethodPost, PreviewPath, `{"topic": "topic", "type": "weCom", "payload": {"task_id": "t9", "level": 2}}`)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.Contains(m["data"].(map[string]interface{})["body"].(string), "- 任务: t9"), true)
+	code, m = do(http.MethodPost, PreviewPath, `{"type": "email", "subject": "{{.ProjectId}}", "body": "{{.TaskId}}"}`)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, m["data"], map[string]interface{}{"subject": p.ProjectId, "body": p.TaskId})
+	// digest templates are previewed with the sample digest
+	code, m = do(http.MethodPost, PreviewPath, `{"type": "email.digest", "subject": "{{.Topic}}", "body": "{{.Total}}"}`)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, m["data"], map[string]interface{}{"subject": "sample", "body": "3"})
+	code, m = do(http.MethodPost, PreviewPath, `{"topic": "topic", "type": "dingTalk.digest"}`)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, strings.HasPrefix(m["data"].(map[string]interface{})["body"].(string), "### [摘要] sample"), true)
+	code, _ = do(http.MethodPost, PreviewPath, `{"type": "unknown"}`)
+	assert.Equal(t, code, http.StatusBadRequest)
+	code, _ = do(http.MethodPost, PreviewPath, `{"type": "email", "subject": "{{.Missing}}", "body": "b"}`)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	// deleting a template not customized is rejected before the store is touched
+	code, m = do(http.MethodDelete, TemplatePath+"?topic=topic&type=email", "")
+	assert.Equal(t, code, http.StatusBadRequest)
+	assert.Equal(t, m["error"], "template not exists")
+	code, _ = do(http.MethodDelete, TemplatePath+"?topic=unknown&type=dingTalk", "")
+	assert.Equal(t, code, http.StatusBadRequest)
+}
@@ -0,0 +1,321 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/store"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+// loadUsers : load users and their subscriptions from mysql
+func (s *Server) loadUsers() error {
+	users, err := store.GetAllUsers()
+	if err != nil {
+		return err
+	}
+	for _, record := range users {
+		u, err := store.ToUser(record)
+		if err == nil {
+			err = s.users.SetUser(u)
+		}
+		if err != nil {
+			logrus.Errorf("load user %s failed: %s", record.ID, err.Error())
+		}
+	}
+	subs, err := store.GetAllUserSubscriptions()
+	if err != nil {
+		return err
+	}
+	for _, record := range subs {
+		sub, err := store.ToUserSubscription(record)
+		if err == nil {
+			err = s.users.Subscribe(sub)
+		}
+		if err != nil {
+			logrus.Errorf("load subscription of user %s to %s/%s failed: %s",
+				record.UserId, record.ProjectId, record.TaskId, err.Error())
+		}
+	}
+	return nil
+}
+
+// get user by userId, all users if userId is empty
+func (s *Server) getUser(resp http.ResponseWriter, req *http.Request) {
+	userId := req.URL.Query().Get("userId")
+	if userId == "" {
+		users := s.users.Users()
+		for i := range users {
+			users[i] = users[i].Redacted()
+		}
+		write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": users})
+		return
+	}
+	if u, ok := s.users.User(userId); !ok {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "user not exists"})
+	} else {
+		write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": []alert.User{u.Redacted()}})
+	}
+}
+
+// create or replace user and its contacts
+func (s *Server) setUser(resp http.ResponseWriter, req *http.Request) {
+	data := alert.User{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	old, _ := s.users.User(data.Id)
+	contacts, err := alert.RestoreSecrets(data.Contacts, old.Contacts)
+	if err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	data.Contacts = contacts
+	if err := data.Validate(); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err := store.SaveUser(data); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "save user failed: " + err.Error()})
+		return
+	}
+	_ = s.users.SetUser(data)
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "update success"})
+}
+
+// delete user and all of its subscriptions
+func (s *Server) deleteUser(resp http.ResponseWriter, req *http.Request) {
+	userId := req.URL.Query().Get("userId")
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	if _, ok := s.users.User(userId); !ok {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "user not exists"})
+		return
+	}
+	for _, schedule := range s.schedules.List() {
+		for _, id := range schedule.Users() {
+			if id == userId {
+				write(resp, http.StatusBadRequest, map[string]interface{}{"error": "user is in schedule " + schedule.Name})
+				return
+			}
+		}
+	}
+	if err := store.DelUser(userId); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "delete user failed: " + err.Error()})
+		return
+	}
+	s.users.DeleteUser(userId)
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "delete success"})
+}
+
+// subscriber : contact of subscribed user, contact fields are empty if the user has no contact
+type subscriber struct {
+	UserId string      `json:"userId"`
+	Level  alert.Level `json:"level"`
+	alert.BaseApi
+}
+
+// userSubscribe : subscriptions of a project or task
+type userSubscribe struct {
+	ProjectId string       `json:"projectId"`
+	TaskId    string       `json:"taskId"`
+	To        []subscriber `json:"to"`
+}
+
+// get subscriptions filtered by userId, projectId and taskId, grouped by project and task
+func (s *Server) getUserSubscribe(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	subs := s.users.Subscriptions(query.Get("userId"), query.Get("projectId"), query.Get("taskId"))
+	res := make([]*userSubscribe, 0)
+	var last *userSubscribe
+	for _, sub := range subs {
+		if last == nil || last.ProjectId != sub.ProjectId || last.TaskId != sub.TaskId {
+			last = &userSubscribe{ProjectId: sub.ProjectId, TaskId: sub.TaskId, To: make([]subscriber, 0)}
+			res = append(res, last)
+		}
+		contacts := sub.To
+		if len(contacts) == 0 {
+			u, _ := s.users.User(sub.UserId)
+			contacts = u.Contacts
+		}
+		if len(contacts) == 0 {
+			last.To = append(last.To, subscriber{UserId: sub.UserId, Level: sub.Level})
+		}
+		for _, c := range contacts {
+			last.To = append(last.To, subscriber{UserId: sub.UserId, Level: sub.Level, BaseApi: c.Redacted()})
+		}
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": res})
+}
+
+// toSubscriptions : subscriptions of users in "to", contacts of entries with type are used instead of contacts of user
+func toSubscriptions(projectId, taskId string, level alert.Level, to []subscriber) []alert.UserSubscription {
+	res := make([]alert.UserSubscription, 0)
+	index := make(map[string]int)
+	for _, t := range to {
+		i, ok := index[t.UserId]
+		if !ok {
+			i = len(res)
+			index[t.UserId] = i
+			res = append(res, alert.UserSubscription{UserId: t.UserId, ProjectId: projectId, TaskId: taskId, Level: level})
+		}
+		if t.Type != "" {
+			res[i].To = append(res[i].To, t.BaseApi)
+		}
+	}
+	return res
+}
+
+// checkSubscription : validate subscription and check the user exists and has contacts, must hold the lock
+func (s *Server) checkSubscription(sub alert.UserSubscription) error {
+	if err := sub.Validate(); err != nil {
+		return err
+	}
+	if _, err := alert.RestoreSecrets(sub.To, nil); err != nil {
+		return err
+	}
+	u, ok := s.users.User(sub.UserId)
+	if !ok {
+		return fmt.Errorf("user %s not exists", sub.UserId)
+	}
+	if len(sub.To) == 0 && len(u.Contacts) == 0 {
+		return fmt.Errorf("user %s has no contact", sub.UserId)
+	}
+	return nil
+}
+
+// subscribe users in "to" to project, or a task of project if taskId is not empty
+func (s *Server) createUserSubscribe(resp http.ResponseWriter, req *http.Request) {
+	type requestBody struct {
+		ProjectId string       `json:"projectId"`
+		TaskId    string       `json:"taskId"`
+		Level     alert.Level  `json:"level"`
+		To        []subscriber `json:"to"`
+	}
+	data := requestBody{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	subs := toSubscriptions(data.ProjectId, data.TaskId, data.Level, data.To)
+	if len(subs) == 0 {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "to could not be empty"})
+		return
+	}
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	for _, sub := range subs {
+		if err := s.checkSubscription(sub); err != nil {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		if _, ok := s.users.Subscription(sub.UserId, sub.ProjectId, sub.TaskId); ok {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": fmt.Sprintf("user %s already subscribed", sub.UserId)})
+			return
+		}
+	}
+	if err := store.SaveUserSubscriptions(subs); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "save subscribe failed: " + err.Error()})
+		return
+	}
+	for _, sub := range subs {
+		_ = s.users.Subscribe(sub)
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "create success"})
+}
+
+// update level or contacts of subscription of user to project and task
+func (s *Server) updateUserSubscribe(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	userId, projectId, taskId := query.Get("userId"), query.Get("projectId"), query.Get("taskId")
+	type requestBody struct {
+		Level *alert.Level  `json:"level"` // unchanged if absent
+		To    *[]subscriber `json:"to"`    // unchanged if absent, empty to use contacts of user
+	}
+	data := requestBody{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	sub, ok := s.users.Subscription(userId, projectId, taskId)
+	if !ok {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "subscribe not exists"})
+		return
+	}
+	if data.Level != nil {
+		sub.Level = *data.Level
+	}
+	if data.To != nil {
+		// redacted contacts of user are shown if the subscription has no contact
+		u, _ := s.users.User(userId)
+		saved := append(append([]alert.BaseApi{}, sub.To...), u.Contacts...)
+		sub.To = nil
+		for _, t := range *data.To {
+			if t.UserId != "" && t.UserId != userId {
+				write(resp, http.StatusBadRequest, map[string]interface{}{"error": "userId of to must be the same as the param"})
+				return
+			}
+			if t.Type != "" {
+				sub.To = append(sub.To, t.BaseApi)
+			}
+		}
+		to, err := alert.RestoreSecrets(sub.To, saved)
+		if err != nil {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		sub.To = to
+	}
+	if err := s.checkSubscription(sub); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if err := store.SaveUserSubscriptions([]alert.UserSubscription{sub}); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "save subscribe failed: " + err.Error()})
+		return
+	}
+	_ = s.users.Subscribe(sub)
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "update success"})
+}
+
+// delete subscription of user to project and task, all subscriptions of user if projectId is empty
+func (s *Server) deleteUserSubscribe(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	userId, projectId, taskId := query.Get("userId"), query.Get("projectId"), query.Get("taskId")
+	if userId == "" {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "userId could not be empty"})
+		return
+	}
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	var subs []alert.UserSubscription
+	if projectId != "" {
+		sub, ok := s.users.Subscription(userId, projectId, taskId)
+		if !ok {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": "subscribe not exists"})
+			return
+		}
+		subs = append(subs, sub)
+	}
+	if err := store.DelUserSubscriptions(userId, subs); err != nil {
+		write(resp, http.StatusInternalServerError, map[string]interface{}{"error": "delete subscribe failed: " + err.Error()})
+		return
+	}
+	if len(subs) == 0 {
+		subs = s.users.Subscriptions(userId, "", "")
+	}
+	for _, sub := range subs {
+		s.users.Unsubscribe(sub.UserId, sub.ProjectId, sub.TaskId)
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "delete success"})
+}
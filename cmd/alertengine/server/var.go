@@ -1,8 +1,11 @@
 package server
 
+import "time"
+
 const (
 	defaultServiceName = "alertEngine"
 	defaultHttpPort    = 5050
+	shutdownTimeout    = 30 * time.Second // wait for in-flight requests when stopping
 )
 
 const (
@@ -12,8 +15,44 @@ const (
 	SmtpPasswordEnv = "SMTP_PASSWORD"
 )
 
+// dapr programmatic subscription
+const (
+	DaprSubscribePath = "/dapr/subscribe"
+	DaprEventPath     = "/dapr/events"
+)
+
+// metrics and probes, not under BasePath
+const (
+	MetricsPath   = "/metrics"
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
 const (
-	BasePath      = "/api"
-	AlertPath     = "/alert"
-	SubscribePath = "/subscribe"
+	BasePath          = "/api"
+	AlertPath         = "/alert"
+	ActivePath        = "/alert/active"
+	AckPath           = "/alert/ack"
+	SilencePath       = "/alert/silence"
+	SubscribePath     = "/subscribe"
+	TemplatePath      = "/template"
+	PreviewPath       = "/template/preview"
+	DeadPath          = "/deadletter"
+	RedeliverPath     = "/deadletter/redeliver"
+	DeliveryPath      = "/delivery"
+	EscalatePath      = "/escalation"
+	RoutePath         = "/route"
+	RouteTestPath     = "/route/test"
+	InhibitPath       = "/inhibit"
+	InhibitTestPath   = "/inhibit/test"
+	InhibitedPath     = "/inhibit/record"
+	VerifyPath        = "/receiver/test"
+	ChartPath         = "/chart"
+	UserPath          = "/user"
+	UserSubscribePath = "/user/subscribe"
+	OnCallPath        = "/oncall"
+	SchedulePath      = "/oncall/schedule"
+	SecretRotatePath  = "/secret/rotate"
+	StreamPath        = "/stream"
+	StreamClientsPath = "/stream/clients"
 )
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/store"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+)
+
+// loadVerifications : load the last verification results of receivers, must hold the lock
+func (s *Server) loadVerifications() error {
+	records, err := store.GetAllVerifications()
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if sub, ok := s.subscribes[r.Topic]; ok {
+			// results saved before secret addresses are hashed are keyed by address, they are saved by id next time
+			id := r.ReceiverId
+			for _, receiver := range sub.Receivers() {
+				if receiver.Api().Address == id {
+					id = receiver.Id()
+				}
+			}
+			sub.SetVerified(alert.Verification{
+				ReceiverId: id,
+				Type:       r.Type,
+				Success:    r.Success,
+				Error:      r.Error,
+				LatencyMs:  r.LatencyMs,
+				VerifiedAt: r.VerifiedAt,
+			})
+		}
+	}
+	return nil
+}
+
+// send a test message through receiver of topic, all receivers of topic if receiver is empty.
+// Receivers in "to" are verified without saving, which is used to check receivers before creating subscribe
+func (s *Server) verifyReceiver(resp http.ResponseWriter, req *http.Request) {
+	type requestBody struct {
+		Topic    string          `json:"topic"`
+		Receiver string          `json:"receiver"` // receiver id, such as address of email
+		To       []alert.BaseApi `json:"to"`
+	}
+	data := requestBody{}
+	body, _ := ioutil.ReadAll(req.Body)
+	if err := json.Unmarshal(body, &data); err != nil {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		return
+	}
+	s.rw.RLock()
+	sub, ok := s.subscribes[data.Topic]
+	s.rw.RUnlock()
+
+	if len(data.To) > 0 {
+		var saved []alert.BaseApi
+		if ok {
+			saved = alert.ApisOf(sub.Receivers())
+		}
+		rs, err := createReceivers(data.To, saved)
+		if err != nil {
+			write(resp, http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+			return
+		}
+		var templates map[string]alert.Template
+		if ok {
+			templates = sub.CustomTemplates()
+		}
+		write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": alert.VerifyReceivers(data.Topic, rs, templates)})
+		return
+	}
+	if !ok {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "topic not exists"})
+		return
+	}
+	res := sub.Verify(data.Receiver)
+	if len(res) == 0 {
+		write(resp, http.StatusBadRequest, map[string]interface{}{"error": "receiver not exists"})
+		return
+	}
+	if err := store.SaveVerifications(data.Topic, res); err != nil {
+		logrus.Errorf("save verification of %s failed: %s", data.Topic, err.Error())
+	}
+	write(resp, http.StatusOK, map[string]interface{}{"msg": "success", "data": res})
+}
@@ -0,0 +1,624 @@
+package store
+
+import (
+	"anomaly-detect/cmd/alertengine/alert"
+	"anomaly-detect/cmd/alertengine/db"
+	"anomaly-detect/cmd/alertengine/model"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const queryWithTopic = "topic=?"
+
+// Store : create or update subscribe and replace all of its receivers
+func Store(sub *alert.Subscribe) error {
+	state := sub.State()
+	record := model.Subscribe{
+		Topic:         sub.Topic,
+		Triggered:     state.Triggered,
+		LastTriggered: state.LastTriggered,
+		CreatedAt:     state.CreatedAt,
+		UpdatedAt:     state.UpdatedAt,
+		Digest:        state.Digest,
+	}
+	if state.Throttle != nil {
+		throttle, err := json.Marshal(state.Throttle)
+		if err != nil {
+			return err
+		}
+		record.Throttle = string(throttle)
+	}
+	verifications := make([]model.Verification, 0)
+	for _, v := range sub.Verifications() {
+		verifications = append(verifications, toVerification(sub.Topic, v))
+	}
+	var receivers []model.Receiver
+	for _, r := range sub.Receivers() {
+		api, err := r.Api().Seal()
+		if err != nil {
+			return err
+		}
+		options, err := json.Marshal(api.Options)
+		if err != nil {
+			return err
+		}
+		receivers = append(receivers, model.Receiver{
+			Topic:   sub.Topic,
+			Type:    api.Type,
+			Address: api.Address,
+			Token:   api.Token,
+			Options: string(options),
+		})
+	}
+	return db.MysqlClient.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&record).Error; err != nil {
+			return err
+		}
+		if err := tx.Where(queryWithTopic, sub.Topic).Delete(model.Receiver{}).Error; err != nil {
+			return err
+		}
+		if len(receivers) > 0 {
+			if err := tx.Create(&receivers).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where(queryWithTopic, sub.Topic).Delete(model.Verification{}).Error; err != nil {
+			return err
+		}
+		if len(verifications) > 0 {
+			return tx.Create(&verifications).Error
+		}
+		return nil
+	})
+}
+
+// SaveTriggered : update trigger counter of subscribe, counters are saved outside lock so an older trigger is ignored
+func SaveTriggered(topic string, triggered int, lastTriggered time.Time) error {
+	return db.MysqlClient.DB.Model(&model.Subscribe{}).Where(queryWithTopic, topic).Where("last_triggered < ?", lastTriggered).
+		Updates(map[string]interface{}{"triggered": triggered, "last_triggered": lastTriggered}).Error
+}
+
+// ToApi : restore receiver api from record, secrets are decrypted
+func ToApi(r model.Receiver) (alert.BaseApi, error) {
+	api := alert.BaseApi{Type: r.Type, Address: r.Address, Token: r.Token}
+	if r.Options != "" {
+		if err := json.Unmarshal([]byte(r.Options), &api.Options); err != nil {
+			return api, err
+		}
+	}
+	return api.Open()
+}
+
+// ToThrottle : restore throttle of subscribe, nil if not set. Throttle is not validated
+func ToThrottle(s model.Subscribe) (*alert.Throttle, error) {
+	if s.Throttle == "" {
+		return nil, nil
+	}
+	t := &alert.Throttle{}
+	err := json.Unmarshal([]byte(s.Throttle), t)
+	return t, err
+}
+
+func GetAll() ([]model.Subscribe, error) {
+	var records []model.Subscribe
+	err := db.MysqlClient.DB.Find(&records).Error
+	return records, err
+}
+
+func GetAllReceivers() ([]model.Receiver, error) {
+	var records []model.Receiver
+	err := db.MysqlClient.DB.Order("id").Find(&records).Error
+	return records, err
+}
+
+func Del(topic string) error {
+	return db.MysqlClient.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(queryWithTopic, topic).Delete(model.Receiver{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where(queryWithTopic, topic).Delete(model.Template{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where(queryWithTopic, topic).Delete(model.Escalation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where(queryWithTopic, topic).Delete(model.Verification{}).Error; err != nil {
+			return err
+		}
+		return tx.Where(queryWithTopic, topic).Delete(model.Subscribe{}).Error
+	})
+}
+
+func SaveTemplate(topic, receiverType string, t alert.Template) error {
+	record := model.Template{
+		Topic:   topic,
+		Type:    receiverType,
+		Subject: t.Subject,
+		Body:    t.Body,
+		Html:    t.Html,
+	}
+	return db.MysqlClient.DB.Save(&record).Error
+}
+
+func GetAllTemplates() ([]model.Template, error) {
+	var records []model.Template
+	err := db.MysqlClient.DB.Find(&records).Error
+	return records, err
+}
+
+func DelTemplate(topic, receiverType string) error {
+	return db.MysqlClient.DB.Where("topic=? and type=?", topic, receiverType).Delete(model.Template{}).Error
+}
+
+func SaveEscalation(p alert.EscalationPolicy) error {
+	p, err := p.Sealed()
+	if err != nil {
+		return err
+	}
+	tiers, err := json.Marshal(p.Tiers)
+	if err != nil {
+		return err
+	}
+	record := model.Escalation{
+		Topic:     p.Topic,
+		Tiers:     string(tiers),
+		UpdatedAt: time.Now(),
+	}
+	return db.MysqlClient.DB.Save(&record).Error
+}
+
+func GetAllEscalations() ([]model.Escalation, error) {
+	var records []model.Escalation
+	err := db.MysqlClient.DB.Find(&records).Error
+	return records, err
+}
+
+// ToPolicy : policy is not validated
+func ToPolicy(e model.Escalation) (alert.EscalationPolicy, error) {
+	p := alert.EscalationPolicy{Topic: e.Topic}
+	if err := json.Unmarshal([]byte(e.Tiers), &p.Tiers); err != nil {
+		return p, err
+	}
+	return p.Opened()
+}
+
+func DelEscalation(topic string) error {
+	return db.MysqlClient.DB.Where(queryWithTopic, topic).Delete(model.Escalation{}).Error
+}
+
+// SaveRoutes : replace the whole routing tree
+func SaveRoutes(routes []*alert.Route) error {
+	routes, err := alert.SealRoutes(routes)
+	if err != nil {
+		return err
+	}
+	records := make([]model.Route, 0, len(routes))
+	for i, r := range routes {
+		content, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		records = append(records, model.Route{
+			Position:  i,
+			Name:      r.Name,
+			Content:   string(content),
+			UpdatedAt: time.Now(),
+		})
+	}
+	return db.MysqlClient.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1=1").Delete(model.Route{}).Error; err != nil {
+			return err
+		}
+		if len(records) > 0 {
+			return tx.Create(&records).Error
+		}
+		return nil
+	})
+}
+
+// GetRoutes : routes are not validated
+func GetRoutes() ([]*alert.Route, error) {
+	var records []model.Route
+	if err := db.MysqlClient.DB.Order("position").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	routes := make([]*alert.Route, 0, len(records))
+	for _, record := range records {
+		r := &alert.Route{}
+		if err := json.Unmarshal([]byte(record.Content), r); err != nil {
+			return nil, err
+		}
+		routes = append(routes, r)
+	}
+	return alert.OpenRoutes(routes)
+}
+
+func toVerification(topic string, v alert.Verification) model.Verification {
+	return model.Verification{
+		Topic:      topic,
+		ReceiverId: v.ReceiverId,
+		Type:       v.Type,
+		Success:    v.Success,
+		Error:      v.Error,
+		LatencyMs:  v.LatencyMs,
+		VerifiedAt: v.VerifiedAt,
+	}
+}
+
+// SaveVerifications : save the last verification results of receivers
+func SaveVerifications(topic string, vs []alert.Verification) error {
+	if len(vs) == 0 {
+		return nil
+	}
+	records := make([]model.Verification, 0, len(vs))
+	for _, v := range vs {
+		records = append(records, toVerification(topic, v))
+	}
+	return db.MysqlClient.DB.Save(&records).Error
+}
+
+func GetAllVerifications() ([]model.Verification, error) {
+	var records []model.Verification
+	err := db.MysqlClient.DB.Find(&records).Error
+	return records, err
+}
+
+func SaveDeadLetter(d alert.Delivery) error {
+	api, err := d.Receiver.Api().Seal()
+	if err != nil {
+		return err
+	}
+	options, err := json.Marshal(api.Options)
+	if err != nil {
+		return err
+	}
+	record := model.DeadLetter{
+		Topic:     d.Topic,
+		Type:      api.Type,
+		Address:   api.Address,
+		Token:     api.Token,
+		Options:   string(options),
+		Subject:   d.Message.Title(),
+		Body:      d.Message.Content(),
+		Attempts:  d.Attempts,
+		LastError: d.LastError,
+		CreatedAt: d.Created,
+		UpdatedAt: time.Now(),
+	}
+	if structured, ok := d.Message.(alert.Structured); ok {
+		payload, err := json.Marshal(structured.Data())
+		if err != nil {
+			return err
+		}
+		record.Payload = string(payload)
+	}
+	return db.MysqlClient.DB.Create(&record).Error
+}
+
+// GetDeadLetters : query dead letters by topic and created time, topic could be empty
+func GetDeadLetters(topic string, start, stop time.Time, limit int) ([]model.DeadLetter, error) {
+	records := make([]model.DeadLetter, 0)
+	tx := db.MysqlClient.DB.Where("created_at >= ? and created_at < ?", start, stop)
+	if topic != "" {
+		tx = tx.Where(queryWithTopic, topic)
+	}
+	err := tx.Order("id desc").Limit(limit).Find(&records).Error
+	return records, err
+}
+
+func GetDeadLetter(id int) (model.DeadLetter, error) {
+	var record model.DeadLetter
+	err := db.MysqlClient.DB.Where("id=?", id).First(&record).Error
+	return record, err
+}
+
+func SaveDeadLetterAttempt(id int, attempts int, lastError string) error {
+	return db.MysqlClient.DB.Model(&model.DeadLetter{}).Where("id=?", id).
+		Updates(map[string]interface{}{"attempts": attempts, "last_error": lastError, "updated_at": time.Now()}).Error
+}
+
+// ResealDeadLetters : encrypt secrets of all dead letters with the first secret key, return the number of updated
+func ResealDeadLetters() (int, error) {
+	var records []model.DeadLetter
+	if err := db.MysqlClient.DB.Find(&records).Error; err != nil {
+		return 0, err
+	}
+	updated := 0
+	for _, record := range records {
+		api, err := ToApi(model.Receiver{Type: record.Type, Address: record.Address, Token: record.Token, Options: record.Options})
+		if err != nil {
+			return updated, fmt.Errorf("dead letter %d: %s", record.ID, err.Error())
+		}
+		if api, err = api.Seal(); err != nil {
+			return updated, err
+		}
+		options, err := json.Marshal(api.Options)
+		if err != nil {
+			return updated, err
+		}
+		if api.Address == record.Address && api.Token == record.Token && string(options) == record.Options {
+			continue
+		}
+		err = db.MysqlClient.DB.Model(&model.DeadLetter{}).Where("id=?", record.ID).
+			Updates(map[string]interface{}{"address": api.Address, "token": api.Token, "options": string(options)}).Error
+		if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+func DelDeadLetter(id int) error {
+	return db.MysqlClient.DB.Where("id=?", id).Delete(model.DeadLetter{}).Error
+}
+
+func SaveDeliveryLogs(logs []model.DeliveryLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return db.MysqlClient.DB.Create(&logs).Error
+}
+
+// GetDeliveryLogs : query delivery logs by topic, receiver and time, topic and receiver could be empty.
+// success filters outcome if not nil
+func GetDeliveryLogs(topic, receiverId string, success *bool, start, stop time.Time, limit int) ([]model.DeliveryLog, error) {
+	records := make([]model.DeliveryLog, 0)
+	tx := db.MysqlClient.DB.Where("created_at >= ? and created_at < ?", start, stop)
+	if topic != "" {
+		tx = tx.Where(queryWithTopic, topic)
+	}
+	if receiverId != "" {
+		tx = tx.Where("receiver_id=?", receiverId)
+	}
+	if success != nil {
+		tx = tx.Where("success=?", *success)
+	}
+	err := tx.Order("id desc").Limit(limit).Find(&records).Error
+	return records, err
+}
+
+const queryWithUser = "user_id=?"
+
+// SaveUser : create or update user, created time is kept
+func SaveUser(u alert.User) error {
+	apis, err := alert.SealApis(u.Contacts)
+	if err != nil {
+		return err
+	}
+	contacts, err := json.Marshal(apis)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	record := model.User{ID: u.Id, Name: u.Name, Contacts: string(contacts), CreatedAt: now, UpdatedAt: now}
+	var old model.User
+	if err := db.MysqlClient.DB.Where("id=?", u.Id).Limit(1).Find(&old).Error; err != nil {
+		return err
+	}
+	if old.ID != "" {
+		record.CreatedAt = old.CreatedAt
+	}
+	return db.MysqlClient.DB.Save(&record).Error
+}
+
+func GetAllUsers() ([]model.User, error) {
+	var records []model.User
+	err := db.MysqlClient.DB.Find(&records).Error
+	return records, err
+}
+
+// ToUser : user is not validated
+func ToUser(u model.User) (alert.User, error) {
+	user := alert.User{Id: u.ID, Name: u.Name}
+	if err := json.Unmarshal([]byte(u.Contacts), &user.Contacts); err != nil {
+		return user, err
+	}
+	var err error
+	user.Contacts, err = alert.OpenApis(user.Contacts)
+	return user, err
+}
+
+// DelUser : delete user and all of its subscriptions
+func DelUser(id string) error {
+	return db.MysqlClient.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(queryWithUser, id).Delete(model.UserSubscription{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id=?", id).Delete(model.User{}).Error
+	})
+}
+
+// SaveUserSubscriptions : create or update subscriptions of users
+func SaveUserSubscriptions(subs []alert.UserSubscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	records := make([]model.UserSubscription, 0, len(subs))
+	for _, s := range subs {
+		record := model.UserSubscription{
+			UserId:    s.UserId,
+			ProjectId: s.ProjectId,
+			TaskId:    s.TaskId,
+			Level:     int(s.Level),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if len(s.To) > 0 {
+			apis, err := alert.SealApis(s.To)
+			if err != nil {
+				return err
+			}
+			to, err := json.Marshal(apis)
+			if err != nil {
+				return err
+			}
+			record.To = string(to)
+		}
+		records = append(records, record)
+	}
+	return db.MysqlClient.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range records {
+			var old model.UserSubscription
+			err := tx.Where("user_id=? and project_id=? and task_id=?", records[i].UserId, records[i].ProjectId, records[i].TaskId).
+				Limit(1).Find(&old).Error
+			if err != nil {
+				return err
+			}
+			if old.UserId != "" {
+				records[i].CreatedAt = old.CreatedAt
+			}
+			if err := tx.Save(&records[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func GetAllUserSubscriptions() ([]model.UserSubscription, error) {
+	var records []model.UserSubscription
+	err := db.MysqlClient.DB.Find(&records).Error
+	return records, err
+}
+
+// ToUserSubscription : subscription is not validated
+func ToUserSubscription(s model.UserSubscription) (alert.UserSubscription, error) {
+	sub := alert.UserSubscription{UserId: s.UserId, ProjectId: s.ProjectId, TaskId: s.TaskId, Level: alert.Level(s.Level)}
+	if s.To != "" {
+		if err := json.Unmarshal([]byte(s.To), &sub.To); err != nil {
+			return sub, err
+		}
+	}
+	var err error
+	sub.To, err = alert.OpenApis(sub.To)
+	return sub, err
+}
+
+// DelUserSubscriptions : delete subscriptions of user, all subscriptions of user are deleted if subs is empty
+func DelUserSubscriptions(userId string, subs []alert.UserSubscription) error {
+	if len(subs) == 0 {
+		return db.MysqlClient.DB.Where(queryWithUser, userId).Delete(model.UserSubscription{}).Error
+	}
+	return db.MysqlClient.DB.Transaction(func(tx *gorm.DB) error {
+		for _, s := range subs {
+			err := tx.Where("user_id=? and project_id=? and task_id=?", userId, s.ProjectId, s.TaskId).
+				Delete(model.UserSubscription{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func SaveSchedule(s alert.Schedule) error {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	record := model.Schedule{Name: s.Name, Content: string(content), UpdatedAt: time.Now()}
+	return db.MysqlClient.DB.Save(&record).Error
+}
+
+// GetAllSchedules : schedules are not validated
+func GetAllSchedules() ([]alert.Schedule, error) {
+	var records []model.Schedule
+	if err := db.MysqlClient.DB.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	schedules := make([]alert.Schedule, 0, len(records))
+	for _, record := range records {
+		var s alert.Schedule
+		if err := json.Unmarshal([]byte(record.Content), &s); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+func DelSchedule(name string) error {
+	return db.MysqlClient.DB.Where("name=?", name).Delete(model.Schedule{}).Error
+}
+
+// SaveInhibitRules : replace all inhibit rules
+func SaveInhibitRules(rules []*alert.InhibitRule) error {
+	records := make([]model.InhibitRule, 0, len(rules))
+	for i, r := range rules {
+		content, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		records = append(records, model.InhibitRule{
+			Position:  i,
+			Name:      r.Name,
+			Content:   string(content),
+			UpdatedAt: time.Now(),
+		})
+	}
+	return db.MysqlClient.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1=1").Delete(model.InhibitRule{}).Error; err != nil {
+			return err
+		}
+		if len(records) > 0 {
+			return tx.Create(&records).Error
+		}
+		return nil
+	})
+}
+
+// GetInhibitRules : rules are not validated
+func GetInhibitRules() ([]*alert.InhibitRule, error) {
+	var records []model.InhibitRule
+	if err := db.MysqlClient.DB.Order("position").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	rules := make([]*alert.InhibitRule, 0, len(records))
+	for _, record := range records {
+		r := &alert.InhibitRule{}
+		if err := json.Unmarshal([]byte(record.Content), r); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// SaveInhibited : record message of topic suppressed by inhibition
+func SaveInhibited(topic string, message alert.Message, inhibition alert.Inhibition) error {
+	labels, err := json.Marshal(alert.LabelsOf(message))
+	if err != nil {
+		return err
+	}
+	source, err := json.Marshal(inhibition.Labels)
+	if err != nil {
+		return err
+	}
+	record := model.Inhibited{
+		Topic:        topic,
+		Title:        message.Title(),
+		Labels:       string(labels),
+		Rule:         inhibition.Rule,
+		SourceTopic:  inhibition.Topic,
+		SourceId:     inhibition.Id,
+		SourceLabels: string(source),
+		CreatedAt:    time.Now(),
+	}
+	return db.MysqlClient.DB.Create(&record).Error
+}
+
+// GetInhibited : query inhibited messages by topic and created time, topic could be empty
+func GetInhibited(topic string, start, stop time.Time, limit int) ([]model.Inhibited, error) {
+	records := make([]model.Inhibited, 0)
+	tx := db.MysqlClient.DB.Where("created_at >= ? and created_at < ?", start, stop)
+	if topic != "" {
+		tx = tx.Where(queryWithTopic, topic)
+	}
+	err := tx.Order("id desc").Limit(limit).Find(&records).Error
+	return records, err
+}
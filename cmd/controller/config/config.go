@@ -1,6 +1,7 @@
 package config
 
 import (
+	"anomaly-detect/cmd/controller/task/record"
 	"anomaly-detect/pkg/influxdb"
 	"anomaly-detect/pkg/mysql"
 	"gopkg.in/yaml.v2"
@@ -8,8 +9,9 @@ import (
 )
 
 type Config struct {
-	Influxdb influxdb.Account `yaml:"influxdb"`
-	Mysql    mysql.Account    `yaml:"mysql"`
+	Influxdb influxdb.Account      `yaml:"influxdb"`
+	Mysql    mysql.Account         `yaml:"mysql"`
+	Publish  record.PublishOptions `yaml:"publish"` // 告警推送到 alertengine
 }
 
 func (c Config) Validate() error {
@@ -19,6 +21,9 @@ func (c Config) Validate() error {
 	if err := c.Mysql.Validate(); err != nil {
 		return err
 	}
+	if err := c.Publish.Validate(); err != nil {
+		return err
+	}
 	return nil
 }
 
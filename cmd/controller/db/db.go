@@ -41,6 +41,16 @@ func InfluxdbClientClose() {
 	}
 }
 
+// MysqlClientClose 关闭 mysql 连接池
+func MysqlClientClose() {
+	if MysqlClient == nil {
+		return
+	}
+	if sqlDB, err := MysqlClient.DB.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+}
+
 func Init() {
 	// init table
 	if MysqlClient == nil {
@@ -4,10 +4,14 @@ import (
 	"anomaly-detect/cmd/controller/config"
 	"anomaly-detect/cmd/controller/db"
 	"anomaly-detect/cmd/controller/server"
+	"anomaly-detect/cmd/controller/task/record"
 	"anomaly-detect/cmd/controller/task/service"
 	"flag"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 var configFilePath = flag.String("config", "", "input config file path")
@@ -28,6 +32,11 @@ func main() {
 		return
 	}
 
+	if err := conf.Validate(); err != nil {
+		logrus.Errorf("server start failed: %s", err.Error())
+		return
+	}
+
 	// init influxdb connector
 	db.InitInfluxdbClient(conf.Influxdb)
 	logrus.Infof("init influxdb success using config bucket:%s org:%s url:%s",
@@ -46,18 +55,39 @@ func main() {
 
 	db.Init()
 
-	defer db.InfluxdbClientClose()
-
 	service.Load() // 载入模型
 
 	serv, err := server.NewController()
 	if err != nil {
 		logrus.Errorf("server start failed: %s", err.Error())
+		db.InfluxdbClientClose()
+		db.MysqlClientClose()
 		return
 	}
 
-	if err := serv.Start(); err != nil {
-		logrus.Errorf("server start failed: %s", err.Error())
+	// 告警通过 dapr pub/sub 推送给 alertengine
+	record.InitPublisher(serv.Publish, conf.Publish)
+	if conf.Publish.Pubsub != "" {
+		logrus.Infof("publish alerts to pubsub %s topic %s", conf.Publish.Pubsub, conf.Publish.Topic)
+	}
+
+	exit := make(chan error, 1)   // internal exit signal, cause by program error
+	sg := make(chan os.Signal, 1) // external interrupt signal, send by user
+	signal.Notify(sg, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+
+	go func() {
+		exit <- serv.Start()
+	}()
+
+	// 数据库连接由 Stop 关闭
+	select {
+	case info := <-sg:
+		serv.Stop()
+		logrus.Infof("service stop: %s", info.String())
+	case err := <-exit:
+		serv.Stop()
+		if err != nil {
+			logrus.Errorf("service stop: %s", err.Error())
+		}
 	}
-	serv.Stop()
 }
@@ -2,8 +2,12 @@ package server
 
 import (
 	"anomaly-detect/cmd/controller/task/record"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"net/http"
+	"strconv"
 )
 
 func (c *Controller) getSystemRecord(ctx *gin.Context) {
@@ -44,3 +48,147 @@ func (c *Controller) getAlertRecord(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, ginResponse{Status: 0, Msg: "success", Data: res})
 	}
 }
+
+func (c *Controller) getUnionRecord(ctx *gin.Context) {
+	projectId := ctx.Query("projectId")
+	if projectId == "" {
+		ctx.JSON(http.StatusOK, ginResponse{Status: -1, Msg: "projectId cannot be empty"})
+		return
+	}
+	taskId := ctx.Query("taskId")
+	start := ctx.Query("start")
+	stop := ctx.Query("end")
+	res, err := record.GetUnionRecord(projectId, taskId, start, stop)
+	if err != nil {
+		ctx.JSON(http.StatusOK, ginResponse{Status: -1, Msg: err.Error()})
+	} else {
+		ctx.JSON(http.StatusOK, ginResponse{Status: 0, Msg: "success", Data: res})
+	}
+}
+
+// 记录检索
+// params:
+// measurement 	记录类型 alert/system/union，默认 alert
+// projectId 	项目id，不能为空
+// taskId sensorMac sensorType receiveNo 	可为空
+// level 		system 记录的等级 info/error，可为空
+// alert 		true/false，alert/union 记录的告警状态，可为空
+// start end 	时间范围，格式 2006-01-02 15:04:05，默认最近7天
+// order 		asc/desc，默认 desc
+// limit 		每页条数，默认100，最大1000
+// cursor 		上一页返回的 next
+func (c *Controller) queryRecord(ctx *gin.Context) {
+	q, err := parseRecordQuery(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusOK, ginResponse{Status: -1, Msg: err.Error()})
+		return
+	}
+	if limit := ctx.Query("limit"); limit != "" {
+		v, err := strconv.Atoi(limit)
+		if err != nil {
+			ctx.JSON(http.StatusOK, ginResponse{Status: -1, Msg: "limit must be integer"})
+			return
+		}
+		q.Limit = v
+	}
+	res, err := record.Search(q)
+	if err != nil {
+		ctx.JSON(http.StatusOK, ginResponse{Status: -1, Msg: err.Error()})
+	} else {
+		ctx.JSON(http.StatusOK, ginResponse{Status: 0, Msg: "success", Data: res})
+	}
+}
+
+// 记录导出
+// params:
+// format 		csv/xlsx，默认 csv
+// 其余参数同 queryRecord（limit 与 cursor 除外）
+func (c *Controller) exportRecord(ctx *gin.Context) {
+	q, err := parseRecordQuery(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusOK, ginResponse{Status: -1, Msg: err.Error()})
+		return
+	}
+	format := ctx.DefaultQuery("format", record.CsvFormat)
+	// 参数、传感器信息与第一页查询出错时尚未写出响应头，返回 json 错误
+	exporter, err := record.NewExporter(format, q)
+	if err != nil {
+		ctx.JSON(http.StatusOK, ginResponse{Status: -1, Msg: err.Error()})
+		return
+	}
+	if format == record.XlsxFormat {
+		ctx.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	} else {
+		ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", record.ExportFileName(q, format)))
+	ctx.Status(http.StatusOK)
+	// 数据以流的形式写出，之后出错时响应头已发送，只能记录日志
+	if err := exporter.Export(ctx.Writer); err != nil {
+		logrus.Errorf("export record of project %s failed: %s", q.ProjectId, err.Error())
+	}
+}
+
+func parseRecordQuery(ctx *gin.Context) (record.Query, error) {
+	q := record.Query{
+		Measurement: ctx.Query("measurement"),
+		ProjectId:   ctx.Query("projectId"),
+		TaskId:      ctx.Query("taskId"),
+		SensorMac:   ctx.Query("sensorMac"),
+		SensorType:  ctx.Query("sensorType"),
+		ReceiveNo:   ctx.Query("receiveNo"),
+		Level:       ctx.Query("level"),
+		Start:       ctx.Query("start"),
+		Stop:        ctx.Query("end"),
+		Cursor:      ctx.Query("cursor"),
+	}
+	if alert := ctx.Query("alert"); alert != "" {
+		v, err := strconv.ParseBool(alert)
+		if err != nil {
+			return q, errors.New("alert must be true or false")
+		}
+		q.Alert = &v
+	}
+	switch ctx.DefaultQuery("order", "desc") {
+	case "desc":
+		q.Desc = true
+	case "asc":
+		q.Desc = false
+	default:
+		return q, errors.New("order must be asc or desc")
+	}
+	return q, nil
+}
+
+// 记录统计
+// params:
+// kind 		daily 每天各任务告警状态的记录数 (非去重的告警次数); top 告警状态的记录数最多的传感器
+// measurement 	记录类型 alert/system/union，默认 alert
+// projectId 	项目id，不能为空
+// taskId level start end 	同 queryRecord
+// n 			top 统计返回的传感器个数，默认10
+func (c *Controller) aggregateRecord(ctx *gin.Context) {
+	q := record.AggregateQuery{
+		Measurement: ctx.Query("measurement"),
+		Kind:        ctx.Query("kind"),
+		ProjectId:   ctx.Query("projectId"),
+		TaskId:      ctx.Query("taskId"),
+		Level:       ctx.Query("level"),
+		Start:       ctx.Query("start"),
+		Stop:        ctx.Query("end"),
+	}
+	if n := ctx.Query("n"); n != "" {
+		v, err := strconv.Atoi(n)
+		if err != nil {
+			ctx.JSON(http.StatusOK, ginResponse{Status: -1, Msg: "n must be integer"})
+			return
+		}
+		q.N = v
+	}
+	res, err := record.Aggregate(q)
+	if err != nil {
+		ctx.JSON(http.StatusOK, ginResponse{Status: -1, Msg: err.Error()})
+	} else {
+		ctx.JSON(http.StatusOK, ginResponse{Status: 0, Msg: "success", Data: res})
+	}
+}
@@ -1,15 +1,22 @@
 package server
 
 import (
+	"anomaly-detect/cmd/controller/db"
 	"anomaly-detect/cmd/controller/task"
 	"anomaly-detect/cmd/controller/task/api"
 	"anomaly-detect/cmd/controller/task/impl"
+	"anomaly-detect/cmd/controller/task/record"
 	"anomaly-detect/cmd/controller/task/store"
 	"anomaly-detect/cmd/controller/task/union"
+	"anomaly-detect/pkg/dapr"
+	"anomaly-detect/pkg/env"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"net/http"
 	"time"
 )
 
@@ -19,14 +26,17 @@ const (
 )
 
 type Controller struct {
-	//*dapr.Dapr
-	httpServer  *gin.Engine // http server
+	*dapr.Dapr
+	httpServer  *gin.Engine  // http server
+	server      *http.Server // 用于优雅退出
+	initTimer   *time.Timer  // 延迟载入任务
 	taskManager *task.Manager
 }
 
 const (
 	defaultServiceName = "controller"
 	defaultHttpPort    = 3030
+	shutdownTimeout    = 30 * time.Second // 等待处理中的请求与任务协程退出
 )
 
 func init() {
@@ -34,16 +44,16 @@ func init() {
 }
 
 func NewController() (*Controller, error) {
-	//serviceName := env.GetEnvString(dapr.AppIdEnv, defaultServiceName)
-	//servicePort := env.GetEnvInt(dapr.AppPortEnv, defaultHttpPort)
-	//daprInstance := dapr.NewDapr(serviceName, servicePort)
+	serviceName := env.GetEnvString(dapr.AppIdEnv, defaultServiceName)
+	daprInstance := dapr.NewDapr(serviceName, defaultHttpPort)
 	// e := gin.Default()
 	e := gin.New()
 	e.Use(gin.Recovery())
 
 	return &Controller{
-		//Dapr:        daprInstance,
+		Dapr:        daprInstance,
 		httpServer:  e,
+		server:      &http.Server{Addr: fmt.Sprintf(":%d", defaultHttpPort), Handler: e},
 		taskManager: task.NewManager(),
 	}, nil
 }
@@ -58,10 +68,10 @@ func (c *Controller) Start() error {
 	c.initRouter()
 	c.registerKong()
 	// go time.AfterFunc(7*time.Second, c.initTask)
-	go time.AfterFunc(7*time.Second, c.initUnionTask)
+	c.initTimer = time.AfterFunc(7*time.Second, c.initUnionTask)
 
-	// 此处阻塞
-	if err := c.httpServer.Run(fmt.Sprintf(":%d", defaultHttpPort)); err != nil {
+	// 此处阻塞, Stop 后返回 nil
+	if err := c.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 	return nil
@@ -125,13 +135,17 @@ func (c *Controller) initRouter() {
 	{
 		record.GET("/system", c.getSystemRecord)
 		record.GET("/alert", c.getAlertRecord)
+		record.GET("/union", c.getUnionRecord)
+		record.GET("/query", c.queryRecord)
+		record.GET("/aggregate", c.aggregateRecord)
+		record.GET("/export", c.exportRecord)
 	}
 }
 
 func (c *Controller) initTask() {
 	tasks, err := store.GetAll()
 	if err != nil {
-		logrus.Error("init task failed: %s", err.Error())
+		logrus.Errorf("init task failed: %s", err.Error())
 		return
 	}
 	// 注： 这列不能用 _, t := range 遍历，因为 t 用的是同一片内存
@@ -170,7 +184,7 @@ func (c *Controller) initTask() {
 func (c *Controller) initUnionTask() {
 	tasks, err := union.GetAll()
 	if err != nil {
-		logrus.Error("init union task failed: %s", err.Error())
+		logrus.Errorf("init union task failed: %s", err.Error())
 		return
 	}
 	for i := range tasks {
@@ -189,6 +203,22 @@ func (c *Controller) initUnionTask() {
 	}
 }
 
+// Stop 优雅退出: 停止接收请求并等待处理中的请求, 停止并保存所有任务, 最后关闭数据库连接.
+// influxdb 客户端关闭时写入未完成的日志
 func (c *Controller) Stop() {
-	// TODO: implement
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := c.server.Shutdown(ctx); err != nil {
+		logrus.Errorf("shutdown http server failed: %s", err.Error())
+	}
+	if c.initTimer != nil {
+		c.initTimer.Stop()
+	}
+	if err := c.taskManager.Close(ctx); err != nil {
+		logrus.Errorf("stop tasks failed: %s", err.Error())
+	}
+	// 任务停止后推送剩余的告警
+	record.ClosePublisher()
+	db.InfluxdbClientClose()
+	db.MysqlClientClose()
 }
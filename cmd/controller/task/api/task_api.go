@@ -40,6 +40,7 @@ type Task interface {
 	EnableModelUpdate(bool) error                                  // 启动/停止模型更新(阈值更新)
 	EnableAnomalyDetect(bool) error                                // 启动/停止异常检测
 	SetThreshold(string, string, string, *float64, *float64) error // 设置阈值 lower upper
+	Done() <-chan struct{}                                         // task 的协程退出后关闭, 用于停止时等待
 }
 
 // 告警等级, 0 表示正常计算
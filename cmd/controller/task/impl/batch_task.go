@@ -32,6 +32,7 @@ type BatchTask struct {
 	isAnomaly bool
 
 	exit context.CancelFunc
+	done chan struct{} // 协程退出后关闭
 	rw   sync.RWMutex
 }
 
@@ -81,7 +82,8 @@ func (t *BatchTask) IsUnion() bool {
 func (t *BatchTask) Start() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	t.exit = cancel
-	go t.do(ctx)
+	t.done = make(chan struct{})
+	go t.do(ctx, t.done)
 	return nil
 }
 
@@ -90,9 +92,17 @@ func (t *BatchTask) Stop() error {
 		t.exit()
 	}
 	t.exit = nil
+	// 协程可能仍在执行, Manager.Close 等待协程退出后会再次保存
 	return t.Save() // 退出时保存
 }
 
+func (t *BatchTask) Done() <-chan struct{} {
+	if t.done == nil {
+		return closedDone
+	}
+	return t.done
+}
+
 func (t *BatchTask) Restart() error {
 	if err := t.Stop(); err != nil {
 		return err
@@ -209,16 +219,22 @@ func (t *BatchTask) SetThreshold(sensorMac, sensorType, receiveNo string, lower
 	return t.Save()
 }
 
-func (t *BatchTask) do(ctx context.Context) {
+func (t *BatchTask) do(ctx context.Context, done chan struct{}) {
+	defer close(done)
 	// because duration has been validated before, ignore error in the below duration parse
 	updateDuration, _ := time.ParseDuration(t.info.ModelUpdate.Interval)
 	detectDuration, _ := time.ParseDuration(t.info.AnomalyDetect.Interval)
 	// create time ticker
 	updateTicker := time.NewTicker(updateDuration)
 	detectTicker := time.NewTicker(detectDuration)
+	defer updateTicker.Stop()
+	defer detectTicker.Stop()
 
-	// 延迟执行
-	go time.AfterFunc(5*time.Second, func() {
+	// 延迟执行, 停止后不再执行
+	delay := time.AfterFunc(5*time.Second, func() {
+		if ctx.Err() != nil {
+			return
+		}
 		if t.modelUpdateState.IsEnabled() {
 			t.doModelUpdate()
 			t.modelUpdateState.SetNext(time.Now().Add(updateDuration))
@@ -228,6 +244,7 @@ func (t *BatchTask) do(ctx context.Context) {
 			t.anomalyDetectState.SetNext(time.Now().Add(detectDuration))
 		}
 	})
+	defer delay.Stop()
 
 	for {
 		select {
@@ -284,6 +301,7 @@ func (t *BatchTask) doAnomalyDetect() {
 		Start:          start,
 		Stop:           stop,
 	}
+	wasAnomaly := t.isAnomaly
 	if result.IsAnomaly || t.currentValue.Get() > t.thresholdUpper.Get() || t.currentValue.Get() < t.thresholdLower.Get() {
 		r.Level = t.info.Level
 		r.Description = "检测异常"
@@ -295,6 +313,10 @@ func (t *BatchTask) doAnomalyDetect() {
 	if err := record.SaveAlertRecord(t.TaskId(), t.info.ProjectId, r); err != nil {
 		t.logError("save record failed: %s", err.Error())
 	}
+	// 异常时推送告警，由异常变为正常时推送恢复
+	if t.isAnomaly || wasAnomaly {
+		record.Publish(r.ToAlert(t.TaskId(), t.info.ProjectId))
+	}
 }
 
 func (t *BatchTask) doModelUpdate() {
@@ -147,3 +147,10 @@ func (s StreamStatus) MarshToJson() []byte {
 	data, _ := json.Marshal(s)
 	return data
 }
+
+// closedDone 未启动协程的 task 的 Done
+var closedDone = func() chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}()
@@ -33,6 +33,7 @@ type StreamTask struct {
 	timer     time.Time     // 计时器
 
 	exit context.CancelFunc
+	done chan struct{} // 协程退出后关闭
 
 	rw sync.RWMutex
 }
@@ -93,7 +94,8 @@ func (s *StreamTask) Start() error {
 	if s.info.DetectModel != nil && s.info.ModelUpdate != nil {
 		ctx, cancel := context.WithCancel(context.Background())
 		s.exit = cancel
-		go s.do(ctx)
+		s.done = make(chan struct{})
+		go s.do(ctx, s.done)
 	}
 	return nil
 }
@@ -106,6 +108,14 @@ func (s *StreamTask) Stop() error {
 	return nil
 }
 
+// Done : 未定义模型更新时没有协程
+func (s *StreamTask) Done() <-chan struct{} {
+	if s.done == nil {
+		return closedDone
+	}
+	return s.done
+}
+
 func (s *StreamTask) Restart() error {
 	if err := s.Stop(); err != nil {
 		return err
@@ -225,16 +235,22 @@ func (s *StreamTask) SubKey() []string {
 	return []string{fmt.Sprintf("%s#%s#%s#%s", s.info.GetProjectId(), series.SensorMac, series.SensorType, series.ReceiveNo)}
 }
 
-func (s *StreamTask) do(ctx context.Context) {
+func (s *StreamTask) do(ctx context.Context, done chan struct{}) {
+	defer close(done)
 	d, _ := time.ParseDuration(s.info.ModelUpdate.Interval)
 	timeTicker := time.NewTicker(d)
+	defer timeTicker.Stop()
 
-	go time.AfterFunc(5*time.Second, func() {
+	delay := time.AfterFunc(5*time.Second, func() {
+		if ctx.Err() != nil {
+			return
+		}
 		if s.modelUpdateState.IsEnabled() {
 			s.doModelUpdate()
 			s.modelUpdateState.SetNext(time.Now().Add(d))
 		}
 	})
+	defer delay.Stop()
 
 	for {
 		select {
@@ -370,19 +386,19 @@ func (s *StreamTask) Run(projectId, sensorMac, sensorType, receiveNo string, val
 	if value < lower || value > upper { // 异常
 		if !s.isAnomaly { // 如果之前是正常的，则变为异常，并发送告警
 			r.Level = s.info.Level
-			// TODO: message push
+			record.Publish(r.ToAlert(s.TaskId(), s.info.ProjectId))
 			// _ = record.SaveAlertRecord(s.TaskId(), s.info.ProjectId, r)
 			// s.logInfo("anomaly detect: upper %v lower %v current %v, is anomaly", upper, lower, value)
-			fmt.Println("save alert record", r.Level, pt.Local().String())
+			s.logInfo("publish alert record, level %d at %s", r.Level, pt.Local().String())
 		}
 		s.isAnomaly = true
 	} else { // 正常
 		if s.isAnomaly { // 如果之前为异常则改为正常
 			r.Level = int(api.InfoLevel)
-			// TODO: message push
+			record.Publish(r.ToAlert(s.TaskId(), s.info.ProjectId))
 			// _ = record.SaveAlertRecord(s.TaskId(), s.info.ProjectId, r)
 			// s.logInfo("anomaly detect: upper %v lower %v current %v, is normal", upper, lower, value)
-			fmt.Println("save alert record", r.Level, pt.Local().String())
+			s.logInfo("publish alert record, level %d at %s", r.Level, pt.Local().String())
 		}
 		s.isAnomaly = false
 	}
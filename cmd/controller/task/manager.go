@@ -6,6 +6,7 @@ import (
 	"anomaly-detect/cmd/controller/task/store"
 	"anomaly-detect/cmd/controller/task/union"
 	imodels "anomaly-detect/pkg/models"
+	"context"
 	"fmt"
 	"strings"
 	"sync"
@@ -213,6 +214,36 @@ func (m *Manager) SetThreshold(taskId, projectId, sensorMac, sensorType, receive
 	return m.tasks[taskKey].SetThreshold(sensorMac, sensorType, receiveNo, lower, upper)
 }
 
+// Close 停止所有 task, 等待 task 的协程退出 (直到 ctx 结束) 后再次保存状态, 避免 Stop 之后协程中的模型更新或检测修改的阈值丢失
+func (m *Manager) Close(ctx context.Context) error {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+	for _, taskKey := range m.taskList {
+		if t, ok := m.tasks[taskKey]; ok {
+			_ = t.Stop()
+		}
+	}
+	var err error
+	for _, taskKey := range m.taskList {
+		t, ok := m.tasks[taskKey]
+		if !ok {
+			continue
+		}
+		if err == nil {
+			select {
+			case <-t.Done():
+			case <-ctx.Done():
+				err = fmt.Errorf("wait for tasks to stop: %s", ctx.Err().Error())
+			}
+		}
+		// 超时后仍然保存, 尽量保留当前状态
+		if e := t.Save(); e != nil {
+			logrus.Errorf("save task %s failed: %s", taskKey, e.Error())
+		}
+	}
+	return err
+}
+
 func buildTaskKey(taskId, projectId string) string {
 	return fmt.Sprintf("%s#%s", taskId, projectId)
 }
@@ -241,7 +272,7 @@ func (m *Manager) WritePoints(points imodels.Points) {
 
 		field, err := p.Fields()
 		if err != nil {
-			logrus.Error("parse point failed: %s", err.Error())
+			logrus.Errorf("parse point failed: %s", err.Error())
 			continue
 		}
 
@@ -0,0 +1,234 @@
+package record
+
+import (
+	"anomaly-detect/cmd/controller/db"
+	"anomaly-detect/pkg/xlsx"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 导出格式
+const (
+	CsvFormat  = "csv"
+	XlsxFormat = "xlsx"
+)
+
+const exportTimeFormat = "2006-01-02 15:04:05"
+
+// 传感器信息，用于补充记录中的传感器类型、位置和单位
+const sensorMetaQuery = "select s.SENSOR_MAC as sensor_mac, s.TYPE_ID as type_id, st.TYPE_NAME as type_name, " +
+	"sl_1.location_name as location1, sl_2.location_name as location2, sl_3.location_name as location3, sl_4.location_name as location4 " +
+	"from sensor_location s  " +
+	"left join sensor_type st on s.TYPE_ID = st.ID  " +
+	"left join site_location_name sl_1 on s.project_id=sl_1.project_id and s.location_1_id=sl_1.LOCATION_1_ID and sl_1.location_2_id=0  " +
+	"left join site_location_name sl_2 on s.project_id=sl_2.project_id and s.location_1_id=sl_2.LOCATION_1_ID and s.location_2_id=sl_2.LOCATION_2_ID and sl_2.location_3_id=0  " +
+	"left join site_location_name sl_3 on s.project_id=sl_3.project_id and s.location_1_id=sl_3.LOCATION_1_ID and s.location_2_id=sl_3.LOCATION_2_ID and s.location_3_id=sl_3.LOCATION_3_ID and sl_3.location_4_id=0 " +
+	"left join site_location_name sl_4 on s.project_id=sl_4.project_id and s.location_1_id=sl_4.LOCATION_1_ID and s.location_2_id=sl_4.LOCATION_2_ID and s.location_3_id=sl_4.LOCATION_3_ID and s.location_4_id=sl_4.LOCATION_4_ID  " +
+	"where s.project_id=?"
+
+const gatherMetaQuery = "select sensor_type_id, gather_type, gather_type_name, unit from sensor_gather_type"
+
+type sensorMeta struct {
+	SensorMac string `gorm:"column:sensor_mac"`
+	TypeId    int    `gorm:"column:type_id"`
+	TypeName  string `gorm:"column:type_name"`
+	Location1 string `gorm:"column:location1"`
+	Location2 string `gorm:"column:location2"`
+	Location3 string `gorm:"column:location3"`
+	Location4 string `gorm:"column:location4"`
+}
+
+func (s sensorMeta) location() string {
+	var names []string
+	for _, l := range []string{s.Location1, s.Location2, s.Location3, s.Location4} {
+		if l != "" {
+			names = append(names, l)
+		}
+	}
+	return strings.Join(names, "/")
+}
+
+type gatherMeta struct {
+	SensorTypeId   int    `gorm:"column:sensor_type_id"`
+	GatherType     string `gorm:"column:gather_type"`
+	GatherTypeName string `gorm:"column:gather_type_name"`
+	Unit           string `gorm:"column:unit"`
+}
+
+// enricher 根据 sensor_mac 和 sensor_type 查找传感器的类型名称、位置和单位
+type enricher struct {
+	sensors map[string]sensorMeta
+	gathers map[string]gatherMeta // sensor_type_id#gather_type -> gatherMeta
+}
+
+func newEnricher(projectId string) (*enricher, error) {
+	var sensors []sensorMeta
+	if err := db.MysqlClient.DB.Raw(sensorMetaQuery, projectId).Scan(&sensors).Error; err != nil {
+		return nil, err
+	}
+	var gathers []gatherMeta
+	if err := db.MysqlClient.DB.Raw(gatherMetaQuery).Scan(&gathers).Error; err != nil {
+		return nil, err
+	}
+	e := &enricher{
+		sensors: make(map[string]sensorMeta, len(sensors)),
+		gathers: make(map[string]gatherMeta, len(gathers)),
+	}
+	for _, s := range sensors {
+		e.sensors[s.SensorMac] = s
+	}
+	for _, g := range gathers {
+		e.gathers[fmt.Sprintf("%d#%s", g.SensorTypeId, g.GatherType)] = g
+	}
+	return e, nil
+}
+
+// lookup 返回 传感器类型名称、采集类型名称、单位、位置
+func (e *enricher) lookup(sensorMac, sensorType string) (string, string, string, string) {
+	s, ok := e.sensors[sensorMac]
+	if !ok {
+		return "", "", "", ""
+	}
+	g := e.gathers[fmt.Sprintf("%d#%s", s.TypeId, sensorType)]
+	return s.TypeName, g.GatherTypeName, g.Unit, s.location()
+}
+
+// rowWriter csv 与 xlsx 的统一写入接口
+type rowWriter interface {
+	Write(cells []interface{}) error
+	Close() error
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c csvWriter) Write(cells []interface{}) error {
+	row := make([]string, len(cells))
+	for i, cell := range cells {
+		switch v := cell.(type) {
+		case nil:
+		case float64:
+			row[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			row[i] = fmt.Sprintf("%v", v)
+		}
+	}
+	return c.w.Write(row)
+}
+
+func (c csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+var exportHeaders = map[string][]interface{}{
+	AlertMeasurement: {"时间", "任务ID", "传感器MAC", "采集类型", "采集类型名称", "传感器类型", "位置", "单位",
+		"数值", "阈值下限", "阈值上限", "是否告警", "开始时间", "结束时间"},
+	SystemMeasurement: {"时间", "任务ID", "传感器MAC", "采集类型", "采集类型名称", "传感器类型", "位置", "单位",
+		"等级", "阈值下限", "阈值上限", "描述"},
+	UnionMeasurement: {"时间", "任务ID", "是否告警", "描述"},
+}
+
+// Exporter 按检索条件分页导出全部记录
+type Exporter struct {
+	format string
+	q      Query
+	e      *enricher
+	first  *Page
+	search func(Query) (*Page, error)
+}
+
+// NewExporter 校验参数、载入传感器信息并查询第一页，出错时尚未写出任何数据，调用方可以直接返回错误
+// q 中的 Limit 与 Cursor 会被忽略
+func NewExporter(format string, q Query) (*Exporter, error) {
+	q.Limit = maxPageSize
+	q.Cursor = ""
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	if format != CsvFormat && format != XlsxFormat {
+		return nil, fmt.Errorf("format must in [%s, %s]", CsvFormat, XlsxFormat)
+	}
+	e, err := newEnricher(q.ProjectId)
+	if err != nil {
+		return nil, err
+	}
+	return newExporter(format, q, e, Search)
+}
+
+func newExporter(format string, q Query, e *enricher, search func(Query) (*Page, error)) (*Exporter, error) {
+	first, err := search(q)
+	if err != nil {
+		return nil, err
+	}
+	return &Exporter{format: format, q: q, e: e, first: first, search: search}, nil
+}
+
+// Export 以 csv 或 xlsx 格式写入 w，之后的分页查询出错时已写出部分数据
+func (x *Exporter) Export(w io.Writer) error {
+	var out rowWriter
+	if x.format == XlsxFormat {
+		xw, err := xlsx.NewWriter(w, x.q.Measurement)
+		if err != nil {
+			return err
+		}
+		out = xw
+	} else {
+		// 写入 BOM，避免 excel 打开时中文乱码
+		if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+			return err
+		}
+		out = csvWriter{w: csv.NewWriter(w)}
+	}
+	if err := out.Write(exportHeaders[x.q.Measurement]); err != nil {
+		return err
+	}
+	q := x.q
+	page := x.first
+	for {
+		for _, row := range page.Data.([]interface{}) {
+			if err := out.Write(exportRow(x.e, row)); err != nil {
+				return err
+			}
+		}
+		if page.Next == "" {
+			break
+		}
+		q.Cursor = page.Next
+		var err error
+		if page, err = x.search(q); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+func exportRow(e *enricher, row interface{}) []interface{} {
+	switch r := row.(type) {
+	case AlertResponse:
+		typeName, gatherName, unit, location := e.lookup(r.SensorMac, r.SensorType)
+		return []interface{}{r.Time.Local().Format(exportTimeFormat), r.TaskId, r.SensorMac, r.SensorType, gatherName,
+			typeName, location, unit, r.Value, r.ThresholdLower, r.ThresholdUpper, r.Alert, r.Start, r.Stop}
+	case SysResponse:
+		typeName, gatherName, unit, location := e.lookup(r.SensorMac, r.SensorType)
+		return []interface{}{r.Time.Local().Format(exportTimeFormat), r.TaskId, r.SensorMac, r.SensorType, gatherName,
+			typeName, location, unit, r.Level, r.ThresholdLower, r.ThresholdUpper, r.Description}
+	case UnionResponse:
+		return []interface{}{r.Time.Local().Format(exportTimeFormat), r.TaskId, r.Alert, r.Description}
+	}
+	return nil
+}
+
+// ExportFileName 导出文件名，如 alert_3_20220301.csv
+func ExportFileName(q Query, format string) string {
+	measurement := q.Measurement
+	if measurement == "" {
+		measurement = AlertMeasurement
+	}
+	return fmt.Sprintf("%s_%s_%s.%s", measurement, q.ProjectId, time.Now().Format("20060102"), format)
+}
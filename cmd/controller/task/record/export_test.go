@@ -0,0 +1,99 @@
+package record
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"github.com/go-playground/assert/v2"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pagedSearch 两页数据，第二页使用第一页返回的 cursor
+func pagedSearch(pages ...[]interface{}) func(Query) (*Page, error) {
+	return func(q Query) (*Page, error) {
+		if q.Cursor == "" {
+			return &Page{Data: pages[0], Next: "next"}, nil
+		}
+		if q.Cursor != "next" {
+			return nil, errors.New("invalid cursor")
+		}
+		return &Page{Data: pages[1]}, nil
+	}
+}
+
+func TestExportCsv(t *testing.T) {
+	at := time.Date(2022, 3, 1, 8, 0, 0, 0, time.Local)
+	search := pagedSearch(
+		[]interface{}{UnionResponse{Time: at, TaskId: "t1", Alert: true, Description: `温度 "过高", 湿度
+过低`}},
+		[]interface{}{UnionResponse{Time: at.Add(time.Minute), TaskId: "t2", Description: "正常"}},
+	)
+	x, err := newExporter(CsvFormat, Query{ProjectId: "3", Measurement: UnionMeasurement}, &enricher{}, search)
+	assert.Equal(t, err, nil)
+	var buf bytes.Buffer
+	assert.Equal(t, x.Export(&buf), nil)
+
+	assert.Equal(t, strings.HasPrefix(buf.String(), "\xEF\xBB\xBF"), true)
+	assert.Equal(t, strings.Contains(buf.String(), `"温度 ""过高"", 湿度`+"\n"+`过低"`), true)
+	rows, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(buf.String(), "\xEF\xBB\xBF"))).ReadAll()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, rows, [][]string{
+		{"时间", "任务ID", "是否告警", "描述"},
+		{"2022-03-01 08:00:00", "t1", "true", "温度 \"过高\", 湿度\n过低"},
+		{"2022-03-01 08:01:00", "t2", "false", "正常"},
+	})
+
+	// 第一页查询失败时不写出数据
+	_, err = newExporter(CsvFormat, Query{ProjectId: "3"}, &enricher{}, func(Query) (*Page, error) {
+		return nil, errors.New("influxdb unavailable")
+	})
+	assert.NotEqual(t, err, nil)
+	_, err = NewExporter("pdf", Query{ProjectId: "3"})
+	assert.NotEqual(t, err, nil)
+	_, err = NewExporter(CsvFormat, Query{})
+	assert.NotEqual(t, err, nil)
+}
+
+func TestExportXlsx(t *testing.T) {
+	at := time.Date(2022, 3, 1, 8, 0, 0, 0, time.Local)
+	e := &enricher{
+		sensors: map[string]sensorMeta{"mac": {SensorMac: "mac", TypeId: 1, TypeName: "温湿度", Location1: "一楼", Location2: "机房"}},
+		gathers: map[string]gatherMeta{"1#temperature": {SensorTypeId: 1, GatherType: "temperature", GatherTypeName: "温度", Unit: "℃"}},
+	}
+	alert := AlertResponse{Time: at, TaskId: "t1", SensorMac: "mac", SensorType: "temperature",
+		ThresholdLower: 10, ThresholdUpper: 30, Value: 35.5, Alert: true, Start: "s", Stop: "e"}
+	x, err := newExporter(XlsxFormat, Query{ProjectId: "3", Measurement: AlertMeasurement}, e,
+		pagedSearch([]interface{}{alert}, []interface{}{}))
+	assert.Equal(t, err, nil)
+	var buf bytes.Buffer
+	assert.Equal(t, x.Export(&buf), nil)
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Equal(t, err, nil)
+	var content []byte
+	for _, f := range r.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, err := f.Open()
+			assert.Equal(t, err, nil)
+			content, _ = ioutil.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	sheet := string(content)
+	assert.Equal(t, strings.Count(sheet, "<row "), 2)
+	for _, c := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">时间</t></is></c>`,
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">2022-03-01 08:00:00</t></is></c>`,
+		`<c r="E2" t="inlineStr"><is><t xml:space="preserve">温度</t></is></c>`,
+		`<c r="G2" t="inlineStr"><is><t xml:space="preserve">一楼/机房</t></is></c>`,
+		`<c r="H2" t="inlineStr"><is><t xml:space="preserve">℃</t></is></c>`,
+		`<c r="I2"><v>35.5</v></c>`,
+		`<c r="L2" t="b"><v>1</v></c>`,
+	} {
+		assert.Equal(t, strings.Contains(sheet, c), true)
+	}
+}
@@ -0,0 +1,94 @@
+package record
+
+import (
+	"anomaly-detect/pkg/alerting"
+	"errors"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const publishBuffer = 1024
+
+// PublishOptions 告警通过 dapr pub/sub 推送给 alertengine，pubsub 为空时不推送
+type PublishOptions struct {
+	Pubsub string `yaml:"pubsub"` // pubsub 组件名，与 alertengine 的 pubsub.name 一致
+	Topic  string `yaml:"topic"`  // pubsub 主题，需在 alertengine 的 pubsub.topics 中
+}
+
+func (o PublishOptions) Validate() error {
+	if o.Pubsub != "" && o.Topic == "" {
+		return errors.New("topic of publish could not be empty")
+	}
+	return nil
+}
+
+// alertEvent 事件数据，alertengine 由 alert 得到主题(默认为任务 ID)、级别与是否恢复
+type alertEvent struct {
+	Alert alerting.Alert `json:"alert"`
+}
+
+// publisher 告警按顺序异步推送，不阻塞检测任务
+type publisher struct {
+	publish func(pubsub, topic string, data interface{}) error // dapr.Dapr.Publish
+	opts    PublishOptions
+	ch      chan alertEvent
+	wg      sync.WaitGroup
+	closed  bool
+	rw      sync.RWMutex
+}
+
+var alertPublisher *publisher
+
+// InitPublisher 初始化告警推送，publish 为 dapr.Dapr.Publish，未初始化时 Publish 不推送
+func InitPublisher(publish func(pubsub, topic string, data interface{}) error, opts PublishOptions) {
+	if opts.Pubsub == "" {
+		return
+	}
+	p := &publisher{publish: publish, opts: opts, ch: make(chan alertEvent, publishBuffer)}
+	p.wg.Add(1)
+	go p.run()
+	alertPublisher = p
+}
+
+func (p *publisher) run() {
+	defer p.wg.Done()
+	for e := range p.ch {
+		if err := p.publish(p.opts.Pubsub, p.opts.Topic, e); err != nil {
+			logrus.Errorf("publish alert of task %s failed: %s", e.Alert.TaskId, err.Error())
+		}
+	}
+}
+
+// Publish 推送告警，缓冲区满或已关闭时丢弃
+func Publish(a alerting.Alert) {
+	p := alertPublisher
+	if p == nil {
+		return
+	}
+	p.rw.RLock()
+	defer p.rw.RUnlock()
+	if p.closed {
+		return
+	}
+	select {
+	case p.ch <- alertEvent{Alert: a}:
+	default:
+		logrus.Warnf("alert publish buffer is full, drop alert of task %s", a.TaskId)
+	}
+}
+
+// ClosePublisher 等待缓冲的告警推送完成，在任务停止后调用
+func ClosePublisher() {
+	p := alertPublisher
+	if p == nil {
+		return
+	}
+	p.rw.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.ch)
+	}
+	p.rw.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,54 @@
+package record
+
+import (
+	"anomaly-detect/pkg/alerting"
+	"anomaly-detect/pkg/dapr"
+	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	defer func() { alertPublisher = nil }()
+	var mu sync.Mutex
+	var paths []string
+	var events []alertEvent
+	sidecar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e alertEvent
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		events = append(events, e)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer sidecar.Close()
+	u, _ := url.Parse(sidecar.URL)
+	port, _ := strconv.Atoi(u.Port())
+	d := &dapr.Dapr{DaprHttpPort: port}
+
+	// 未配置 pubsub 时不推送
+	InitPublisher(d.Publish, PublishOptions{})
+	Publish(alerting.Alert{TaskId: "t1"})
+	assert.Equal(t, alertPublisher == nil, true)
+	assert.NotEqual(t, PublishOptions{Pubsub: "pubsub"}.Validate(), nil)
+
+	InitPublisher(d.Publish, PublishOptions{Pubsub: "pubsub", Topic: "alerts"})
+	Publish(alerting.Alert{TaskId: "t1", Level: alerting.AlertLevel, State: alerting.Firing})
+	Publish(alerting.Alert{TaskId: "t1", State: alerting.Resolved})
+	ClosePublisher()
+	// 关闭后丢弃
+	Publish(alerting.Alert{TaskId: "t2"})
+	ClosePublisher()
+
+	assert.Equal(t, paths, []string{"/v1.0/publish/pubsub/alerts", "/v1.0/publish/pubsub/alerts"})
+	assert.Equal(t, len(events), 2)
+	assert.Equal(t, events[0].Alert.State, alerting.Firing)
+	assert.Equal(t, events[0].Alert.Level, alerting.AlertLevel)
+	assert.Equal(t, events[1].Alert.State, alerting.Resolved)
+}
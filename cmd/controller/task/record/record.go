@@ -2,12 +2,14 @@ package record
 
 import (
 	"anomaly-detect/cmd/controller/db"
+	"anomaly-detect/pkg/alerting"
 	"anomaly-detect/pkg/influxdb"
 	"context"
 	"errors"
 	"fmt"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
+	fluxquery "github.com/influxdata/influxdb-client-go/v2/api/query"
 	"github.com/sirupsen/logrus"
 	"strconv"
 	"strings"
@@ -41,6 +43,29 @@ type Record struct {
 	Description    string    `json:"description"`
 }
 
+// ToAlert 转换为推送给 alertengine 的结构化告警，level 为 0 表示告警恢复
+func (r Record) ToAlert(taskId string, projectId int) alerting.Alert {
+	a := alerting.Alert{
+		ProjectId:      strconv.Itoa(projectId),
+		TaskId:         taskId,
+		Series:         alerting.Series{SensorMac: r.SensorMac, SensorType: r.SensorType, ReceiveNo: r.ReceiveNo},
+		Level:          r.Level,
+		State:          alerting.Firing,
+		Value:          r.Value,
+		ThresholdLower: r.ThresholdLower,
+		ThresholdUpper: r.ThresholdUpper,
+		Start:          r.Start,
+		Stop:           r.Stop,
+	}
+	if r.Level == alerting.InfoLevel {
+		a.State = alerting.Resolved
+	}
+	if r.Description != "" {
+		a.Annotations = map[string]string{alerting.DescriptionAnnotation: r.Description}
+	}
+	return a
+}
+
 // SaveAlertRecord 保存告警日志
 func SaveAlertRecord(taskId string, projectId int, data Record) error {
 	point := influxdb2.NewPoint(
@@ -161,20 +186,7 @@ func GetSystemRecord(projectId, taskId, start, stop string) ([]SysResponse, erro
 		return res, err
 	}
 	for data.Next() {
-		row := SysResponse{
-			Time:           data.Record().Time(),
-			TaskId:         data.Record().ValueByKey("task_id").(string),
-			ProjectId:      data.Record().ValueByKey("project_id").(string),
-			SensorMac:      data.Record().ValueByKey("sensor_mac").(string),
-			SensorType:     data.Record().ValueByKey("sensor_type").(string),
-			ReceiveNo:      data.Record().ValueByKey("receive_no").(string),
-			ThresholdUpper: data.Record().ValueByKey("threshold_upper").(float64),
-			ThresholdLower: data.Record().ValueByKey("threshold_lower").(float64),
-			Level:          data.Record().ValueByKey("level").(string),
-			Description:    data.Record().ValueByKey("description").(string),
-		}
-		//fmt.Println(row)
-		res = append(res, row)
+		res = append(res, parseSysRecord(data.Record()))
 	}
 	return res, nil
 }
@@ -193,21 +205,7 @@ func GetAlertRecord(projectId, taskId, start, stop string) ([]AlertResponse, err
 		return res, err
 	}
 	for data.Next() {
-		row := AlertResponse{
-			Time:           data.Record().Time(),
-			TaskId:         data.Record().ValueByKey("task_id").(string),
-			ProjectId:      data.Record().ValueByKey("project_id").(string),
-			SensorMac:      data.Record().ValueByKey("sensor_mac").(string),
-			SensorType:     data.Record().ValueByKey("sensor_type").(string),
-			ReceiveNo:      data.Record().ValueByKey("receive_no").(string),
-			ThresholdUpper: data.Record().ValueByKey("threshold_upper").(float64),
-			ThresholdLower: data.Record().ValueByKey("threshold_lower").(float64),
-			Value:          data.Record().ValueByKey("value").(float64),
-			Alert:          data.Record().ValueByKey("alert").(bool),
-			Start:          data.Record().ValueByKey("start").(string),
-			Stop:           data.Record().ValueByKey("stop").(string),
-		}
-		res = append(res, row)
+		res = append(res, parseAlertRecord(data.Record()))
 	}
 	return res, nil
 }
@@ -224,31 +222,60 @@ func GetUnionRecord(projectId, taskId, start, stop string) ([]UnionResponse, err
 		return res, err
 	}
 	for data.Next() {
-		row := UnionResponse{
-			Time:        data.Record().Time(),
-			TaskId:      data.Record().ValueByKey("task_id").(string),
-			ProjectId:   data.Record().ValueByKey("project_id").(string),
-			Alert:       data.Record().ValueByKey("alert").(bool),
-			Description: data.Record().ValueByKey("description").(string),
-		}
-		res = append(res, row)
+		res = append(res, parseUnionRecord(data.Record()))
 	}
 	return res, nil
 }
 
+func parseSysRecord(r *fluxquery.FluxRecord) SysResponse {
+	return SysResponse{
+		Time:           r.Time(),
+		TaskId:         r.ValueByKey("task_id").(string),
+		ProjectId:      r.ValueByKey("project_id").(string),
+		SensorMac:      r.ValueByKey("sensor_mac").(string),
+		SensorType:     r.ValueByKey("sensor_type").(string),
+		ReceiveNo:      r.ValueByKey("receive_no").(string),
+		ThresholdUpper: r.ValueByKey("threshold_upper").(float64),
+		ThresholdLower: r.ValueByKey("threshold_lower").(float64),
+		Level:          r.ValueByKey("level").(string),
+		Description:    r.ValueByKey("description").(string),
+	}
+}
+
+func parseAlertRecord(r *fluxquery.FluxRecord) AlertResponse {
+	return AlertResponse{
+		Time:           r.Time(),
+		TaskId:         r.ValueByKey("task_id").(string),
+		ProjectId:      r.ValueByKey("project_id").(string),
+		SensorMac:      r.ValueByKey("sensor_mac").(string),
+		SensorType:     r.ValueByKey("sensor_type").(string),
+		ReceiveNo:      r.ValueByKey("receive_no").(string),
+		ThresholdUpper: r.ValueByKey("threshold_upper").(float64),
+		ThresholdLower: r.ValueByKey("threshold_lower").(float64),
+		Value:          r.ValueByKey("value").(float64),
+		Alert:          r.ValueByKey("alert").(bool),
+		Start:          r.ValueByKey("start").(string),
+		Stop:           r.ValueByKey("stop").(string),
+	}
+}
+
+func parseUnionRecord(r *fluxquery.FluxRecord) UnionResponse {
+	return UnionResponse{
+		Time:        r.Time(),
+		TaskId:      r.ValueByKey("task_id").(string),
+		ProjectId:   r.ValueByKey("project_id").(string),
+		Alert:       r.ValueByKey("alert").(bool),
+		Description: r.ValueByKey("description").(string),
+	}
+}
+
 func query(measurement, projectId, taskId, start, stop string) (*api.QueryTableResult, error) {
 	if projectId == "" {
 		return nil, errors.New("projectId cannot be empty")
 	}
-	if start == "" {
-		start = "-7d"
-	} else if st, err := time.ParseInLocation(timeFormat, start, time.Local); err == nil {
-		start = st.Format(timeFormatTz)
-	}
-	if stop == "" {
-		stop = "now()"
-	} else if et, err := time.ParseInLocation(timeFormat, stop, time.Local); err == nil {
-		stop = et.Format(timeFormatTz)
+	start, stop, err := parseRange(start, stop)
+	if err != nil {
+		return nil, err
 	}
 
 	var scripts []string
@@ -256,12 +283,32 @@ func query(measurement, projectId, taskId, start, stop string) (*api.QueryTableR
 	scripts = append(scripts, fmt.Sprintf(influxdb.TimeRangeSnippet, start, stop))
 	var filters []string
 	filters = append(filters, fmt.Sprintf(influxdb.MeasurementSnippet, measurement))
-	filters = append(filters, fmt.Sprintf("r[\"project_id\"] == \"%s\"", projectId))
+	filters = append(filters, fmt.Sprintf("r[\"project_id\"] == \"%s\"", escapeString(projectId)))
 	if taskId != "" {
-		filters = append(filters, fmt.Sprintf("r[\"task_id\"] == \"%s\"", taskId))
+		filters = append(filters, fmt.Sprintf("r[\"task_id\"] == \"%s\"", escapeString(taskId)))
 	}
 	scripts = append(scripts, fmt.Sprintf(influxdb.FilterSnippet, strings.Join(filters, " and ")))
 	scripts = append(scripts, pivot)
 	flux := strings.Join(scripts, "\n")
 	return db.InfluxdbClient.QueryRaw(flux, context.Background())
 }
+
+// parseRange 将 "2006-01-02 15:04:05" 格式的时间转换为 flux 时间，为空时默认查询最近7天。
+// 时间会拼接到 flux 脚本中，格式不符时返回错误
+func parseRange(start, stop string) (string, string, error) {
+	if start == "" {
+		start = "-7d"
+	} else if st, err := time.ParseInLocation(timeFormat, start, time.Local); err == nil {
+		start = st.Format(timeFormatTz)
+	} else {
+		return "", "", fmt.Errorf("start must be in format %s", timeFormat)
+	}
+	if stop == "" {
+		stop = "now()"
+	} else if et, err := time.ParseInLocation(timeFormat, stop, time.Local); err == nil {
+		stop = et.Format(timeFormatTz)
+	} else {
+		return "", "", fmt.Errorf("stop must be in format %s", timeFormat)
+	}
+	return start, stop, nil
+}
@@ -0,0 +1,46 @@
+package record
+
+import (
+	"anomaly-detect/pkg/alerting"
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"time"
+)
+
+func TestToAlert(t *testing.T) {
+	start := time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)
+	r := Record{
+		Time:           start.Add(time.Minute),
+		Start:          start,
+		Stop:           start.Add(time.Minute),
+		SensorMac:      "mac",
+		SensorType:     "temperature",
+		ReceiveNo:      "1",
+		ThresholdUpper: 30,
+		ThresholdLower: 10,
+		Value:          35,
+		Level:          alerting.AlertLevel,
+		Description:    "检测异常",
+	}
+	firing := r.ToAlert("task", 3)
+	assert.Equal(t, firing.Validate(), nil)
+	assert.Equal(t, firing.ProjectId, "3")
+	assert.Equal(t, firing.TaskId, "task")
+	assert.Equal(t, firing.Series, alerting.Series{SensorMac: "mac", SensorType: "temperature", ReceiveNo: "1"})
+	assert.Equal(t, firing.State, alerting.Firing)
+	assert.Equal(t, firing.Level, alerting.AlertLevel)
+	assert.Equal(t, firing.Value, 35.0)
+	assert.Equal(t, firing.ThresholdUpper, 30.0)
+	assert.Equal(t, firing.ThresholdLower, 10.0)
+	assert.Equal(t, firing.Start, start)
+	assert.Equal(t, firing.Stop, start.Add(time.Minute))
+	assert.Equal(t, firing.Annotations[alerting.DescriptionAnnotation], "检测异常")
+
+	// level 为 0 表示恢复，与告警为同一告警
+	r.Level, r.Value, r.Description = alerting.InfoLevel, 20, ""
+	resolved := r.ToAlert("task", 3)
+	assert.Equal(t, resolved.Validate(), nil)
+	assert.Equal(t, resolved.IsResolved(), true)
+	assert.Equal(t, resolved.Annotations == nil, true)
+	assert.Equal(t, resolved.Key(), firing.Key())
+}
@@ -0,0 +1,391 @@
+package record
+
+import (
+	"anomaly-detect/cmd/controller/db"
+	"anomaly-detect/pkg/influxdb"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 记录类型，对应查询接口中的 measurement 参数
+const (
+	AlertMeasurement  = "alert"
+	SystemMeasurement = "system"
+	UnionMeasurement  = "union"
+)
+
+// 聚合类型
+const (
+	DailyAggregate = "daily" // 按天、按任务统计告警状态的记录数
+	TopAggregate   = "top"   // 告警状态的记录数最多的前 N 个传感器
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+	defaultTopN     = 10
+)
+
+// 各类记录在 influxdb 中的 measurement 以及分页时用于打破时间相同情况的排序字段
+var measurements = map[string]struct {
+	name    string
+	sortKey []string
+}{
+	AlertMeasurement:  {alertLogMeasurement, []string{"_time", "task_id", "sensor_mac", "sensor_type", "receive_no"}},
+	SystemMeasurement: {systemLogMeasurement, []string{"_time", "task_id", "sensor_mac", "sensor_type", "receive_no", "level"}},
+	UnionMeasurement:  {unionLogMeasurement, []string{"_time", "task_id"}},
+}
+
+// Query 记录检索条件
+// measurement  alert/system/union
+// level        仅 system 记录有效 (info/error)
+// alert        仅 alert/union 记录有效
+// cursor       上一页返回的 next，为空时从第一页开始
+type Query struct {
+	Measurement string
+	ProjectId   string
+	TaskId      string
+	SensorMac   string
+	SensorType  string
+	ReceiveNo   string
+	Level       string
+	Alert       *bool
+	Start       string
+	Stop        string
+	Desc        bool
+	Limit       int
+	Cursor      string
+}
+
+func (q *Query) Validate() error {
+	if q.ProjectId == "" {
+		return errors.New("projectId cannot be empty")
+	}
+	if q.Measurement == "" {
+		q.Measurement = AlertMeasurement
+	}
+	if _, ok := measurements[q.Measurement]; !ok {
+		return fmt.Errorf("measurement must in [%s, %s, %s]", AlertMeasurement, SystemMeasurement, UnionMeasurement)
+	}
+	if q.Measurement == UnionMeasurement && (q.SensorMac != "" || q.SensorType != "" || q.ReceiveNo != "") {
+		return errors.New("union record cannot filter by sensor")
+	}
+	if q.Level != "" && q.Measurement != SystemMeasurement {
+		return errors.New("level filter is only supported by system record")
+	}
+	if q.Alert != nil && q.Measurement == SystemMeasurement {
+		return errors.New("alert filter is not supported by system record")
+	}
+	if _, _, err := parseRange(q.Start, q.Stop); err != nil {
+		return err
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultPageSize
+	} else if q.Limit > maxPageSize {
+		q.Limit = maxPageSize
+	}
+	return nil
+}
+
+// Page 分页结果，Next 为空表示没有更多数据
+type Page struct {
+	Data interface{} `json:"data"`
+	Next string      `json:"next"`
+}
+
+// cursor 记录上一页最后一条数据的时间，以及该时间点已经返回的条数
+type cursor struct {
+	t      time.Time
+	offset int
+}
+
+func (c cursor) encode() string {
+	raw := fmt.Sprintf("%d:%d", c.t.UnixNano(), c.offset)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, errors.New("invalid cursor")
+	}
+	p := strings.Split(string(raw), ":")
+	if len(p) != 2 {
+		return cursor{}, errors.New("invalid cursor")
+	}
+	ns, err := strconv.ParseInt(p[0], 10, 64)
+	if err != nil {
+		return cursor{}, errors.New("invalid cursor")
+	}
+	offset, err := strconv.Atoi(p[1])
+	if err != nil || offset < 0 {
+		return cursor{}, errors.New("invalid cursor")
+	}
+	return cursor{t: time.Unix(0, ns).UTC(), offset: offset}, nil
+}
+
+// Search 按条件分页查询记录
+func Search(q Query) (page *Page, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			logrus.Error(e)
+			page, err = nil, fmt.Errorf("parse record failed: %v", e)
+		}
+	}()
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	start, stop, err := parseRange(q.Start, q.Stop)
+	if err != nil {
+		return nil, err
+	}
+	var last cursor
+	if q.Cursor != "" {
+		if last, err = decodeCursor(q.Cursor); err != nil {
+			return nil, err
+		}
+		// range 的 start 包含边界, stop 不包含边界
+		if q.Desc {
+			stop = last.t.Add(time.Nanosecond).Format(time.RFC3339Nano)
+		} else {
+			start = last.t.Format(time.RFC3339Nano)
+		}
+	}
+
+	m := measurements[q.Measurement]
+	var scripts []string
+	scripts = append(scripts, fmt.Sprintf(influxdb.BucketSnippet, db.InfluxdbClient.Bucket))
+	scripts = append(scripts, fmt.Sprintf(influxdb.TimeRangeSnippet, start, stop))
+	scripts = append(scripts, fmt.Sprintf(influxdb.FilterSnippet, strings.Join(tagFilters(m.name, q), " and ")))
+	scripts = append(scripts, pivot)
+	if q.Alert != nil {
+		scripts = append(scripts, fmt.Sprintf(influxdb.FilterSnippet, fmt.Sprintf("r[\"alert\"] == %v", *q.Alert)))
+	}
+	scripts = append(scripts, " |> group()")
+	scripts = append(scripts, fmt.Sprintf(" |> sort(columns: [%s], desc: %v)", quoteColumns(m.sortKey), q.Desc))
+	// 多取一条用于判断是否还有下一页
+	scripts = append(scripts, fmt.Sprintf(" |> limit(n: %d, offset: %d)", q.Limit+1, last.offset))
+	flux := strings.Join(scripts, "\n")
+
+	data, err := db.InfluxdbClient.QueryRaw(flux, context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	var times []time.Time
+	rows := make([]interface{}, 0)
+	for data.Next() {
+		switch q.Measurement {
+		case AlertMeasurement:
+			rows = append(rows, parseAlertRecord(data.Record()))
+		case SystemMeasurement:
+			rows = append(rows, parseSysRecord(data.Record()))
+		case UnionMeasurement:
+			rows = append(rows, parseUnionRecord(data.Record()))
+		}
+		times = append(times, data.Record().Time())
+	}
+	if data.Err() != nil {
+		return nil, fmt.Errorf("query parsing error: %s", data.Err().Error())
+	}
+
+	page = &Page{}
+	if len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+		times = times[:q.Limit]
+		page.Next = nextCursor(last, times).encode()
+	}
+	page.Data = rows
+	return page, nil
+}
+
+// nextCursor 计算下一页的游标，当本页最后一条记录的时间与上一游标相同时需要累加偏移量
+func nextCursor(last cursor, times []time.Time) cursor {
+	next := cursor{t: times[len(times)-1]}
+	for i := len(times) - 1; i >= 0 && times[i].Equal(next.t); i-- {
+		next.offset++
+	}
+	if next.t.Equal(last.t) {
+		next.offset += last.offset
+	}
+	return next
+}
+
+func tagFilters(measurement string, q Query) []string {
+	var filters []string
+	filters = append(filters, fmt.Sprintf(influxdb.MeasurementSnippet, measurement))
+	tags := []struct {
+		key   string
+		value string
+	}{
+		{"project_id", q.ProjectId},
+		{"task_id", q.TaskId},
+		{"sensor_mac", q.SensorMac},
+		{"sensor_type", q.SensorType},
+		{"receive_no", q.ReceiveNo},
+		{"level", q.Level},
+	}
+	for _, t := range tags {
+		if t.value != "" {
+			filters = append(filters, fmt.Sprintf("r[\"%s\"] == \"%s\"", t.key, escapeString(t.value)))
+		}
+	}
+	return filters
+}
+
+func quoteColumns(columns []string) string {
+	var quoted []string
+	for _, c := range columns {
+		quoted = append(quoted, fmt.Sprintf("\"%s\"", c))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// escapeString 转义 flux 字符串中的特殊字符，防止注入
+func escapeString(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "$", "\\$").Replace(s)
+}
+
+// AggregateQuery 聚合查询条件
+// kind   daily 按天统计各任务告警状态的记录数; top 统计告警状态的记录数最多的前 N 个传感器。
+// 统计的是记录而不是告警，一次持续的告警可能包含多条记录
+type AggregateQuery struct {
+	Measurement string
+	Kind        string
+	ProjectId   string
+	TaskId      string
+	Level       string
+	Start       string
+	Stop        string
+	N           int
+}
+
+func (q *AggregateQuery) Validate() error {
+	if q.ProjectId == "" {
+		return errors.New("projectId cannot be empty")
+	}
+	if q.Measurement == "" {
+		q.Measurement = AlertMeasurement
+	}
+	if _, ok := measurements[q.Measurement]; !ok {
+		return fmt.Errorf("measurement must in [%s, %s, %s]", AlertMeasurement, SystemMeasurement, UnionMeasurement)
+	}
+	if q.Level != "" && q.Measurement != SystemMeasurement {
+		return errors.New("level filter is only supported by system record")
+	}
+	if _, _, err := parseRange(q.Start, q.Stop); err != nil {
+		return err
+	}
+	switch q.Kind {
+	case DailyAggregate:
+	case TopAggregate:
+		if q.Measurement == UnionMeasurement {
+			return errors.New("union record has no sensor")
+		}
+		if q.N <= 0 {
+			q.N = defaultTopN
+		}
+	default:
+		return fmt.Errorf("kind must in [%s, %s]", DailyAggregate, TopAggregate)
+	}
+	return nil
+}
+
+// DailyCount 某任务在某天的记录数
+type DailyCount struct {
+	Day    string `json:"day"`
+	TaskId string `json:"task_id"`
+	Count  int64  `json:"count"`
+}
+
+// SensorCount 某传感器的记录数
+type SensorCount struct {
+	SensorMac  string `json:"sensor_mac"`
+	SensorType string `json:"sensor_type"`
+	ReceiveNo  string `json:"receive_no"`
+	Count      int64  `json:"count"`
+}
+
+// Aggregate 统计记录数。alert/union 记录只统计告警状态的记录，system 记录统计全部（可按 level 过滤）
+func Aggregate(q AggregateQuery) (res interface{}, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			logrus.Error(e)
+			res, err = nil, fmt.Errorf("parse record failed: %v", e)
+		}
+	}()
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	start, stop, err := parseRange(q.Start, q.Stop)
+	if err != nil {
+		return nil, err
+	}
+	m := measurements[q.Measurement]
+
+	var scripts []string
+	scripts = append(scripts, fmt.Sprintf(influxdb.BucketSnippet, db.InfluxdbClient.Bucket))
+	scripts = append(scripts, fmt.Sprintf(influxdb.TimeRangeSnippet, start, stop))
+	filters := tagFilters(m.name, Query{ProjectId: q.ProjectId, TaskId: q.TaskId, Level: q.Level})
+	if q.Measurement == SystemMeasurement {
+		filters = append(filters, fmt.Sprintf(influxdb.FieldSnippet, "description"))
+	} else {
+		filters = append(filters, fmt.Sprintf(influxdb.FieldSnippet, "alert"), "r._value == true")
+	}
+	scripts = append(scripts, fmt.Sprintf(influxdb.FilterSnippet, strings.Join(filters, " and ")))
+
+	switch q.Kind {
+	case DailyAggregate:
+		// 窗口按本地时区的零点对齐
+		_, zoneOffset := time.Now().Zone()
+		offset := ((-zoneOffset)%86400 + 86400) % 86400
+		scripts = append(scripts, " |> group(columns: [\"task_id\"])")
+		scripts = append(scripts, fmt.Sprintf(" |> aggregateWindow(every: 1d, offset: %ds, fn: count, timeSrc: \"_start\", createEmpty: false)", offset))
+	case TopAggregate:
+		scripts = append(scripts, " |> group(columns: [\"sensor_mac\", \"sensor_type\", \"receive_no\"])")
+		scripts = append(scripts, " |> count()")
+		scripts = append(scripts, " |> group()")
+		scripts = append(scripts, " |> sort(columns: [\"_value\"], desc: true)")
+		scripts = append(scripts, fmt.Sprintf(" |> limit(n: %d)", q.N))
+	}
+	flux := strings.Join(scripts, "\n")
+
+	data, err := db.InfluxdbClient.QueryRaw(flux, context.Background())
+	if err != nil {
+		return nil, err
+	}
+	switch q.Kind {
+	case DailyAggregate:
+		days := make([]DailyCount, 0)
+		for data.Next() {
+			days = append(days, DailyCount{
+				Day:    data.Record().Time().Local().Format("2006-01-02"),
+				TaskId: data.Record().ValueByKey("task_id").(string),
+				Count:  data.Record().Value().(int64),
+			})
+		}
+		res = days
+	case TopAggregate:
+		sensors := make([]SensorCount, 0)
+		for data.Next() {
+			sensors = append(sensors, SensorCount{
+				SensorMac:  data.Record().ValueByKey("sensor_mac").(string),
+				SensorType: data.Record().ValueByKey("sensor_type").(string),
+				ReceiveNo:  data.Record().ValueByKey("receive_no").(string),
+				Count:      data.Record().Value().(int64),
+			})
+		}
+		res = sensors
+	}
+	if data.Err() != nil {
+		return nil, fmt.Errorf("query parsing error: %s", data.Err().Error())
+	}
+	return res, nil
+}
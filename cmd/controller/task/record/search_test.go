@@ -0,0 +1,50 @@
+package record
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	base := time.Date(2022, 3, 1, 8, 0, 0, 0, time.UTC)
+	times := []time.Time{base, base.Add(time.Second), base.Add(time.Second)}
+
+	next := nextCursor(cursor{}, times)
+	assert.Equal(t, next.t, base.Add(time.Second))
+	assert.Equal(t, next.offset, 2)
+
+	// 下一页仍停留在同一时间点时偏移量需要累加
+	next = nextCursor(next, []time.Time{base.Add(time.Second)})
+	assert.Equal(t, next.offset, 3)
+
+	decoded, err := decodeCursor(next.encode())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, decoded.t.Equal(next.t), true)
+	assert.Equal(t, decoded.offset, next.offset)
+
+	_, err = decodeCursor("invalid")
+	assert.NotEqual(t, err, nil)
+}
+
+func TestParseRange(t *testing.T) {
+	start, stop, err := parseRange("", "")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, start, "-7d")
+	assert.Equal(t, stop, "now()")
+
+	start, stop, err = parseRange("2022-03-01 08:00:00", "2022-03-02 08:00:00")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, start, "2022-03-01T08:00:00Z")
+	assert.Equal(t, stop, "2022-03-02T08:00:00Z")
+
+	// 不符合格式的时间不能拼接到 flux 中
+	_, _, err = parseRange(`-1d) |> drop(columns: ["x"]`, "")
+	assert.NotEqual(t, err, nil)
+	_, _, err = parseRange("", "now()")
+	assert.NotEqual(t, err, nil)
+	q := Query{ProjectId: "1", Start: "-1d"}
+	assert.NotEqual(t, q.Validate(), nil)
+	aq := AggregateQuery{ProjectId: "1", Kind: DailyAggregate, Stop: "2022-03-02"}
+	assert.NotEqual(t, aq.Validate(), nil)
+}
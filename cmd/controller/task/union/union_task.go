@@ -6,6 +6,8 @@ import (
 	"anomaly-detect/pkg/validator"
 	"fmt"
 	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 type Task struct {
@@ -65,6 +67,13 @@ func (t *Task) Stop() error {
 	return nil
 }
 
+// Done 联合告警任务由数据驱动, 没有协程
+func (t *Task) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
 func (t *Task) Restart() error {
 	return nil
 }
@@ -206,7 +215,7 @@ func (t *Task) Run(projectId, sensorMac, sensorType, receiveNo string, value flo
 }
 
 func (t *Task) publish(level int, pt time.Time) {
-	fmt.Println("save alert record", level, pt.Local().String())
+	logrus.Infof("task %s: save alert record, level %d at %s", t.info.TaskId, level, pt.Local().String())
 	for _, s := range t.info.Series {
 		key := fmt.Sprintf("%s#%s#%s", s.SensorMac, s.SensorType, s.ReceiveNo)
 		r := record.Record{
@@ -223,8 +232,9 @@ func (t *Task) publish(level int, pt time.Time) {
 		}
 		err := record.SaveAlertRecord(t.info.TaskId, t.info.ProjectId, r)
 		if err != nil {
-			fmt.Println(err.Error())
+			logrus.Errorf("task %s: save alert record failed: %s", t.info.TaskId, err.Error())
 		}
+		record.Publish(r.ToAlert(t.info.TaskId, t.info.ProjectId))
 	}
 }
 
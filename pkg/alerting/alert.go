@@ -0,0 +1,109 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+// State : state of alert
+type State string
+
+const (
+	Firing   State = "firing"
+	Resolved State = "resolved"
+)
+
+// well known annotations, used by templates of alertengine
+const (
+	SummaryAnnotation     = "summary"
+	DescriptionAnnotation = "description"
+	LinkAnnotation        = "link"
+)
+
+// level of alert, same as the level of controller task
+const (
+	InfoLevel = iota
+	WarnLevel
+	AlertLevel
+)
+
+// Series : sensor series detected by task
+type Series struct {
+	SensorMac  string `json:"sensor_mac"`
+	SensorType string `json:"sensor_type"`
+	ReceiveNo  string `json:"receive_no"`
+}
+
+// Alert : structured alert sent from controller to alertengine.
+// Alerts with the same fingerprint are the same alert, id is the fingerprint if empty
+type Alert struct {
+	Id             string            `json:"id"`
+	ProjectId      string            `json:"project_id"`
+	TaskId         string            `json:"task_id"`
+	Series         Series            `json:"series"`
+	Level          int               `json:"level"`
+	State          State             `json:"state"` // firing if empty
+	Value          float64           `json:"value"`
+	ThresholdLower float64           `json:"threshold_lower"`
+	ThresholdUpper float64           `json:"threshold_upper"`
+	Start          time.Time         `json:"start"`
+	Stop           time.Time         `json:"stop"`
+	Labels         map[string]string `json:"labels"`      // identify the alert, matched by routes
+	Annotations    map[string]string `json:"annotations"` // extra information, for example summary, description and link
+}
+
+func (a Alert) Validate() error {
+	if a.ProjectId == "" || a.TaskId == "" {
+		return errors.New("project_id and task_id of alert could not be empty")
+	}
+	if a.State != "" && a.State != Firing && a.State != Resolved {
+		return fmt.Errorf("state of alert must in [%s, %s]", Firing, Resolved)
+	}
+	if a.Level < InfoLevel || a.Level > AlertLevel {
+		return fmt.Errorf("invalid level %d", a.Level)
+	}
+	if !a.Start.IsZero() && !a.Stop.IsZero() && a.Stop.Before(a.Start) {
+		return errors.New("stop of alert could not be before start")
+	}
+	return nil
+}
+
+// IsResolved : whether the alert is resolved
+func (a Alert) IsResolved() bool {
+	return a.State == Resolved
+}
+
+// Fingerprint : hash of project, task, series and labels. Level, state and value are not included
+func (a Alert) Fingerprint() string {
+	h := fnv.New64a()
+	write := func(s string) {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0xff})
+	}
+	write(a.ProjectId)
+	write(a.TaskId)
+	write(a.Series.SensorMac)
+	write(a.Series.SensorType)
+	write(a.Series.ReceiveNo)
+	keys := make([]string, 0, len(a.Labels))
+	for k := range a.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		write(k)
+		write(a.Labels[k])
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// Key : id of alert, fingerprint if id is empty
+func (a Alert) Key() string {
+	if a.Id != "" {
+		return a.Id
+	}
+	return a.Fingerprint()
+}
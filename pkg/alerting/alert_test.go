@@ -0,0 +1,44 @@
+package alerting
+
+import (
+	"github.com/go-playground/assert/v2"
+	"testing"
+	"time"
+)
+
+func TestFingerprint(t *testing.T) {
+	a := Alert{
+		ProjectId: "3",
+		TaskId:    "task",
+		Series:    Series{SensorMac: "C125", SensorType: "temperature_air", ReceiveNo: "2"},
+		Level:     AlertLevel,
+		Value:     35.2,
+		Labels:    map[string]string{"location": "room1", "floor": "2"},
+	}
+	b := a
+	b.Level, b.State, b.Value = WarnLevel, Resolved, 20
+	b.Labels = map[string]string{"floor": "2", "location": "room1"}
+	assert.Equal(t, a.Fingerprint(), b.Fingerprint())
+	assert.Equal(t, a.Key(), a.Fingerprint())
+
+	b.Series.ReceiveNo = "3"
+	assert.NotEqual(t, a.Fingerprint(), b.Fingerprint())
+
+	a.Id = "custom"
+	assert.Equal(t, a.Key(), "custom")
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+	a := Alert{ProjectId: "3", TaskId: "task", Start: now, Stop: now}
+	assert.Equal(t, a.Validate(), nil)
+	a.State = "pending"
+	assert.NotEqual(t, a.Validate(), nil)
+	a.State = Resolved
+	a.Stop = now.Add(-time.Minute)
+	assert.NotEqual(t, a.Validate(), nil)
+	a.Stop, a.Level = now, 3
+	assert.NotEqual(t, a.Validate(), nil)
+	a.Level, a.TaskId = AlertLevel, ""
+	assert.NotEqual(t, a.Validate(), nil)
+}
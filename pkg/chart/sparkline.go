@@ -0,0 +1,193 @@
+package chart
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"time"
+)
+
+var (
+	backgroundColor = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	bandColor       = color.RGBA{R: 232, G: 245, B: 233, A: 255} // between thresholds
+	windowColor     = color.RGBA{R: 255, G: 235, B: 230, A: 255} // alert window
+	thresholdColor  = color.RGBA{R: 229, G: 115, B: 115, A: 255}
+	lineColor       = color.RGBA{R: 30, G: 136, B: 229, A: 255}
+	anomalyColor    = color.RGBA{R: 211, G: 47, B: 47, A: 255}
+)
+
+// Sparkline : small line chart of a time series without axis and text.
+// The band between thresholds is filled, the alert window is highlighted and segments beyond thresholds are drawn in red
+type Sparkline struct {
+	Width  int
+	Height int
+	Time   []time.Time
+	Values []*float64 // nil means missing value, the line is broken
+	Lower  *float64   // threshold lower, not drawn if nil
+	Upper  *float64   // threshold upper, not drawn if nil
+	Start  time.Time  // alert window, not drawn if zero
+	Stop   time.Time
+}
+
+const padding = 4
+
+// Render : encode chart as png
+func (s Sparkline) Render(w io.Writer) error {
+	img, err := s.Draw()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// Draw : draw chart to image
+func (s Sparkline) Draw() (*image.RGBA, error) {
+	if s.Width <= 2*padding || s.Height <= 2*padding {
+		return nil, fmt.Errorf("chart size too small")
+	}
+	if len(s.Time) != len(s.Values) {
+		return nil, fmt.Errorf("length of time and values not match")
+	}
+	if len(s.Time) == 0 {
+		return nil, fmt.Errorf("empty series")
+	}
+	img := image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: backgroundColor}, image.Point{}, draw.Src)
+
+	lo, hi := s.valueRange()
+	first, last := s.Time[0], s.Time[len(s.Time)-1]
+	x := func(t time.Time) int {
+		if !last.After(first) {
+			return s.Width / 2
+		}
+		ratio := float64(t.Sub(first)) / float64(last.Sub(first))
+		return padding + int(math.Round(ratio*float64(s.Width-2*padding-1)))
+	}
+	y := func(v float64) int {
+		ratio := (v - lo) / (hi - lo)
+		return s.Height - 1 - padding - int(math.Round(ratio*float64(s.Height-2*padding-1)))
+	}
+
+	if s.Lower != nil && s.Upper != nil {
+		fillRect(img, 0, y(*s.Upper), s.Width-1, y(*s.Lower), bandColor)
+	}
+	if !s.Start.IsZero() {
+		stop := s.Stop
+		if stop.IsZero() || stop.After(last) {
+			stop = last
+		}
+		start := s.Start
+		if start.Before(first) {
+			start = first
+		}
+		if !stop.Before(start) {
+			fillRect(img, x(start), 0, x(stop), s.Height-1, windowColor)
+		}
+	}
+	for _, t := range []*float64{s.Lower, s.Upper} {
+		if t != nil {
+			dashed(img, y(*t), thresholdColor)
+		}
+	}
+
+	outside := func(v float64) bool {
+		return (s.Lower != nil && v < *s.Lower) || (s.Upper != nil && v > *s.Upper)
+	}
+	var prev *float64
+	var prevX, prevY int
+	for i, v := range s.Values {
+		if v == nil {
+			prev = nil
+			continue
+		}
+		cx, cy := x(s.Time[i]), y(*v)
+		c := lineColor
+		if outside(*v) || (prev != nil && outside(*prev)) {
+			c = anomalyColor
+		}
+		if prev != nil {
+			line(img, prevX, prevY, cx, cy, c)
+			line(img, prevX, prevY+1, cx, cy+1, c)
+		} else {
+			fillRect(img, cx, cy, cx+1, cy+1, c)
+		}
+		prev, prevX, prevY = v, cx, cy
+	}
+	return img, nil
+}
+
+// valueRange : range of values and thresholds with margin
+func (s Sparkline) valueRange() (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range append(append([]*float64{}, s.Values...), s.Lower, s.Upper) {
+		if v == nil || math.IsNaN(*v) || math.IsInf(*v, 0) {
+			continue
+		}
+		lo, hi = math.Min(lo, *v), math.Max(hi, *v)
+	}
+	if math.IsInf(lo, 1) {
+		return 0, 1
+	}
+	if hi == lo {
+		return lo - 1, hi + 1
+	}
+	margin := (hi - lo) * 0.05
+	return lo - margin, hi + margin
+}
+
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	if x0 > x1 {
+		x0, x1 = x1, x0
+	}
+	if y0 > y1 {
+		y0, y1 = y1, y0
+	}
+	draw.Draw(img, image.Rect(x0, y0, x1+1, y1+1).Intersect(img.Bounds()), &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
+
+func dashed(img *image.RGBA, y int, c color.Color) {
+	for x := 0; x < img.Bounds().Dx(); x++ {
+		if x%6 < 4 {
+			img.Set(x, y, c)
+		}
+	}
+}
+
+// line : Bresenham's line algorithm
+func line(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,48 @@
+package chart
+
+import (
+	"bytes"
+	"github.com/go-playground/assert/v2"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestSparkline(t *testing.T) {
+	now := time.Now()
+	s := Sparkline{Width: 200, Height: 60, Start: now.Add(5 * time.Minute), Stop: now.Add(7 * time.Minute)}
+	lower, upper := 10.0, 20.0
+	s.Lower, s.Upper = &lower, &upper
+	for i := 0; i < 10; i++ {
+		v := 15.0
+		if i == 6 {
+			v = 30
+		}
+		s.Time = append(s.Time, now.Add(time.Duration(i)*time.Minute))
+		if i == 3 {
+			s.Values = append(s.Values, nil)
+		} else {
+			s.Values = append(s.Values, &v)
+		}
+	}
+	img, err := s.Draw()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, img.At(0, 0), backgroundColor)
+	// the peak is drawn in red near the top
+	x := padding + int(float64(6)/9*float64(s.Width-2*padding-1)+0.5)
+	red := false
+	for y := 0; y < s.Height/4; y++ {
+		red = red || img.At(x, y) == anomalyColor
+	}
+	assert.Equal(t, red, true)
+
+	var buf bytes.Buffer
+	assert.Equal(t, s.Render(&buf), nil)
+	decoded, err := png.Decode(&buf)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, decoded.Bounds().Dx(), 200)
+
+	s.Values = s.Values[:1]
+	_, err = s.Draw()
+	assert.NotEqual(t, err, nil)
+}
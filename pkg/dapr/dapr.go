@@ -2,7 +2,13 @@ package dapr
 
 import (
 	"anomaly-detect/pkg/env"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
+	"time"
 )
 
 const (
@@ -21,7 +27,7 @@ const (
 	//getStateUrl      = "http://localhost:%d/v1.0/state/%s/%s"
 	//saveStateUrl     = "http://localhost:%d/v1.0/state/%s"
 	//outputBindingUrl = "http://localhost:%d/v1.0/bindings/%s"
-	//publishUrl       = "http://localhost:%d/v1.0/publish/%s/%s"
+	publishUrl = "http://localhost:%d/v1.0/publish/%s/%s"
 	healthzUrl = "http://localhost:%d/v1.0/healthz"
 )
 
@@ -43,3 +49,24 @@ func NewDapr(service string, port int) *Dapr {
 		service, port, dapr.DaprHttpPort, dapr.DaprGrpcPort)
 	return dapr
 }
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Publish : publish data as json to topic of pubsub component through the sidecar
+func (d *Dapr) Publish(pubsub, topic string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf(publishUrl, d.DaprHttpPort, pubsub, topic)
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		content, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("publish to %s/%s failed: %s %s", pubsub, topic, resp.Status, string(content))
+	}
+	return nil
+}
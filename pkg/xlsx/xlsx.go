@@ -0,0 +1,168 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Writer : minimal streaming xlsx writer with a single worksheet.
+// rows are written directly into the zip stream, so the whole sheet never stays in memory.
+// cells support string, bool, int, int64 and float64, other types are formatted with %v.
+// NaN and Inf are written as strings, characters not allowed in XML are removed
+type Writer struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	row   int
+	err   error
+}
+
+const contentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const rootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const workbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`</Relationships>`
+
+const workbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+	`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+const sheetHeader = xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+const sheetFooter = `</sheetData></worksheet>`
+
+// NewWriter : create a writer with a worksheet named sheetName
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	zw := zip.NewWriter(w)
+	var name bytes.Buffer
+	_ = xml.EscapeText(&name, []byte(xmlText(sheetName)))
+	files := []struct {
+		path    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+		{"xl/workbook.xml", fmt.Sprintf(workbook, name.String())},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.WriteString(fw, f.content); err != nil {
+			return nil, err
+		}
+	}
+	sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.WriteString(sheet, sheetHeader); err != nil {
+		return nil, err
+	}
+	return &Writer{zw: zw, sheet: sheet}, nil
+}
+
+// Write : append a row to the worksheet
+func (w *Writer) Write(cells []interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.row++
+	w.printf(`<row r="%d">`, w.row)
+	for i, c := range cells {
+		ref := columnName(i) + strconv.Itoa(w.row)
+		switch v := c.(type) {
+		case nil:
+			continue
+		case bool:
+			b := 0
+			if v {
+				b = 1
+			}
+			w.printf(`<c r="%s" t="b"><v>%d</v></c>`, ref, b)
+		case int:
+			w.printf(`<c r="%s"><v>%d</v></c>`, ref, v)
+		case int64:
+			w.printf(`<c r="%s"><v>%d</v></c>`, ref, v)
+		case float64:
+			// excel could not open numeric cells of NaN or Inf
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				w.inlineString(ref, strconv.FormatFloat(v, 'f', -1, 64))
+			} else {
+				w.printf(`<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+			}
+		default:
+			w.inlineString(ref, fmt.Sprintf("%v", v))
+		}
+	}
+	w.printf(`</row>`)
+	return w.err
+}
+
+// Close : finish the worksheet and flush the zip stream, the underlying writer is not closed
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if _, err := io.WriteString(w.sheet, sheetFooter); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+func (w *Writer) inlineString(ref, s string) {
+	var text bytes.Buffer
+	_ = xml.EscapeText(&text, []byte(xmlText(s)))
+	w.printf(`<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, text.String())
+}
+
+func (w *Writer) printf(format string, a ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.sheet, format, a...)
+}
+
+// xmlText : remove characters not allowed in XML 1.0, such as control characters and invalid utf-8
+func xmlText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if r == utf8.RuneError && size == 1 {
+			continue
+		}
+		if r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r <= 0xD7FF) ||
+			(r >= 0xE000 && r <= 0xFFFD) || (r >= 0x10000 && r <= 0x10FFFF) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// columnName : 0 -> A, 25 -> Z, 26 -> AA
+func columnName(i int) string {
+	name := ""
+	for i >= 0 {
+		name = string(rune('A'+i%26)) + name
+		i = i/26 - 1
+	}
+	return name
+}
@@ -0,0 +1,116 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"github.com/go-playground/assert/v2"
+	"io/ioutil"
+	"math"
+	"testing"
+)
+
+type cell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+type sheet struct {
+	Rows []struct {
+		Ref   int    `xml:"r,attr"`
+		Cells []cell `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readFile(t *testing.T, r *zip.Reader, name string) []byte {
+	for _, f := range r.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			assert.Equal(t, err, nil)
+			defer rc.Close()
+			content, err := ioutil.ReadAll(rc)
+			assert.Equal(t, err, nil)
+			return content
+		}
+	}
+	t.Fatalf("%s not found", name)
+	return nil
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "a<b")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, w.Write([]interface{}{"name", "value"}), nil)
+	row := make([]interface{}, 28)
+	row[0], row[1], row[2], row[3], row[4] = `x & <y> "z"`, 1.5, true, 3, int64(4)
+	row[27] = "last"
+	assert.Equal(t, w.Write(row), nil)
+	assert.Equal(t, w.Close(), nil)
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Equal(t, err, nil)
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, names, []string{"[Content_Types].xml", "_rels/.rels", "xl/_rels/workbook.xml.rels",
+		"xl/workbook.xml", "xl/worksheets/sheet1.xml"})
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	assert.Equal(t, xml.Unmarshal(readFile(t, r, "xl/workbook.xml"), &workbook), nil)
+	assert.Equal(t, workbook.Sheets[0].Name, "a<b")
+
+	var s sheet
+	assert.Equal(t, xml.Unmarshal(readFile(t, r, "xl/worksheets/sheet1.xml"), &s), nil)
+	assert.Equal(t, len(s.Rows), 2)
+	assert.Equal(t, s.Rows[0].Ref, 1)
+	assert.Equal(t, s.Rows[0].Cells, []cell{{Ref: "A1", Type: "inlineStr", Inline: "name"}, {Ref: "B1", Type: "inlineStr", Inline: "value"}})
+	// nil cells are skipped
+	assert.Equal(t, s.Rows[1].Cells, []cell{
+		{Ref: "A2", Type: "inlineStr", Inline: `x & <y> "z"`},
+		{Ref: "B2", Value: "1.5"},
+		{Ref: "C2", Type: "b", Value: "1"},
+		{Ref: "D2", Value: "3"},
+		{Ref: "E2", Value: "4"},
+		{Ref: "AB2", Type: "inlineStr", Inline: "last"},
+	})
+}
+
+func TestWriterInvalid(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "s\x01heet")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, w.Write([]interface{}{math.NaN(), math.Inf(1), math.Inf(-1), "a\x00b\x1bc\td\xff", "\uFFFEe"}), nil)
+	assert.Equal(t, w.Close(), nil)
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Equal(t, err, nil)
+	content := readFile(t, r, "xl/worksheets/sheet1.xml")
+	assert.Equal(t, bytes.ContainsAny(content, "\x00\x1b\ufffd"), false)
+	var s sheet
+	assert.Equal(t, xml.Unmarshal(content, &s), nil)
+	// non-finite floats are strings, invalid characters are removed
+	assert.Equal(t, s.Rows[0].Cells, []cell{
+		{Ref: "A1", Type: "inlineStr", Inline: "NaN"},
+		{Ref: "B1", Type: "inlineStr", Inline: "+Inf"},
+		{Ref: "C1", Type: "inlineStr", Inline: "-Inf"},
+		{Ref: "D1", Type: "inlineStr", Inline: "abc\td"},
+		{Ref: "E1", Type: "inlineStr", Inline: "e"},
+	})
+	assert.Equal(t, bytes.Contains(readFile(t, r, "xl/workbook.xml"), []byte(`name="sheet"`)), true)
+}
+
+func TestColumnName(t *testing.T) {
+	assert.Equal(t, columnName(0), "A")
+	assert.Equal(t, columnName(25), "Z")
+	assert.Equal(t, columnName(26), "AA")
+	assert.Equal(t, columnName(701), "ZZ")
+	assert.Equal(t, columnName(702), "AAA")
+}